@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/apex/log"
+	"github.com/named-data/YaNFD/core"
+	"github.com/pelletier/go-toml"
+)
+
+// defaultConfigFile is where the configuration file is read from if no -config flag is given.
+const defaultConfigFile = "/usr/local/etc/ndn/mgmt.toml"
+
+// configPathKeys are the configuration keys holding file paths, which are relative to the configuration file.
+var configPathKeys = []string{"mgmt.trust_anchors", "mgmt.certificates", "mgmt.policy", "mgmt.localhop_trust_schema", "mgmt.rib_journal"}
+
+// loadConfig reads the configuration file, applies the overrides from the command line, validates the result, and loads it into YaNFD's core configuration. A missing file is only an error if it was explicitly specified.
+func loadConfig(file string, explicit bool, overrides map[string]interface{}) error {
+	tree, err := toml.LoadFile(file)
+	if os.IsNotExist(err) && !explicit {
+		tree, err = toml.TreeFromMap(map[string]interface{}{})
+	}
+	if err != nil {
+		return err
+	}
+	for key, value := range overrides {
+		tree.Set(key, value)
+	}
+	resolveConfigPaths(tree, filepath.Dir(file))
+
+	if err := validateConfig(tree); err != nil {
+		return err
+	}
+
+	// YaNFD's core only loads configuration from files, so the merged configuration is written to a temporary file
+	merged, err := os.CreateTemp("", "mgmt-*.toml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(merged.Name())
+	if _, err := tree.WriteTo(merged); err != nil {
+		merged.Close()
+		return err
+	}
+	merged.Close()
+	core.LoadConfig(merged.Name())
+	return nil
+}
+
+// resolveConfigPaths makes the file paths in the configuration absolute, since the merged configuration is not loaded from the directory of the original file.
+func resolveConfigPaths(tree *toml.Tree, dir string) {
+	resolve := func(path string) string {
+		if path == "" || filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(dir, path)
+	}
+	for _, key := range configPathKeys {
+		switch value := tree.Get(key).(type) {
+		case string:
+			tree.Set(key, resolve(value))
+		case []interface{}:
+			paths := make([]string, 0, len(value))
+			for _, path := range value {
+				if path, ok := path.(string); ok {
+					paths = append(paths, resolve(path))
+				}
+			}
+			tree.Set(key, paths)
+		}
+	}
+}
+
+// validateConfig checks the settings used by the daemon itself. Management module settings are validated by modules.Configure.
+func validateConfig(tree *toml.Tree) error {
+	if logLevel, ok := tree.GetDefault("core.log_level", "INFO").(string); !ok {
+		return errors.New("core.log_level must be a string")
+	} else if _, err := log.ParseLevel(logLevel); err != nil && logLevel != "TRACE" {
+		return errors.New("core.log_level '" + logLevel + "' is not a valid log level")
+	}
+	if socket, ok := tree.GetDefault("mgmt.ack_socket", "/tmp/ackmgmt.sock").(string); !ok || socket == "" {
+		return errors.New("mgmt.ack_socket must be a non-empty string")
+	}
+	if timeout, ok := tree.GetDefault("mgmt.shutdown_timeout", int64(5000)).(int64); !ok || timeout <= 0 {
+		return errors.New("mgmt.shutdown_timeout must be a positive integer")
+	}
+	if _, ok := tree.GetDefault("mgmt.rib_journal", "").(string); !ok {
+		return errors.New("mgmt.rib_journal must be a string")
+	}
+	if interval, ok := tree.GetDefault("mgmt.rib_journal_compaction_interval", int64(3600)).(int64); !ok || interval <= 0 {
+		return errors.New("mgmt.rib_journal_compaction_interval must be a positive integer")
+	}
+	return nil
+}
@@ -0,0 +1,479 @@
+package fakeforwarder
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/amazingtapioca17/mgmt/mgmtconn"
+	"github.com/amazingtapioca17/mgmt/shm"
+	"github.com/named-data/YaNFD/ndn"
+	"github.com/named-data/YaNFD/ndn/mgmt"
+	"github.com/named-data/YaNFD/ndn/tlv"
+)
+
+// commands are the commands of the AckConn protocol served by the fake forwarder.
+var commands = []string{
+	"hello", "list", "forwarderstatus", "channels", "listface", "createface", "updateface", "destroyface", "query", "info",
+	"versions", "liststrategy", "faceid", "clear", "remove", "insert", "replacenexthops", "setstrategy", "unsetstrategy", "set",
+	"sharedmemory",
+}
+
+// maxMessageSize bounds the size of a command from management.
+const maxMessageSize = 65536
+
+func (f *Forwarder) acceptCommands() {
+	defer f.wg.Done()
+	for {
+		conn, err := f.ackListener.Accept()
+		if err != nil {
+			return
+		}
+		f.mutex.Lock()
+		if f.closed {
+			f.mutex.Unlock()
+			conn.Close()
+			return
+		}
+		f.ackConns[conn] = true
+		f.mutex.Unlock()
+
+		f.wg.Add(1)
+		go f.serveCommands(conn)
+	}
+}
+
+// serveCommands answers commands from one management connection until it is closed. Replies use the encoding of the command they answer.
+func (f *Forwarder) serveCommands(conn net.Conn) {
+	defer f.wg.Done()
+	defer func() {
+		f.mutex.Lock()
+		delete(f.ackConns, conn)
+		f.mutex.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		wire, err := readCommand(conn)
+		if err != nil {
+			return
+		}
+		encoding := mgmtconn.MessageEncoding(wire)
+		command, err := mgmtconn.DecodeMessage(wire)
+		if err != nil {
+			fmt.Println("Fake forwarder dropping undecodable command:", err)
+			continue
+		}
+
+		if command.Command == "sharedmemory" {
+			// The connection is replaced if management attaches a segment to the command channel
+			conn, err = f.attachSegment(conn, &command, encoding)
+			if err != nil {
+				return
+			}
+			continue
+		}
+
+		reply, events := f.handleCommand(&command)
+		reply.RequestID = command.RequestID
+		replyWire, err := mgmtconn.EncodeMessage(&reply, encoding)
+		if err != nil {
+			fmt.Println("Fake forwarder unable to encode reply to", command.Command, ":", err)
+			continue
+		}
+		if _, err := conn.Write(replyWire); err != nil {
+			return
+		}
+		for _, event := range events {
+			f.sendEvent(event)
+		}
+	}
+}
+
+// readCommand reads a command from management, whole if the connection is over shared memory.
+func readCommand(conn net.Conn) ([]byte, error) {
+	if shmConn, ok := conn.(*shm.Conn); ok {
+		return shmConn.ReadMessage()
+	}
+	buf := make([]byte, maxMessageSize)
+	n, err := conn.Read(buf)
+	return buf[:n], err
+}
+
+// sendEvent sends an event to every management connection in JSON.
+func (f *Forwarder) sendEvent(event mgmtconn.Message) {
+	wire, err := mgmtconn.EncodeMessage(&event, "json")
+	if err != nil {
+		return
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for conn := range f.ackConns {
+		conn.Write(wire)
+	}
+}
+
+func faceEvent(kind string, face *Face) mgmtconn.Message {
+	event := mgmtconn.Message{
+		Command:         "event",
+		Event:           kind,
+		FaceID:          face.FaceID,
+		FaceScope:       face.Scope,
+		FacePersistency: face.Persistency,
+		LinkType:        face.LinkType,
+		Flags:           face.Flags,
+	}
+	if face.URI != nil {
+		event.URI = face.URI.String()
+	}
+	if face.LocalURI != nil {
+		event.LocalURI = face.LocalURI.String()
+	}
+	return event
+}
+
+func errorReply(code int, message string) mgmtconn.Message {
+	return mgmtconn.Message{ErrorCode: code, ErrorMessage: message}
+}
+
+// handleCommand executes a command, returning the reply and the events it caused, which are sent after the reply.
+func (f *Forwarder) handleCommand(command *mgmtconn.Message) (mgmtconn.Message, []mgmtconn.Message) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	switch command.Command {
+	case "hello":
+		return mgmtconn.Message{
+			ProtocolVersion: mgmtconn.ProtocolVersion,
+			Commands:        commands,
+			BuildInfo:       "fakeforwarder",
+		}, nil
+	case "list":
+		return f.datasetReply(f.fibDataset())
+	case "forwarderstatus":
+		return f.datasetReply(f.statusDataset())
+	case "channels":
+		return mgmtconn.Message{}, nil
+	case "listface":
+		return f.datasetReply(f.faceDataset(nil))
+	case "query":
+		return f.datasetReply(f.faceDataset(&command.FaceQueryFilter))
+	case "info":
+		return f.datasetReply(f.csDataset())
+	case "liststrategy":
+		return f.datasetReply(f.strategyDataset())
+	case "createface":
+		return f.handleCreateFace(&command.ControlParams)
+	case "updateface":
+		return f.handleUpdateFace(&command.ControlParams, command.FaceID)
+	case "destroyface":
+		face := f.destroyFace(command.FaceID)
+		if face == nil {
+			return mgmtconn.Message{}, nil
+		}
+		return mgmtconn.Message{Valid: true}, []mgmtconn.Message{faceEvent("facedestroyed", face)}
+	case "faceid":
+		// Valid reports that the face does not exist
+		_, ok := f.faces[command.FaceID]
+		return mgmtconn.Message{Valid: !ok}, nil
+	case "insert":
+		name, err := ndn.NameFromString(command.Name)
+		if err != nil {
+			return errorReply(400, "Invalid name"), nil
+		}
+		f.insertNextHop(name, command.FaceID, command.Cost)
+		return mgmtconn.Message{}, nil
+	case "remove":
+		name, err := ndn.NameFromString(command.Name)
+		if err != nil {
+			return errorReply(400, "Invalid name"), nil
+		}
+		if nexthops, ok := f.fib[name.String()]; ok {
+			delete(nexthops, command.FaceID)
+			if len(nexthops) == 0 {
+				delete(f.fib, name.String())
+				delete(f.fibNames, name.String())
+			}
+		}
+		return mgmtconn.Message{}, nil
+	case "clear":
+		name, err := ndn.NameFromString(command.Name)
+		if err != nil {
+			return errorReply(400, "Invalid name"), nil
+		}
+		delete(f.fib, name.String())
+		delete(f.fibNames, name.String())
+		return mgmtconn.Message{}, nil
+	case "replacenexthops":
+		name, err := ndn.NameFromString(command.Name)
+		if err != nil {
+			return errorReply(400, "Invalid name"), nil
+		}
+		delete(f.fib, name.String())
+		delete(f.fibNames, name.String())
+		for _, nexthop := range command.NextHops {
+			f.insertNextHop(name, nexthop.FaceID, nexthop.Cost)
+		}
+		return mgmtconn.Message{}, nil
+	case "versions":
+		versions, ok := f.Strategies[command.Strategy]
+		return mgmtconn.Message{Versions: versions, Valid: ok}, nil
+	case "setstrategy":
+		name, err := ndn.NameFromString(command.ParamName)
+		if err != nil {
+			return errorReply(400, "Invalid name"), nil
+		}
+		strategy, err := ndn.NameFromString(command.Strategy)
+		if err != nil {
+			return errorReply(400, "Invalid strategy"), nil
+		}
+		f.strategies[name.String()] = strategy
+		return mgmtconn.Message{}, nil
+	case "unsetstrategy":
+		name, err := ndn.NameFromString(command.ParamName)
+		if err != nil {
+			return errorReply(400, "Invalid name"), nil
+		}
+		delete(f.strategies, name.String())
+		return mgmtconn.Message{}, nil
+	case "set":
+		if command.Capacity < 0 {
+			return errorReply(400, "Invalid capacity"), nil
+		}
+		f.csCapacity = command.Capacity
+		return mgmtconn.Message{}, nil
+	default:
+		return errorReply(501, "Unknown command"), nil
+	}
+}
+
+func (f *Forwarder) handleCreateFace(params *mgmt.ControlParameters) (mgmtconn.Message, []mgmtconn.Message) {
+	if params.URI == nil {
+		return mgmtconn.Message{ControlResponse: *mgmt.MakeControlResponse(400, "ControlParameters is incorrect", nil)}, nil
+	}
+	for _, face := range f.faces {
+		if face.URI.String() == params.URI.String() {
+			return mgmtconn.Message{ControlResponse: *mgmt.MakeControlResponse(409, "Face already exists", f.faceParams(face))}, nil
+		}
+	}
+
+	var persistency uint64
+	if params.FacePersistency != nil {
+		persistency = *params.FacePersistency
+	}
+	face := f.createFace(params.URI, persistency)
+	if params.LocalURI != nil {
+		face.LocalURI = params.LocalURI
+	}
+	if params.MTU != nil {
+		face.MTU = *params.MTU
+	}
+	if params.Flags != nil && params.Mask != nil {
+		face.Flags = (face.Flags &^ *params.Mask) | (*params.Flags & *params.Mask)
+	}
+	return mgmtconn.Message{ControlResponse: *mgmt.MakeControlResponse(200, "OK", f.faceParams(face))},
+		[]mgmtconn.Message{faceEvent("facecreated", face)}
+}
+
+func (f *Forwarder) handleUpdateFace(params *mgmt.ControlParameters, faceID uint64) (mgmtconn.Message, []mgmtconn.Message) {
+	face, ok := f.faces[faceID]
+	if !ok {
+		return mgmtconn.Message{ControlResponse: *mgmt.MakeControlResponse(404, "Face does not exist", nil)}, nil
+	}
+	if params.FacePersistency != nil {
+		face.Persistency = *params.FacePersistency
+	}
+	if params.MTU != nil {
+		face.MTU = *params.MTU
+	}
+	if params.Flags != nil && params.Mask != nil {
+		face.Flags = (face.Flags &^ *params.Mask) | (*params.Flags & *params.Mask)
+	}
+	return mgmtconn.Message{ControlResponse: *mgmt.MakeControlResponse(200, "OK", f.faceParams(face))}, nil
+}
+
+// faceParams encodes the ControlParameters describing a face, for the body of a ControlResponse.
+func (f *Forwarder) faceParams(face *Face) *tlv.Block {
+	params := mgmt.MakeControlParameters()
+	params.FaceID = new(uint64)
+	*params.FaceID = face.FaceID
+	params.URI = face.URI
+	params.LocalURI = face.LocalURI
+	params.FacePersistency = new(uint64)
+	*params.FacePersistency = face.Persistency
+	params.MTU = new(uint64)
+	*params.MTU = face.MTU
+	params.Flags = new(uint64)
+	*params.Flags = face.Flags
+	block, err := params.Encode()
+	if err != nil {
+		return nil
+	}
+	return block
+}
+
+func (f *Forwarder) insertNextHop(name *ndn.Name, faceID uint64, cost uint64) {
+	nexthops, ok := f.fib[name.String()]
+	if !ok {
+		nexthops = make(map[uint64]uint64)
+		f.fib[name.String()] = nexthops
+		f.fibNames[name.String()] = name
+	}
+	nexthops[faceID] = cost
+}
+
+// datasetReply converts the result of generating a dataset into a reply.
+func (f *Forwarder) datasetReply(dataset []byte, err error) (mgmtconn.Message, []mgmtconn.Message) {
+	if err != nil {
+		return errorReply(500, err.Error()), nil
+	}
+	return mgmtconn.Message{Dataset: dataset}, nil
+}
+
+// appendEncoded appends the wire encoding of an encoded dataset entry.
+func appendEncoded(dataset []byte, block *tlv.Block, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	wire, err := block.Wire()
+	if err != nil {
+		return nil, err
+	}
+	return append(dataset, wire...), nil
+}
+
+func (f *Forwarder) fibDataset() ([]byte, error) {
+	names := make([]string, 0, len(f.fib))
+	for name := range f.fib {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var dataset []byte
+	for _, name := range names {
+		entry := mgmt.MakeFibEntry(f.fibNames[name])
+		faceIDs := make([]uint64, 0, len(f.fib[name]))
+		for faceID := range f.fib[name] {
+			faceIDs = append(faceIDs, faceID)
+		}
+		sort.Slice(faceIDs, func(i, j int) bool { return faceIDs[i] < faceIDs[j] })
+		for _, faceID := range faceIDs {
+			entry.Nexthops = append(entry.Nexthops, mgmt.NextHopRecord{FaceID: faceID, Cost: f.fib[name][faceID]})
+		}
+		block, err := entry.Encode()
+		if dataset, err = appendEncoded(dataset, block, err); err != nil {
+			return nil, err
+		}
+	}
+	return dataset, nil
+}
+
+func (f *Forwarder) statusDataset() ([]byte, error) {
+	status := mgmt.MakeGeneralStatus()
+	status.NfdVersion = "fakeforwarder"
+	status.StartTimestamp = uint64(f.startTime.UnixNano() / int64(time.Millisecond))
+	status.CurrentTimestamp = uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	status.NFibEntries = uint64(len(f.fib))
+	// GeneralStatus is encoded in a Content block, whose value is the dataset
+	block, err := status.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return block.Value(), nil
+}
+
+func (f *Forwarder) csDataset() ([]byte, error) {
+	status := &mgmt.CsStatus{
+		Capacity: uint64(f.csCapacity),
+		Flags:    mgmt.CsFlagEnableAdmit | mgmt.CsFlagEnableServe,
+	}
+	block, err := status.Encode()
+	return appendEncoded(nil, block, err)
+}
+
+func (f *Forwarder) strategyDataset() ([]byte, error) {
+	names := make([]string, 0, len(f.strategies))
+	for name := range f.strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	list := mgmt.MakeStrategyChoiceList()
+	for _, name := range names {
+		parsed, err := ndn.NameFromString(name)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, mgmt.MakeStrategyChoice(parsed, f.strategies[name]))
+	}
+	blocks, err := list.Encode()
+	if err != nil {
+		return nil, err
+	}
+	var dataset []byte
+	for _, block := range blocks {
+		if dataset, err = appendEncoded(dataset, block, nil); err != nil {
+			return nil, err
+		}
+	}
+	return dataset, nil
+}
+
+// faceDataset encodes the status of the faces matching the filter, or of all faces if it is nil.
+func (f *Forwarder) faceDataset(filter *mgmt.FaceQueryFilter) ([]byte, error) {
+	faceIDs := make([]uint64, 0, len(f.faces))
+	for faceID := range f.faces {
+		faceIDs = append(faceIDs, faceID)
+	}
+	sort.Slice(faceIDs, func(i, j int) bool { return faceIDs[i] < faceIDs[j] })
+
+	var dataset []byte
+	for _, faceID := range faceIDs {
+		face := f.faces[faceID]
+		if filter != nil && !matchesFilter(face, filter) {
+			continue
+		}
+		status := mgmt.MakeFaceStatus()
+		status.FaceID = face.FaceID
+		status.URI = face.URI
+		status.LocalURI = face.LocalURI
+		status.FaceScope = face.Scope
+		status.FacePersistency = face.Persistency
+		status.LinkType = face.LinkType
+		status.MTU = new(uint64)
+		*status.MTU = face.MTU
+		status.Flags = face.Flags
+		block, err := status.Encode()
+		if dataset, err = appendEncoded(dataset, block, err); err != nil {
+			return nil, err
+		}
+	}
+	return dataset, nil
+}
+
+func matchesFilter(face *Face, filter *mgmt.FaceQueryFilter) bool {
+	if filter.FaceID != nil && *filter.FaceID != face.FaceID {
+		return false
+	}
+	if filter.URIScheme != nil && (face.URI == nil || !strings.EqualFold(*filter.URIScheme, face.URI.Scheme())) {
+		return false
+	}
+	if filter.URI != nil && (face.URI == nil || filter.URI.String() != face.URI.String()) {
+		return false
+	}
+	if filter.LocalURI != nil && (face.LocalURI == nil || filter.LocalURI.String() != face.LocalURI.String()) {
+		return false
+	}
+	if filter.FaceScope != nil && *filter.FaceScope != face.Scope {
+		return false
+	}
+	if filter.FacePersistency != nil && *filter.FacePersistency != face.Persistency {
+		return false
+	}
+	if filter.LinkType != nil && *filter.LinkType != face.LinkType {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,218 @@
+// Package fakeforwarder provides an in-process stand-in for the forwarder. It serves the AckConn command set over a unixpacket socket, backed by an in-memory FIB, face table, CS, and strategy table, and exchanges NDNLPv2 frames with the management thread over a unix socket, as FakeTransport expects.
+package fakeforwarder
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/named-data/YaNFD/ndn"
+)
+
+// firstFaceID is the ID of the first face created, since lower IDs are reserved.
+const firstFaceID = 256
+
+// Face is a face in the face table of the fake forwarder.
+type Face struct {
+	FaceID      uint64
+	URI         *ndn.URI
+	LocalURI    *ndn.URI
+	Scope       uint64
+	Persistency uint64
+	LinkType    uint64
+	Flags       uint64
+	MTU         uint64
+	Up          bool
+}
+
+// Forwarder is a fake forwarder. All of its methods are safe for concurrent use.
+type Forwarder struct {
+	ackListener    net.Listener
+	packetListener net.Listener
+	startTime      time.Time
+
+	mutex      sync.Mutex
+	faces      map[uint64]*Face
+	nextFaceID uint64
+	fib        map[string]map[uint64]uint64 // Name -> FaceID -> Cost
+	fibNames   map[string]*ndn.Name
+	strategies map[string]*ndn.Name // Name -> Strategy
+	csCapacity int
+	// Strategies contains the versions of each available strategy
+	Strategies map[string][]uint64
+
+	ackConns   map[net.Conn]bool
+	packetConn net.Conn
+	// packetReaderDone is closed when the reader of packetConn returns
+	packetReaderDone chan struct{}
+	closed           bool
+
+	packets packetChannel
+	wg      sync.WaitGroup
+}
+
+// Start creates a fake forwarder listening for the command channel on ackSocket and for the packet channel on packetSocket. Existing files at those paths are removed.
+func Start(ackSocket string, packetSocket string) (*Forwarder, error) {
+	f := new(Forwarder)
+	f.startTime = time.Now()
+	f.faces = make(map[uint64]*Face)
+	f.nextFaceID = firstFaceID
+	f.fib = make(map[string]map[uint64]uint64)
+	f.fibNames = make(map[string]*ndn.Name)
+	f.strategies = make(map[string]*ndn.Name)
+	f.csCapacity = 65536
+	f.Strategies = map[string][]uint64{
+		"best-route": {1},
+		"multicast":  {1},
+	}
+	f.ackConns = make(map[net.Conn]bool)
+	f.packets.init()
+
+	root, _ := ndn.NameFromString("/")
+	f.strategies[root.String()], _ = ndn.NameFromString("/localhost/nfd/strategy/best-route/v=1")
+
+	os.Remove(ackSocket)
+	os.Remove(packetSocket)
+	var err error
+	f.ackListener, err = net.Listen("unixpacket", ackSocket)
+	if err != nil {
+		return nil, err
+	}
+	f.packetListener, err = net.Listen("unix", packetSocket)
+	if err != nil {
+		f.ackListener.Close()
+		return nil, err
+	}
+
+	f.wg.Add(2)
+	go f.acceptCommands()
+	go f.acceptPackets()
+	return f, nil
+}
+
+// Close stops listening and closes the connections to management.
+func (f *Forwarder) Close() error {
+	f.mutex.Lock()
+	f.closed = true
+	for conn := range f.ackConns {
+		conn.Close()
+	}
+	if f.packetConn != nil {
+		f.packetConn.Close()
+	}
+	f.mutex.Unlock()
+
+	f.ackListener.Close()
+	f.packetListener.Close()
+	f.wg.Wait()
+	f.packets.close()
+	return nil
+}
+
+// AddFace creates a face with the specified remote URI, as if it was created by the forwarder itself, and reports it to management.
+func (f *Forwarder) AddFace(uri *ndn.URI) uint64 {
+	f.mutex.Lock()
+	face := f.createFace(uri, 0)
+	event := faceEvent("facecreated", face)
+	f.mutex.Unlock()
+	f.sendEvent(event)
+	return face.FaceID
+}
+
+// RemoveFace destroys a face, as if it failed in the forwarder, and reports it to management.
+func (f *Forwarder) RemoveFace(faceID uint64) {
+	f.mutex.Lock()
+	face := f.destroyFace(faceID)
+	f.mutex.Unlock()
+	if face != nil {
+		f.sendEvent(faceEvent("facedestroyed", face))
+	}
+}
+
+// SetFaceUp changes the state of a face and reports it to management.
+func (f *Forwarder) SetFaceUp(faceID uint64, up bool) {
+	f.mutex.Lock()
+	face, ok := f.faces[faceID]
+	if !ok || face.Up == up {
+		f.mutex.Unlock()
+		return
+	}
+	face.Up = up
+	kind := "facedown"
+	if up {
+		kind = "faceup"
+	}
+	event := faceEvent(kind, face)
+	f.mutex.Unlock()
+	f.sendEvent(event)
+}
+
+// Face returns a copy of the face with the specified ID, or nil if it does not exist.
+func (f *Forwarder) Face(faceID uint64) *Face {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	face, ok := f.faces[faceID]
+	if !ok {
+		return nil
+	}
+	copied := *face
+	return &copied
+}
+
+// NextHops returns the nexthops of the FIB entry for the name, mapping FaceID to Cost.
+func (f *Forwarder) NextHops(name *ndn.Name) map[uint64]uint64 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	nexthops := make(map[uint64]uint64)
+	for faceID, cost := range f.fib[name.String()] {
+		nexthops[faceID] = cost
+	}
+	return nexthops
+}
+
+// Strategy returns the strategy set for exactly the name, or nil if there is none.
+func (f *Forwarder) Strategy(name *ndn.Name) *ndn.Name {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.strategies[name.String()]
+}
+
+// CsCapacity returns the capacity of the CS.
+func (f *Forwarder) CsCapacity() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.csCapacity
+}
+
+func (f *Forwarder) createFace(uri *ndn.URI, persistency uint64) *Face {
+	face := &Face{
+		FaceID:      f.nextFaceID,
+		URI:         uri,
+		LocalURI:    ndn.MakeNullFaceURI(),
+		Scope:       uint64(uri.Scope()),
+		Persistency: persistency,
+		MTU:         8800,
+		Up:          true,
+	}
+	f.nextFaceID++
+	f.faces[face.FaceID] = face
+	return face
+}
+
+// destroyFace removes the face and the nexthops via it. It returns the face, or nil if it did not exist.
+func (f *Forwarder) destroyFace(faceID uint64) *Face {
+	face, ok := f.faces[faceID]
+	if !ok {
+		return nil
+	}
+	delete(f.faces, faceID)
+	for name, nexthops := range f.fib {
+		delete(nexthops, faceID)
+		if len(nexthops) == 0 {
+			delete(f.fib, name)
+			delete(f.fibNames, name)
+		}
+	}
+	return face
+}
@@ -0,0 +1,222 @@
+package fakeforwarder
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/named-data/YaNFD/ndn"
+	"github.com/named-data/YaNFD/ndn/lpv2"
+	"github.com/named-data/YaNFD/ndn/tlv"
+)
+
+// notificationQueueSize is the number of unsolicited packets from management that are kept until read.
+const notificationQueueSize = 256
+
+// ErrNotConnected is returned when sending to management before it has connected to the packet socket.
+var ErrNotConnected = errors.New("management is not connected to the packet socket")
+
+// Packet is a packet sent by management that was not the reply to an expressed Interest, such as a notification.
+type Packet struct {
+	Block         *tlv.Block
+	PitToken      []byte
+	NextHopFaceID *uint64
+}
+
+// packetChannel matches packets from management to the Interests expressed to it.
+type packetChannel struct {
+	mutex         sync.Mutex
+	pending       map[uint64]chan *tlv.Block
+	nextToken     uint64
+	notifications chan Packet
+	closed        bool
+}
+
+func (p *packetChannel) init() {
+	p.pending = make(map[uint64]chan *tlv.Block)
+	p.notifications = make(chan Packet, notificationQueueSize)
+}
+
+func (p *packetChannel) close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if !p.closed {
+		p.closed = true
+		close(p.notifications)
+	}
+}
+
+func (f *Forwarder) acceptPackets() {
+	defer f.wg.Done()
+	for {
+		conn, err := f.packetListener.Accept()
+		if err != nil {
+			return
+		}
+		f.mutex.Lock()
+		if f.closed {
+			f.mutex.Unlock()
+			conn.Close()
+			return
+		}
+		if f.packetConn != nil {
+			f.packetConn.Close()
+		}
+		f.packetConn = conn
+		f.startPacketReader(conn)
+		f.mutex.Unlock()
+	}
+}
+
+// startPacketReader starts reading packets from the current packet connection. The forwarder mutex must be held.
+func (f *Forwarder) startPacketReader(conn net.Conn) {
+	done := make(chan struct{})
+	f.packetReaderDone = done
+	f.wg.Add(1)
+	go f.receivePackets(conn, done)
+}
+
+// receivePackets reads NDNLPv2 frames from management until the connection is closed or its read deadline passes, and then closes done.
+func (f *Forwarder) receivePackets(conn net.Conn, done chan struct{}) {
+	defer f.wg.Done()
+	defer close(done)
+	recvBuf := make([]byte, tlv.MaxNDNPacketSize)
+	startPos := 0
+	for {
+		readSize, err := conn.Read(recvBuf[startPos:])
+		if err != nil {
+			return
+		}
+		startPos += readSize
+
+		tlvPos := 0
+		for tlvPos < startPos {
+			_, _, tlvSize, err := tlv.DecodeTypeLength(recvBuf[tlvPos:startPos])
+			if err != nil || startPos < tlvPos+tlvSize {
+				break
+			}
+			frame := make([]byte, tlvSize)
+			copy(frame, recvBuf[tlvPos:tlvPos+tlvSize])
+			f.handleFrame(frame)
+			tlvPos += tlvSize
+		}
+		copy(recvBuf, recvBuf[tlvPos:startPos])
+		startPos -= tlvPos
+		if startPos == len(recvBuf) {
+			// A frame larger than the maximum packet size cannot be delimited
+			return
+		}
+	}
+}
+
+func (f *Forwarder) handleFrame(frame []byte) {
+	lpBlock, _, err := tlv.DecodeBlock(frame)
+	if err != nil {
+		return
+	}
+	lpPacket, err := lpv2.DecodePacket(lpBlock)
+	if err != nil || len(lpPacket.Fragment()) == 0 {
+		return
+	}
+	block, _, err := tlv.DecodeBlock(lpPacket.Fragment())
+	if err != nil {
+		return
+	}
+
+	p := &f.packets
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if token := lpPacket.PitToken(); len(token) == 8 {
+		if reply, ok := p.pending[binary.BigEndian.Uint64(token)]; ok {
+			delete(p.pending, binary.BigEndian.Uint64(token))
+			reply <- block
+			return
+		}
+	}
+	if p.closed {
+		return
+	}
+	select {
+	case p.notifications <- Packet{Block: block, PitToken: lpPacket.PitToken(), NextHopFaceID: lpPacket.NextHopFaceID()}:
+	default:
+	}
+}
+
+// Notifications returns a channel that receives the packets sent by management that do not answer an expressed Interest. Packets are dropped if more than notificationQueueSize are unread. The channel is closed when the forwarder is closed.
+func (f *Forwarder) Notifications() <-chan Packet {
+	return f.packets.notifications
+}
+
+// SendInterest sends an Interest to management as if it was received on inFace, without waiting for a reply.
+func (f *Forwarder) SendInterest(interest *ndn.Interest, inFace uint64) error {
+	return f.send(interest, nil, inFace)
+}
+
+// ExpressInterest sends an Interest to management as if it was received on inFace and waits until management answers it with a Data packet or the context ends.
+func (f *Forwarder) ExpressInterest(ctx context.Context, interest *ndn.Interest, inFace uint64) (*ndn.Data, error) {
+	reply := make(chan *tlv.Block, 1)
+	p := &f.packets
+	p.mutex.Lock()
+	p.nextToken++
+	token := p.nextToken
+	p.pending[token] = reply
+	p.mutex.Unlock()
+	forget := func() {
+		p.mutex.Lock()
+		delete(p.pending, token)
+		p.mutex.Unlock()
+	}
+
+	pitToken := make([]byte, 8)
+	binary.BigEndian.PutUint64(pitToken, token)
+	if err := f.send(interest, pitToken, inFace); err != nil {
+		forget()
+		return nil, err
+	}
+
+	select {
+	case block := <-reply:
+		if block.Type() != tlv.Data {
+			return nil, errors.New("management did not answer with a Data packet")
+		}
+		return ndn.DecodeData(block, false)
+	case <-ctx.Done():
+		forget()
+		return nil, ctx.Err()
+	}
+}
+
+// send wraps a packet in an LpPacket carrying the IncomingFaceId, which management requires on every packet.
+func (f *Forwarder) send(interest *ndn.Interest, pitToken []byte, inFace uint64) error {
+	block, err := interest.Encode()
+	if err != nil {
+		return err
+	}
+	netWire, err := block.Wire()
+	if err != nil {
+		return err
+	}
+	lpPacket := lpv2.NewPacket(netWire)
+	if len(pitToken) > 0 {
+		lpPacket.SetPitToken(pitToken)
+	}
+	lpPacket.SetIncomingFaceID(inFace)
+	lpPacketWire, err := lpPacket.Encode()
+	if err != nil {
+		return err
+	}
+	frame, err := lpPacketWire.Wire()
+	if err != nil {
+		return err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.packetConn == nil {
+		return ErrNotConnected
+	}
+	_, err = f.packetConn.Write(frame)
+	return err
+}
@@ -0,0 +1,86 @@
+package fakeforwarder
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/amazingtapioca17/mgmt/mgmtconn"
+	"github.com/amazingtapioca17/mgmt/shm"
+)
+
+// packetConnTimeout is how long attaching a segment to the packet channel waits for management to connect to the packet socket.
+const packetConnTimeout = time.Second
+
+// attachSegment answers a sharedmemory command received on conn, and returns the connection to read further commands from. That is a connection over the segment if management attached one to the command channel. An error is only returned if the reply cannot be sent.
+func (f *Forwarder) attachSegment(conn net.Conn, command *mgmtconn.Message, encoding string) (net.Conn, error) {
+	var segment *shm.Segment
+	var err error
+	switch command.Channel {
+	case mgmtconn.ChannelCommands:
+		segment, err = shm.Open(command.Segment)
+	case mgmtconn.ChannelPackets:
+		err = f.attachPacketSegment(command.Segment)
+	default:
+		err = errors.New("unknown channel '" + command.Channel + "'")
+	}
+	reply := mgmtconn.Message{}
+	if err != nil {
+		reply = errorReply(400, err.Error())
+	}
+	reply.RequestID = command.RequestID
+	wire, err := mgmtconn.EncodeMessage(&reply, encoding)
+	if err != nil {
+		if segment != nil {
+			segment.Close()
+		}
+		return conn, err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if segment == nil {
+		_, err = conn.Write(wire)
+		return conn, err
+	}
+	// Events are sent over the segment from now on, since management stops reading the socket once it has the reply
+	shmConn := segment.Conn(conn)
+	delete(f.ackConns, conn)
+	f.ackConns[shmConn] = true
+	_, err = conn.Write(wire)
+	return shmConn, err
+}
+
+// attachPacketSegment switches the packet channel to the segment at the path.
+func (f *Forwarder) attachPacketSegment(path string) error {
+	segment, err := shm.Open(path)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(packetConnTimeout)
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for f.packetConn == nil {
+		// Management may attach the segment before its connection to the packet socket has been accepted
+		if f.closed || time.Now().After(deadline) {
+			segment.Close()
+			return ErrNotConnected
+		}
+		f.mutex.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		f.mutex.Lock()
+	}
+	if _, ok := f.packetConn.(*shm.Conn); ok {
+		segment.Close()
+		return errors.New("packet channel already uses shared memory")
+	}
+
+	// The socket reader is stopped, as it would otherwise take the doorbells meant for the segment
+	socket := f.packetConn
+	socket.SetReadDeadline(time.Now())
+	<-f.packetReaderDone
+	socket.SetReadDeadline(time.Time{})
+	f.packetConn = segment.Conn(socket)
+	f.startPacketReader(f.packetConn)
+	return nil
+}
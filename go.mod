@@ -2,18 +2,20 @@ module github.com/amazingtapioca17/mgmt
 
 go 1.19
 
-require github.com/named-data/YaNFD v1.2.0
+require (
+	github.com/apex/log v1.9.0
+	github.com/named-data/YaNFD v1.2.0
+	github.com/pelletier/go-toml v1.9.4
+	golang.org/x/sys v0.0.0-20220406163625-3f8b81556e12
+)
 
 require (
-	github.com/apex/log v1.9.0 // indirect
 	github.com/cespare/xxhash v1.1.0 // indirect
 	github.com/cornelk/hashmap v1.0.1 // indirect
 	github.com/dchest/siphash v1.2.3 // indirect
 	github.com/google/gopacket v1.1.19 // indirect
 	github.com/gorilla/websocket v1.5.0 // indirect
-	github.com/pelletier/go-toml v1.9.4 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/zjkmxy/stealthpool v0.2.2 // indirect
 	golang.org/x/exp v0.0.0-20220414153411-bcd21879b8fd // indirect
-	golang.org/x/sys v0.0.0-20220406163625-3f8b81556e12 // indirect
 )
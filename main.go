@@ -1,12 +1,21 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/amazingtapioca17/mgmt/mgmtconn"
 	"github.com/amazingtapioca17/mgmt/modules"
+	"github.com/amazingtapioca17/mgmt/peercred"
 
 	customrib "github.com/amazingtapioca17/mgmt/table"
+	"github.com/named-data/YaNFD/core"
 	"github.com/named-data/YaNFD/ndn"
 	"github.com/named-data/YaNFD/ndn/lpv2"
 	"github.com/named-data/YaNFD/ndn/mgmt"
@@ -16,25 +25,176 @@ import (
 var partialMessageStore map[uint64][][]byte
 
 func main() {
+	// Parse command line options
+	var configFileName string
+	flag.StringVar(&configFileName, "config", defaultConfigFile, "Configuration file location")
+	var ackSocket string
+	flag.StringVar(&ackSocket, "ack-socket", "", "Forwarder command socket (overrides mgmt.ack_socket)")
+	var forwarderSocket string
+	flag.StringVar(&forwarderSocket, "forwarder-socket", "", "Forwarder packet socket (overrides mgmt.forwarder_socket)")
+	var localPrefix string
+	flag.StringVar(&localPrefix, "local-prefix", "", "Local management prefix (overrides mgmt.local_prefix)")
+	var localhopPrefix string
+	flag.StringVar(&localhopPrefix, "localhop-prefix", "", "Localhop management prefix (overrides mgmt.localhop_prefix)")
+	var allowLocalhop bool
+	flag.BoolVar(&allowLocalhop, "allow-localhop", false, "Accept localhop management commands (overrides mgmt.allow_localhop)")
+	var logLevel string
+	flag.StringVar(&logLevel, "log-level", "", "Logging level (overrides core.log_level)")
+	var disabledModules string
+	flag.StringVar(&disabledModules, "disable-modules", "", "Comma-separated list of management modules to disable (overrides mgmt.disabled_modules)")
+	flag.Parse()
+
+	// Only flags given on the command line override the configuration file
+	overrides := make(map[string]interface{})
+	configFileSet := false
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "config":
+			configFileSet = true
+		case "ack-socket":
+			overrides["mgmt.ack_socket"] = ackSocket
+		case "forwarder-socket":
+			overrides["mgmt.forwarder_socket"] = forwarderSocket
+		case "local-prefix":
+			overrides["mgmt.local_prefix"] = localPrefix
+		case "localhop-prefix":
+			overrides["mgmt.localhop_prefix"] = localhopPrefix
+		case "allow-localhop":
+			overrides["mgmt.allow_localhop"] = allowLocalhop
+		case "log-level":
+			overrides["core.log_level"] = logLevel
+		case "disable-modules":
+			names := make([]string, 0)
+			for _, name := range strings.Split(disabledModules, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					names = append(names, name)
+				}
+			}
+			overrides["mgmt.disabled_modules"] = names
+		}
+	})
+
+	if err := loadConfig(configFileName, configFileSet, overrides); err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid configuration:", err)
+		os.Exit(2)
+	}
+	core.InitializeLogger("")
+	if err := modules.Configure(); err != nil {
+		core.LogFatal("Main", "Invalid configuration: ", err)
+	}
+
 	//go mgmtConn()
 	// mgmtconn.Conn.Port = ":1080"
 	// mgmtconn.Conn.Socket = "/tmp/fib.sock"
-	go input1()
-	mgmtconn.AcksConn.MakeMgmtConn("/tmp/ackmgmt.sock")
 	mgmtconn.AcksConn.Table = &customrib.Rib
+	mgmtconn.AcksConn.Timeout = time.Duration(core.GetConfigIntDefault("mgmt.forwarder_timeout", 4000)) * time.Millisecond
+	mgmtconn.AcksConn.SharedMemorySize = core.GetConfigIntDefault("mgmt.shared_memory_size", 0)
+	// The allowlist has been validated by modules.Configure
+	mgmtconn.AcksConn.Peers, _ = peercred.ParseAllowlist(core.GetConfigArrayString("mgmt.forwarder_peers"))
+	if err := mgmtconn.AcksConn.MakeMgmtConn(core.GetConfigStringDefault("mgmt.ack_socket", "/tmp/ackmgmt.sock"), core.GetConfigStringDefault("mgmt.ack_encoding", "json")); err != nil {
+		core.LogFatal("Main", "Unable to connect to forwarder: ", err)
+	}
+	// The RIB must see every destroyed face, or routes via it would never be removed
+	ribEvents, _ := mgmtconn.AcksConn.SubscribeUnbounded(mgmtconn.EventFaceDestroyed, mgmtconn.EventFaceUp)
+	go customrib.Rib.HandleEvents(ribEvents, mgmtconn.AcksConn.Timeout)
 	go mgmtconn.AcksConn.RunReceive()
+	restoreRib()
 
 	manager := modules.MakeMgmtThread()
-	manager.Run()
+	done := make(chan struct{})
+	go func() {
+		manager.Run()
+		close(done)
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP, syscall.SIGUSR1)
+	for {
+		select {
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				reload(configFileName, configFileSet, overrides, manager)
+				continue
+			}
+			if sig == syscall.SIGUSR1 {
+				logDispatchStats(manager)
+				continue
+			}
+			core.LogInfo("Main", "Received signal ", sig, " - shutting down")
+		case <-done:
+			core.LogInfo("Main", "Management thread quit - shutting down")
+		}
+		break
+	}
+	shutdown(manager, done)
+}
+
+// restoreRib restores the RIB from the configured journal, which then records the changes to the RIB until shutdown. The restored routes are pushed to the FIB once the forwarder can be reached.
+func restoreRib() {
+	path := core.GetConfigStringDefault("mgmt.rib_journal", "")
+	if path == "" {
+		return
+	}
+	compactionInterval := time.Duration(core.GetConfigIntDefault("mgmt.rib_journal_compaction_interval", 3600)) * time.Second
+	journal, err := customrib.OpenJournal(path, compactionInterval)
+	if err != nil {
+		core.LogError("Main", "Unable to open RIB journal ", path, ", so routes will not persist: ", err)
+		return
+	}
+	if err := customrib.Rib.Restore(journal); err != nil {
+		core.LogError("Main", "Unable to restore RIB from journal ", path, ", so routes will not persist: ", err)
+	}
+}
 
+// reload reloads the configuration file, keeping the previous configuration if the new one is invalid.
+func reload(configFileName string, configFileSet bool, overrides map[string]interface{}, manager *modules.Thread) {
+	core.LogInfo("Main", "Reloading configuration from ", configFileName)
+	if err := loadConfig(configFileName, configFileSet, overrides); err != nil {
+		core.LogError("Main", "Unable to reload configuration: ", err)
+		return
+	}
+	core.InitializeLogger("")
+	if err := modules.Configure(); err != nil {
+		core.LogError("Main", "Unable to reload configuration: ", err)
+		return
+	}
+	if err := manager.Reload(); err != nil {
+		core.LogError("Main", "Unable to reload configuration: ", err)
+	}
 }
 
-func input1() {
-	var i string
-	fmt.Scan(&i)
-	//test, _ := ndn.NameFromString("/ppp/poem")
-	//mgmtconn.AcksConn.RemoveNextHop(test, 4)
-	fmt.Println(mgmtconn.AcksConn.ForwarderStatus())
+// logDispatchStats logs the queue metrics of the management dispatcher, to find modules whose handlers cannot keep up.
+func logDispatchStats(manager *modules.Thread) {
+	stats := manager.DispatchStats()
+	names := make([]string, 0, len(stats.QueueDepths))
+	for name := range stats.QueueDepths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	depths := make([]string, 0, len(names))
+	for _, name := range names {
+		depths = append(depths, fmt.Sprint(name, "=", stats.QueueDepths[name]))
+	}
+	core.LogInfo("Main", "Dispatched ", stats.Dispatched, " Interests, dropped ", stats.Dropped, ", Workers=", stats.Workers, ", QueueDepths=[", strings.Join(depths, " "), "]")
+}
+
+// shutdown stops accepting management Interests and lets the commands in progress finish within the shutdown timeout, after which the commands still waiting on the forwarder fail. Both forwarder sockets are then closed.
+func shutdown(manager *modules.Thread, done chan struct{}) {
+	timeout := time.Duration(core.GetConfigIntDefault("mgmt.shutdown_timeout", 5000)) * time.Millisecond
+	manager.Stop()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		core.LogWarn("Main", "Commands still in progress after ", timeout, " - abandoning them")
+	}
+	logDispatchStats(manager)
+	mgmtconn.AcksConn.Close()
+	<-done
+	if err := customrib.Rib.CloseJournal(); err != nil {
+		core.LogError("Main", "Unable to flush RIB journal: ", err)
+	}
+	core.LogInfo("Main", "Shut down")
+	core.ShutdownLogger()
 }
 
 func reassemble(frame *lpv2.Packet, baseSequence uint64, fragIndex uint64, fragCount uint64) []byte {
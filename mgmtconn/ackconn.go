@@ -1,10 +1,15 @@
 package mgmtconn
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"net"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/amazingtapioca17/mgmt/peercred"
 	"github.com/amazingtapioca17/mgmt/ribinterface"
 	"github.com/named-data/YaNFD/ndn"
 	"github.com/named-data/YaNFD/ndn/mgmt"
@@ -15,9 +20,29 @@ type AckConn struct {
 	socket string
 	unix   net.Conn
 	Table  ribinterface.RibInt
-	queue  chan chan Message
+	// codec encodes the commands sent to the forwarder
+	codec messageCodec
+	// Timeout bounds the commands sent while resynchronizing the forwarder state
+	Timeout time.Duration
+	// Peers are the processes allowed on the other end of the socket
+	Peers *peercred.Allowlist
+	// SharedMemorySize is the size of each ring of the shared memory segment offered to the forwarder for commands, or 0 to only use the socket
+	SharedMemorySize int
+	sendMu           sync.Mutex
+	closed           bool
+	// capabilities are learned from the forwarder when connecting
+	capabilities capabilityStore
+	// events delivers forwarder events to subscribers
+	events eventBus
+	// state is the configuration pushed to the forwarder, which is replayed after reconnecting
+	state forwarderState
+	// pending maps request IDs to the channels waiting for their replies
+	pending       map[uint64]chan Message
+	pendingMu     sync.Mutex
+	nextRequestID uint64
 }
 type Message struct {
+	RequestID       uint64                 `json:"requestid"`
 	Command         string                 `json:"command"`
 	Name            string                 `json:"name"`
 	ParamName       string                 `json:"paramname"`
@@ -34,218 +59,497 @@ type Message struct {
 	ErrorMessage    string                 `json:"errormessage"`
 	ParamsValid     bool                   `json:"paramsvalid"`
 	FaceQueryFilter mgmt.FaceQueryFilter   `json:"facequeryfilter"`
+	ProtocolVersion uint64                 `json:"protocolversion"`
+	Commands        []string               `json:"commands"`
+	BuildInfo       string                 `json:"buildinfo"`
+	NextHops        []NextHop              `json:"nexthops"`
+	Event           string                 `json:"event"`
+	URI             string                 `json:"uri"`
+	LocalURI        string                 `json:"localuri"`
+	FaceScope       uint64                 `json:"facescope"`
+	FacePersistency uint64                 `json:"facepersistency"`
+	LinkType        uint64                 `json:"linktype"`
+	Flags           uint64                 `json:"flags"`
+	Channel         string                 `json:"channel"`
+	Segment         string                 `json:"segment"`
 }
 
 var AcksConn AckConn
 
+// Bounds of the delay between attempts to reconnect to the forwarder.
+const (
+	minReconnectDelay = 100 * time.Millisecond
+	maxReconnectDelay = 10 * time.Second
+)
+
+// RunReceive reads replies and events from the forwarder until the connection is closed. If the forwarder goes away, it reconnects and resynchronizes the forwarder state.
 func (a *AckConn) RunReceive() {
+	if a.conn() != nil {
+		go a.handshake()
+	}
 	for {
-		message := make([]byte, 8800)
-		readSize, err := a.unix.Read(message)
-		message = message[:readSize]
+		conn := a.conn()
+		if conn == nil {
+			if !a.reconnect() {
+				return
+			}
+			continue
+		}
+		message, err := readMessage(conn)
+		if err == errMessageTooLarge {
+			fmt.Println("Dropping message from forwarder larger than", maxMessageSize, "bytes")
+			continue
+		}
 		if err != nil {
-			fmt.Println(err)
+			if a.isClosed() {
+				return
+			}
+			fmt.Println("Lost connection to forwarder:", err)
+			a.disconnect(conn)
+			continue
+		}
+		msg, err := a.ParseResponse(message)
+		if err != nil {
+			fmt.Println("Dropping undecodable message from forwarder:", err)
+			continue
 		}
-		msg := a.ParseResponse(message)
 		if msg.Command == "" {
-			// empty command means it is a response
-			// meaningful command means it is clean up face, and we need to continue to preserve ordered messages
-			// does not work if it is not in a new goroutine, probably because a.Table.CleanupFace calls other send messages, would
-			newRequest := <-a.queue
-			newRequest <- msg
+			// empty command means it is a response, which is matched to its request by ID since replies may arrive in any order
+			a.pendingMu.Lock()
+			response, ok := a.pending[msg.RequestID]
+			delete(a.pending, msg.RequestID)
+			a.pendingMu.Unlock()
+			if !ok {
+				fmt.Println("Dropping reply to unknown request", msg.RequestID)
+				continue
+			}
+			response <- msg
 		} else {
-			go a.Table.CleanUpFace(msg.FaceID)
+			// meaningful command means it is an event
+			a.handleEvent(&msg)
 		}
 	}
 }
 
-func (a *AckConn) MakeMgmtConn(socket string) {
+// messageReader is implemented by connections that can read messages of any size, such as shared memory connections.
+type messageReader interface {
+	ReadMessage() ([]byte, error)
+}
+
+// maxMessageSize is the size of the largest message that can be received on the socket. Datasets such as large face lists are sent in a single message, so it is well above the MTU.
+const maxMessageSize = 65536
+
+// errMessageTooLarge is returned for a message on the socket that was larger than maxMessageSize, and so was truncated.
+var errMessageTooLarge = errors.New("message too large")
+
+// readMessage reads a message from the forwarder. Messages on the socket are limited to maxMessageSize.
+func readMessage(conn net.Conn) ([]byte, error) {
+	if reader, ok := conn.(messageReader); ok {
+		return reader.ReadMessage()
+	}
+	message := make([]byte, maxMessageSize)
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		readSize, err := conn.Read(message)
+		return message[:readSize], err
+	}
+	readSize, _, flags, _, err := unixConn.ReadMsgUnix(message, nil)
+	if err != nil {
+		return nil, err
+	}
+	if flags&syscall.MSG_TRUNC != 0 {
+		return nil, errMessageTooLarge
+	}
+	return message[:readSize], nil
+}
+
+// MakeMgmtConn connects to the forwarder, sending commands in the specified encoding, either "json" or "tlv". Replies are accepted in either encoding. If the forwarder is not running yet, RunReceive keeps trying to connect, but a peer that is not allowed by Peers is an error.
+func (a *AckConn) MakeMgmtConn(socket string, encoding string) error {
+	codec, err := makeCodec(encoding)
+	if err != nil {
+		return err
+	}
+	a.codec = codec
 	a.socket = socket
-	var err error
+	a.pending = make(map[uint64]chan Message)
+	if a.Timeout == 0 {
+		a.Timeout = 4 * time.Second
+	}
 	a.unix, err = net.Dial("unixpacket", a.socket)
 	fmt.Println("ack connected")
 	if err != nil {
 		fmt.Println("Error dialing socket:", err)
+		return nil
+	}
+	if err := a.Peers.Check(a.unix); err != nil {
+		a.unix.Close()
+		a.unix = nil
+		return fmt.Errorf("refusing forwarder on %s: %w", a.socket, err)
+	}
+	a.unix = a.attachSharedMemory(a.unix)
+	a.capabilities.reset()
+	return nil
+}
+
+// Close stops accepting commands, fails the commands still waiting for a reply with ErrClosed, and closes the socket.
+func (a *AckConn) Close() {
+	a.sendMu.Lock()
+	if a.closed {
+		a.sendMu.Unlock()
+		return
 	}
-	a.queue = make(chan chan Message)
+	a.closed = true
+	conn := a.unix
+	a.unix = nil
+	a.sendMu.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+	a.failPending()
+	a.events.close()
 }
+
+// failPending fails the commands waiting for a reply, which will not arrive since the connection is gone.
+func (a *AckConn) failPending() {
+	a.pendingMu.Lock()
+	defer a.pendingMu.Unlock()
+	for requestID, response := range a.pending {
+		close(response)
+		delete(a.pending, requestID)
+	}
+}
+
+func (a *AckConn) conn() net.Conn {
+	a.sendMu.Lock()
+	defer a.sendMu.Unlock()
+	return a.unix
+}
+
+// disconnect drops a connection that has failed. Commands fail with ErrDisconnected until reconnect succeeds.
+func (a *AckConn) disconnect(conn net.Conn) {
+	a.sendMu.Lock()
+	if a.unix == conn {
+		a.unix = nil
+	}
+	a.sendMu.Unlock()
+	conn.Close()
+	a.failPending()
+	a.capabilities.set(Capabilities{})
+}
+
+// reconnect dials the forwarder with exponential backoff until it succeeds, after which the forwarder state is resynchronized. A peer that is not allowed by Peers is hung up on and counts as a failed attempt. It returns false if the connection is closed in the meantime.
+func (a *AckConn) reconnect() bool {
+	delay := minReconnectDelay
+	for {
+		if a.isClosed() {
+			return false
+		}
+		conn, err := net.Dial("unixpacket", a.socket)
+		if err == nil {
+			if err = a.Peers.Check(conn); err != nil {
+				conn.Close()
+				err = fmt.Errorf("refusing forwarder: %w", err)
+			}
+		}
+		if err == nil {
+			conn = a.attachSharedMemory(conn)
+			a.sendMu.Lock()
+			if a.closed {
+				a.sendMu.Unlock()
+				conn.Close()
+				return false
+			}
+			a.capabilities.reset()
+			a.unix = conn
+			a.sendMu.Unlock()
+			fmt.Println("ack reconnected")
+			go func() {
+				a.handshake()
+				a.resync()
+			}()
+			return true
+		}
+		fmt.Println("Unable to reconnect to forwarder, retrying in", delay, ":", err)
+		time.Sleep(delay)
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// resync replays the CS capacity, strategy choices, and RIB-derived nexthops into a forwarder that has been reconnected to, since it may have restarted without them.
+func (a *AckConn) resync() {
+	capacity, strategies := a.state.snapshot()
+	if capacity != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), a.Timeout)
+		err := a.SetCapacity(ctx, *capacity)
+		cancel()
+		if err != nil {
+			fmt.Println("Unable to resynchronize CS capacity:", err)
+			return
+		}
+	}
+	for _, choice := range strategies {
+		ctx, cancel := context.WithTimeout(context.Background(), a.Timeout)
+		err := a.SetStrategy(ctx, choice.name, choice.strategy)
+		cancel()
+		if err != nil {
+			fmt.Println("Unable to resynchronize strategy choice for", choice.name, ":", err)
+			return
+		}
+	}
+	if a.Table != nil {
+		err := a.Table.Resync(context.Background())
+		if err != nil {
+			fmt.Println("Unable to resynchronize RIB nexthops:", err)
+			return
+		}
+	}
+	fmt.Println("Resynchronized forwarder state")
+}
+
+func (a *AckConn) isClosed() bool {
+	a.sendMu.Lock()
+	defer a.sendMu.Unlock()
+	return a.closed
+}
+
 func (a *AckConn) Conn() net.Conn {
 	return a.unix
 }
 
-func (a *AckConn) GetAllFIBEntries() []byte {
+func (a *AckConn) GetAllFIBEntries(ctx context.Context) ([]byte, error) {
 	command := Message{
 		Command: "list",
 	}
-	msg := a.SendCommand(command)
-	return msg.Dataset
+	msg, err := a.SendCommand(ctx, command)
+	return msg.Dataset, err
 }
-func (a *AckConn) ForwarderStatus() []byte {
+func (a *AckConn) ForwarderStatus(ctx context.Context) ([]byte, error) {
 	command := Message{
 		Command: "forwarderstatus",
 	}
-	msg := a.SendCommand(command)
-	return msg.Dataset
+	msg, err := a.SendCommand(ctx, command)
+	return msg.Dataset, err
 }
 
-func (a *AckConn) Channels() []byte {
+func (a *AckConn) Channels(ctx context.Context) ([]byte, error) {
 	command := Message{
 		Command: "channels",
 	}
-	msg := a.SendCommand(command)
-	return msg.Dataset
+	msg, err := a.SendCommand(ctx, command)
+	return msg.Dataset, err
 }
 
-func (a *AckConn) ListFace() []byte {
+func (a *AckConn) ListFace(ctx context.Context) ([]byte, error) {
 	command := Message{
 		Command: "listface",
 	}
-	msg := a.SendCommand(command)
-	return msg.Dataset
+	msg, err := a.SendCommand(ctx, command)
+	return msg.Dataset, err
 }
-func (a *AckConn) CreateFace(params mgmt.ControlParameters) mgmt.ControlResponse {
+func (a *AckConn) CreateFace(ctx context.Context, params mgmt.ControlParameters) (mgmt.ControlResponse, error) {
 	command := Message{
 		Command:       "createface",
 		ControlParams: params,
 	}
-	msg := a.SendCommand(command)
-	return msg.ControlResponse
+	msg, err := a.SendCommand(ctx, command)
+	return msg.ControlResponse, err
 }
-func (a *AckConn) UpdateFace(params mgmt.ControlParameters, faceID uint64) mgmt.ControlResponse {
+func (a *AckConn) UpdateFace(ctx context.Context, params mgmt.ControlParameters, faceID uint64) (mgmt.ControlResponse, error) {
 	command := Message{
 		Command:       "updateface",
 		ControlParams: params,
 		FaceID:        faceID,
 	}
-	msg := a.SendCommand(command)
-	return msg.ControlResponse
+	msg, err := a.SendCommand(ctx, command)
+	return msg.ControlResponse, err
 }
-func (a *AckConn) DestroyFace(faceID uint64) bool {
+func (a *AckConn) DestroyFace(ctx context.Context, faceID uint64) (bool, error) {
 	command := Message{
 		Command: "destroyface",
 		FaceID:  faceID,
 	}
-	msg := a.SendCommand(command)
-	return msg.Valid
+	msg, err := a.SendCommand(ctx, command)
+	return msg.Valid, err
 }
 
-func (a *AckConn) Query(filter mgmt.FaceQueryFilter) []byte {
+func (a *AckConn) Query(ctx context.Context, filter mgmt.FaceQueryFilter) ([]byte, error) {
 	command := Message{
 		Command:         "query",
 		FaceQueryFilter: filter,
 	}
-	msg := a.SendCommand(command)
-	return msg.Dataset
+	msg, err := a.SendCommand(ctx, command)
+	return msg.Dataset, err
 }
 
-func (a *AckConn) CsInfo() []byte {
+func (a *AckConn) CsInfo(ctx context.Context) ([]byte, error) {
 	command := Message{
 		Command: "info",
 	}
-	msg := a.SendCommand(command)
-	return msg.Dataset
+	msg, err := a.SendCommand(ctx, command)
+	return msg.Dataset, err
 }
 
-func (a *AckConn) Versions(strategy string) ([]uint64, bool) {
+func (a *AckConn) Versions(ctx context.Context, strategy string) ([]uint64, bool, error) {
 	command := Message{
 		Command:  "versions",
 		Strategy: strategy,
 	}
-	msg := a.SendCommand(command)
-	return msg.Versions, msg.Valid
+	msg, err := a.SendCommand(ctx, command)
+	return msg.Versions, msg.Valid, err
 }
 
-func (a *AckConn) ListStrategy() []byte {
+func (a *AckConn) ListStrategy(ctx context.Context) ([]byte, error) {
 	command := Message{
 		Command: "liststrategy",
 	}
-	msg := a.SendCommand(command)
-	return msg.Dataset
+	msg, err := a.SendCommand(ctx, command)
+	return msg.Dataset, err
 }
 
-func (a *AckConn) GetFaceId(faceID uint64) bool {
+func (a *AckConn) GetFaceId(ctx context.Context, faceID uint64) (bool, error) {
 	command := Message{
 		Command: "faceid",
 		FaceID:  faceID,
 	}
-	msg := a.SendCommand(command)
-	return msg.Valid
+	msg, err := a.SendCommand(ctx, command)
+	return msg.Valid, err
 }
 
-func (a *AckConn) ParseResponse(received []byte) Message {
-	var msg Message
-	err := json.Unmarshal(received, &msg)
-	if err != nil {
-		fmt.Println("error:", err)
-	}
-	return msg
+func (a *AckConn) ParseResponse(received []byte) (Message, error) {
+	return DecodeMessage(received)
 }
 
-func (a *AckConn) ClearNextHops(name *ndn.Name) {
+func (a *AckConn) ClearNextHops(ctx context.Context, name *ndn.Name) error {
 	msg := Message{
 		Command: "clear",
 		Name:    name.String(),
 	}
-	a.SendCommand(msg)
+	_, err := a.SendCommand(ctx, msg)
+	return err
 }
 
-func (a *AckConn) RemoveNextHop(name *ndn.Name, faceID uint64) {
+func (a *AckConn) RemoveNextHop(ctx context.Context, name *ndn.Name, faceID uint64) error {
 	msg := Message{
 		Command: "remove",
 		Name:    name.String(),
 		FaceID:  faceID,
 	}
-	a.SendCommand(msg)
+	_, err := a.SendCommand(ctx, msg)
+	return err
 }
 
-func (a *AckConn) InsertNextHop(name *ndn.Name, faceID uint64, cost uint64) {
+func (a *AckConn) InsertNextHop(ctx context.Context, name *ndn.Name, faceID uint64, cost uint64) error {
 	msg := Message{
 		Command: "insert",
 		Name:    name.String(),
 		FaceID:  faceID,
 		Cost:    cost,
 	}
-	a.SendCommand(msg)
-
+	_, err := a.SendCommand(ctx, msg)
+	return err
 }
 
-func (a *AckConn) SetStrategy(paramName *ndn.Name, strategy *ndn.Name) {
+func (a *AckConn) SetStrategy(ctx context.Context, paramName *ndn.Name, strategy *ndn.Name) error {
 	msg := Message{
 		Command:   "setstrategy",
 		ParamName: paramName.String(),
 		Strategy:  strategy.String(),
 	}
-	a.SendCommand(msg)
-
+	_, err := a.SendCommand(ctx, msg)
+	if err == nil {
+		a.state.setStrategy(paramName, strategy)
+	}
+	return err
 }
 
-func (a *AckConn) UnsetStrategy(paramName *ndn.Name) {
+func (a *AckConn) UnsetStrategy(ctx context.Context, paramName *ndn.Name) error {
 	msg := Message{
 		Command:   "unsetstrategy",
 		ParamName: paramName.String(),
 	}
-	a.SendCommand(msg)
+	_, err := a.SendCommand(ctx, msg)
+	if err == nil {
+		a.state.unsetStrategy(paramName)
+	}
+	return err
 }
-func (a *AckConn) SetCapacity(cap int) {
+func (a *AckConn) SetCapacity(ctx context.Context, cap int) error {
 	msg := Message{
 		Command:  "set",
 		Capacity: cap,
 	}
-	a.SendCommand(msg)
-
+	_, err := a.SendCommand(ctx, msg)
+	if err == nil {
+		a.state.setCapacity(cap)
+	}
+	return err
 }
 
-func (a *AckConn) SendCommand(command Message) Message {
-	b, err := json.Marshal(command)
+// SendCommand sends a command to the forwarder and waits for its reply until the context ends. Replies carrying an ErrorCode are returned as a *ForwarderError, and commands the forwarder does not support fail with an *UnsupportedError without being sent.
+func (a *AckConn) SendCommand(ctx context.Context, command Message) (Message, error) {
+	if command.Command != "hello" {
+		if err := a.capabilities.wait(ctx); err != nil {
+			return Message{}, &TimeoutError{Command: command.Command, Err: err}
+		}
+		if !a.Supports(command.Command) {
+			return Message{}, &UnsupportedError{Command: command.Command}
+		}
+	}
+	// Commands may be sent from several management workers at once, so each carries an ID that its reply is matched by
+	response := make(chan Message, 1)
+	a.pendingMu.Lock()
+	a.nextRequestID++
+	command.RequestID = a.nextRequestID
+	a.pending[command.RequestID] = response
+	a.pendingMu.Unlock()
+
+	b, err := a.codec.encode(&command)
 	if err != nil {
-		fmt.Println("error:", err)
+		a.forget(command.RequestID)
+		return Message{}, &EncodingError{Command: command.Command, Err: err}
+	}
+	a.sendMu.Lock()
+	if a.closed {
+		a.sendMu.Unlock()
+		a.forget(command.RequestID)
+		return Message{}, ErrClosed
+	}
+	if a.unix == nil {
+		a.sendMu.Unlock()
+		a.forget(command.RequestID)
+		return Message{}, ErrDisconnected
 	}
 	_, err = a.unix.Write(b)
+	a.sendMu.Unlock()
 	if err != nil {
-		fmt.Println("Write data failed:", err.Error())
+		a.forget(command.RequestID)
+		return Message{}, fmt.Errorf("%w: %v", ErrDisconnected, err)
 	}
-	response := make(chan Message)
-	a.queue <- response
-	received := <-response
-	return received
+
+	select {
+	case received, ok := <-response:
+		if !ok {
+			if a.isClosed() {
+				return Message{}, ErrClosed
+			}
+			return Message{}, ErrDisconnected
+		}
+		if received.ErrorCode != 0 {
+			return received, &ForwarderError{Command: command.Command, Code: received.ErrorCode, Message: received.ErrorMessage}
+		}
+		return received, nil
+	case <-ctx.Done():
+		a.forget(command.RequestID)
+		return Message{}, &TimeoutError{Command: command.Command, Err: ctx.Err()}
+	}
+}
+
+// forget removes a request that will not receive a reply.
+func (a *AckConn) forget(requestID uint64) {
+	a.pendingMu.Lock()
+	delete(a.pending, requestID)
+	a.pendingMu.Unlock()
 }
@@ -0,0 +1,69 @@
+package mgmtconn_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/amazingtapioca17/mgmt/fakeforwarder"
+	"github.com/amazingtapioca17/mgmt/mgmtconn"
+	"github.com/named-data/YaNFD/ndn"
+	"github.com/named-data/YaNFD/ndn/tlv"
+)
+
+// connect starts a fake forwarder with the faces and returns a connection to it sending commands in the encoding. Both are closed when the test ends.
+func connect(t *testing.T, encoding string, faces int) *mgmtconn.AckConn {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "ackconn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	ackSocket := filepath.Join(dir, "ack.sock")
+	forwarder, err := fakeforwarder.Start(ackSocket, filepath.Join(dir, "packet.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { forwarder.Close() })
+	for i := 0; i < faces; i++ {
+		forwarder.AddFace(ndn.MakeUDPFaceURI(4, fmt.Sprintf("198.51.%d.%d", i/256, i%256), 6363))
+	}
+
+	conn := new(mgmtconn.AckConn)
+	if err := conn.MakeMgmtConn(ackSocket, encoding); err != nil {
+		t.Fatal(err)
+	}
+	go conn.RunReceive()
+	t.Cleanup(conn.Close)
+	return conn
+}
+
+func TestListManyFaces(t *testing.T) {
+	const faces = 400
+	for _, encoding := range []string{"json", "tlv"} {
+		conn := connect(t, encoding, faces)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		dataset, err := conn.ListFace(ctx)
+		cancel()
+		if err != nil {
+			t.Fatalf("%s: unable to list faces: %v", encoding, err)
+		}
+		count := 0
+		for len(dataset) > 0 {
+			block, size, err := tlv.DecodeBlock(dataset)
+			if err != nil {
+				t.Fatalf("%s: invalid face dataset: %v", encoding, err)
+			}
+			if block.Type() == tlv.FaceStatus {
+				count++
+			}
+			dataset = dataset[size:]
+		}
+		if count != faces {
+			t.Errorf("%s: listed %d of %d faces", encoding, count, faces)
+		}
+	}
+}
@@ -0,0 +1,432 @@
+package mgmtconn
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+
+	"github.com/named-data/YaNFD/ndn"
+	"github.com/named-data/YaNFD/ndn/mgmt"
+	"github.com/named-data/YaNFD/ndn/tlv"
+)
+
+// messageCodec encodes Messages exchanged with the forwarder.
+type messageCodec interface {
+	String() string
+	encode(msg *Message) ([]byte, error)
+	decode(wire []byte) (Message, error)
+}
+
+// makeCodec returns the codec for the named encoding, which is "json" or "tlv".
+func makeCodec(encoding string) (messageCodec, error) {
+	switch encoding {
+	case "", "json":
+		return jsonCodec{}, nil
+	case "tlv":
+		return tlvCodec{}, nil
+	default:
+		return nil, errors.New("unknown encoding '" + encoding + "'")
+	}
+}
+
+// EncodeMessage encodes a Message in the named encoding, which is "json" or "tlv".
+func EncodeMessage(msg *Message, encoding string) ([]byte, error) {
+	codec, err := makeCodec(encoding)
+	if err != nil {
+		return nil, err
+	}
+	return codec.encode(msg)
+}
+
+// MessageEncoding returns the name of the encoding of an encoded Message. JSON messages start with '{', while TLV messages start with the AckMessage type.
+func MessageEncoding(wire []byte) string {
+	if len(wire) > 0 && wire[0] == tlvAckMessage {
+		return "tlv"
+	}
+	return "json"
+}
+
+// DecodeMessage decodes a Message in either encoding, so replies are understood whichever encoding the forwarder answers in.
+func DecodeMessage(wire []byte) (Message, error) {
+	if MessageEncoding(wire) == "tlv" {
+		return tlvCodec{}.decode(wire)
+	}
+	return jsonCodec{}.decode(wire)
+}
+
+// jsonCodec encodes every field of a Message as JSON. Names and URIs in the embedded NDN structures are encoded as strings, and the body of a ControlResponse as its TLV wire, since their types have no JSON encoding of their own.
+type jsonCodec struct{}
+
+func (jsonCodec) String() string {
+	return "json"
+}
+
+// jsonMessage is the JSON form of a Message, whose fields are shadowed by the JSON forms of the embedded NDN structures.
+type jsonMessage struct {
+	*messageFields
+	ControlParams   jsonControlParameters `json:"controlparams"`
+	ControlResponse jsonControlResponse   `json:"controlresponse"`
+	FaceQueryFilter jsonFaceQueryFilter   `json:"facequeryfilter"`
+}
+
+// messageFields has the fields of Message without its methods.
+type messageFields Message
+
+type jsonControlParameters struct {
+	*controlParametersFields
+	Name     *string
+	URI      *string
+	LocalURI *string
+	Strategy *string
+}
+
+type controlParametersFields mgmt.ControlParameters
+
+type jsonControlResponse struct {
+	*controlResponseFields
+	Body []byte
+}
+
+type controlResponseFields mgmt.ControlResponse
+
+type jsonFaceQueryFilter struct {
+	*faceQueryFilterFields
+	URI      *string
+	LocalURI *string
+}
+
+type faceQueryFilterFields mgmt.FaceQueryFilter
+
+// makeJSONMessage returns the JSON form of msg, whose fields it shares.
+func makeJSONMessage(msg *Message) jsonMessage {
+	return jsonMessage{
+		messageFields:   (*messageFields)(msg),
+		ControlParams:   jsonControlParameters{controlParametersFields: (*controlParametersFields)(&msg.ControlParams)},
+		ControlResponse: jsonControlResponse{controlResponseFields: (*controlResponseFields)(&msg.ControlResponse)},
+		FaceQueryFilter: jsonFaceQueryFilter{faceQueryFilterFields: (*faceQueryFilterFields)(&msg.FaceQueryFilter)},
+	}
+}
+
+func (jsonCodec) encode(msg *Message) ([]byte, error) {
+	encoded := makeJSONMessage(msg)
+	encoded.ControlParams.Name = nameString(msg.ControlParams.Name)
+	encoded.ControlParams.URI = uriString(msg.ControlParams.URI)
+	encoded.ControlParams.LocalURI = uriString(msg.ControlParams.LocalURI)
+	encoded.ControlParams.Strategy = nameString(msg.ControlParams.Strategy)
+	if msg.ControlResponse.Body != nil {
+		body, err := msg.ControlResponse.Body.Wire()
+		if err != nil {
+			return nil, err
+		}
+		encoded.ControlResponse.Body = body
+	}
+	encoded.FaceQueryFilter.URI = uriString(msg.FaceQueryFilter.URI)
+	encoded.FaceQueryFilter.LocalURI = uriString(msg.FaceQueryFilter.LocalURI)
+	return json.Marshal(encoded)
+}
+
+func (jsonCodec) decode(wire []byte) (Message, error) {
+	var msg Message
+	decoded := makeJSONMessage(&msg)
+	if err := json.Unmarshal(wire, &decoded); err != nil {
+		return msg, err
+	}
+	var err error
+	if msg.ControlParams.Name, err = parseName(decoded.ControlParams.Name); err != nil {
+		return msg, err
+	}
+	msg.ControlParams.URI = parseURI(decoded.ControlParams.URI)
+	msg.ControlParams.LocalURI = parseURI(decoded.ControlParams.LocalURI)
+	if msg.ControlParams.Strategy, err = parseName(decoded.ControlParams.Strategy); err != nil {
+		return msg, err
+	}
+	if decoded.ControlResponse.Body != nil {
+		if msg.ControlResponse.Body, _, err = tlv.DecodeBlock(decoded.ControlResponse.Body); err != nil {
+			return msg, err
+		}
+	}
+	msg.FaceQueryFilter.URI = parseURI(decoded.FaceQueryFilter.URI)
+	msg.FaceQueryFilter.LocalURI = parseURI(decoded.FaceQueryFilter.LocalURI)
+	return msg, nil
+}
+
+func nameString(name *ndn.Name) *string {
+	if name == nil {
+		return nil
+	}
+	str := name.String()
+	return &str
+}
+
+func uriString(uri *ndn.URI) *string {
+	if uri == nil {
+		return nil
+	}
+	str := uri.String()
+	return &str
+}
+
+func parseName(str *string) (*ndn.Name, error) {
+	if str == nil {
+		return nil, nil
+	}
+	return ndn.NameFromString(*str)
+}
+
+func parseURI(str *string) *ndn.URI {
+	if str == nil {
+		return nil
+	}
+	return ndn.DecodeURIString(*str)
+}
+
+// TLV types of the binary encoding, which are only meaningful inside an AckMessage. Embedded ControlParameters, ControlResponse, and FaceQueryFilter elements are wrapped in an element of their own, so their NDN types are never mixed with these.
+const (
+	tlvAckMessage      = 0x80
+	tlvRequestID       = 0x81
+	tlvCommand         = 0x82
+	tlvName            = 0x83
+	tlvParamName       = 0x84
+	tlvFaceID          = 0x85
+	tlvCost            = 0x86
+	tlvStrategy        = 0x87
+	tlvCapacity        = 0x88
+	tlvVersion         = 0x89
+	tlvDataset         = 0x8a
+	tlvValid           = 0x8b
+	tlvErrorCode       = 0x8c
+	tlvErrorMessage    = 0x8d
+	tlvParamsValid     = 0x8e
+	tlvControlParams   = 0x8f
+	tlvControlResponse = 0x90
+	tlvFaceQueryFilter = 0x91
+	tlvProtocolVersion = 0x92
+	tlvSupportedCmd    = 0x93
+	tlvBuildInfo       = 0x94
+	tlvNextHop         = 0x95
+	tlvEvent           = 0x96
+	tlvURI             = 0x97
+	tlvLocalURI        = 0x98
+	tlvFaceScope       = 0x99
+	tlvFacePersistency = 0x9a
+	tlvLinkType        = 0x9b
+	tlvFlags           = 0x9c
+	tlvChannel         = 0x9d
+	tlvSegment         = 0x9e
+)
+
+// tlvCodec encodes the non-zero fields of a Message as TLV elements of an AckMessage, which avoids reflection-based encoding of the wide Message struct.
+type tlvCodec struct{}
+
+func (tlvCodec) String() string {
+	return "tlv"
+}
+
+func (tlvCodec) encode(msg *Message) ([]byte, error) {
+	wire := tlv.NewEmptyBlock(tlvAckMessage)
+	appendNNI := func(t uint32, v uint64) {
+		if v != 0 {
+			wire.Append(tlv.EncodeNNIBlock(t, v))
+		}
+	}
+	appendBytes := func(t uint32, v []byte) {
+		if len(v) > 0 {
+			wire.Append(tlv.NewBlock(t, v))
+		}
+	}
+	appendFlag := func(t uint32, v bool) {
+		if v {
+			wire.Append(tlv.NewEmptyBlock(t))
+		}
+	}
+	// Embedded NDN structures are wrapped in their own type, since their decoders expect the outer NDN type
+	appendEncoded := func(t uint32, block *tlv.Block, err error) error {
+		if err != nil {
+			return err
+		}
+		encoded, err := block.Wire()
+		if err != nil {
+			return err
+		}
+		wire.Append(tlv.NewBlock(t, encoded))
+		return nil
+	}
+
+	appendNNI(tlvRequestID, msg.RequestID)
+	appendBytes(tlvCommand, []byte(msg.Command))
+	appendBytes(tlvName, []byte(msg.Name))
+	appendBytes(tlvParamName, []byte(msg.ParamName))
+	appendNNI(tlvFaceID, msg.FaceID)
+	appendNNI(tlvCost, msg.Cost)
+	appendBytes(tlvStrategy, []byte(msg.Strategy))
+	if msg.Capacity < 0 {
+		return nil, errors.New("negative capacity")
+	}
+	appendNNI(tlvCapacity, uint64(msg.Capacity))
+	for _, version := range msg.Versions {
+		wire.Append(tlv.EncodeNNIBlock(tlvVersion, version))
+	}
+	appendBytes(tlvDataset, msg.Dataset)
+	appendFlag(tlvValid, msg.Valid)
+	if msg.ErrorCode < 0 {
+		return nil, errors.New("negative error code")
+	}
+	appendNNI(tlvErrorCode, uint64(msg.ErrorCode))
+	appendBytes(tlvErrorMessage, []byte(msg.ErrorMessage))
+	appendFlag(tlvParamsValid, msg.ParamsValid)
+	appendNNI(tlvProtocolVersion, msg.ProtocolVersion)
+	for _, command := range msg.Commands {
+		wire.Append(tlv.NewBlock(tlvSupportedCmd, []byte(command)))
+	}
+	appendBytes(tlvBuildInfo, []byte(msg.BuildInfo))
+	appendBytes(tlvEvent, []byte(msg.Event))
+	appendBytes(tlvURI, []byte(msg.URI))
+	appendBytes(tlvLocalURI, []byte(msg.LocalURI))
+	appendNNI(tlvFaceScope, msg.FaceScope)
+	appendNNI(tlvFacePersistency, msg.FacePersistency)
+	appendNNI(tlvLinkType, msg.LinkType)
+	appendNNI(tlvFlags, msg.Flags)
+	appendBytes(tlvChannel, []byte(msg.Channel))
+	appendBytes(tlvSegment, []byte(msg.Segment))
+	for _, nexthop := range msg.NextHops {
+		// FaceID and Cost are encoded even if zero, since a zero cost is meaningful
+		nexthopWire := tlv.NewEmptyBlock(tlvNextHop)
+		nexthopWire.Append(tlv.EncodeNNIBlock(tlvFaceID, nexthop.FaceID))
+		nexthopWire.Append(tlv.EncodeNNIBlock(tlvCost, nexthop.Cost))
+		wire.Append(nexthopWire)
+	}
+	if !reflect.ValueOf(msg.ControlParams).IsZero() {
+		block, err := msg.ControlParams.Encode()
+		if err := appendEncoded(tlvControlParams, block, err); err != nil {
+			return nil, err
+		}
+	}
+	if msg.ControlResponse.StatusCode != 0 {
+		block, err := msg.ControlResponse.Encode()
+		if err := appendEncoded(tlvControlResponse, block, err); err != nil {
+			return nil, err
+		}
+	}
+	if !reflect.ValueOf(msg.FaceQueryFilter).IsZero() {
+		block, err := msg.FaceQueryFilter.Encode()
+		if err := appendEncoded(tlvFaceQueryFilter, block, err); err != nil {
+			return nil, err
+		}
+	}
+	return wire.Wire()
+}
+
+func (tlvCodec) decode(wire []byte) (Message, error) {
+	var msg Message
+	block, _, err := tlv.DecodeBlock(wire)
+	if err != nil {
+		return msg, err
+	}
+	if block.Type() != tlvAckMessage {
+		return msg, errors.New("message is not an AckMessage")
+	}
+	if err := block.Parse(); err != nil {
+		return msg, err
+	}
+	for _, elem := range block.Subelements() {
+		switch elem.Type() {
+		case tlvRequestID:
+			msg.RequestID, err = tlv.DecodeNNIBlock(elem)
+		case tlvCommand:
+			msg.Command = string(elem.Value())
+		case tlvName:
+			msg.Name = string(elem.Value())
+		case tlvParamName:
+			msg.ParamName = string(elem.Value())
+		case tlvFaceID:
+			msg.FaceID, err = tlv.DecodeNNIBlock(elem)
+		case tlvCost:
+			msg.Cost, err = tlv.DecodeNNIBlock(elem)
+		case tlvStrategy:
+			msg.Strategy = string(elem.Value())
+		case tlvCapacity:
+			var capacity uint64
+			capacity, err = tlv.DecodeNNIBlock(elem)
+			msg.Capacity = int(capacity)
+		case tlvVersion:
+			var version uint64
+			version, err = tlv.DecodeNNIBlock(elem)
+			msg.Versions = append(msg.Versions, version)
+		case tlvDataset:
+			msg.Dataset = elem.Value()
+		case tlvValid:
+			msg.Valid = true
+		case tlvErrorCode:
+			var code uint64
+			code, err = tlv.DecodeNNIBlock(elem)
+			msg.ErrorCode = int(code)
+		case tlvErrorMessage:
+			msg.ErrorMessage = string(elem.Value())
+		case tlvParamsValid:
+			msg.ParamsValid = true
+		case tlvProtocolVersion:
+			msg.ProtocolVersion, err = tlv.DecodeNNIBlock(elem)
+		case tlvSupportedCmd:
+			msg.Commands = append(msg.Commands, string(elem.Value()))
+		case tlvBuildInfo:
+			msg.BuildInfo = string(elem.Value())
+		case tlvEvent:
+			msg.Event = string(elem.Value())
+		case tlvURI:
+			msg.URI = string(elem.Value())
+		case tlvLocalURI:
+			msg.LocalURI = string(elem.Value())
+		case tlvFaceScope:
+			msg.FaceScope, err = tlv.DecodeNNIBlock(elem)
+		case tlvFacePersistency:
+			msg.FacePersistency, err = tlv.DecodeNNIBlock(elem)
+		case tlvLinkType:
+			msg.LinkType, err = tlv.DecodeNNIBlock(elem)
+		case tlvFlags:
+			msg.Flags, err = tlv.DecodeNNIBlock(elem)
+		case tlvChannel:
+			msg.Channel = string(elem.Value())
+		case tlvSegment:
+			msg.Segment = string(elem.Value())
+		case tlvNextHop:
+			var nexthop NextHop
+			if err = elem.Parse(); err == nil && elem.Find(tlvFaceID) != nil && elem.Find(tlvCost) != nil {
+				if nexthop.FaceID, err = tlv.DecodeNNIBlock(elem.Find(tlvFaceID)); err == nil {
+					nexthop.Cost, err = tlv.DecodeNNIBlock(elem.Find(tlvCost))
+				}
+			} else if err == nil {
+				err = errors.New("NextHop is missing FaceID or Cost")
+			}
+			msg.NextHops = append(msg.NextHops, nexthop)
+		case tlvControlParams:
+			var inner *tlv.Block
+			if inner, _, err = tlv.DecodeBlock(elem.Value()); err == nil {
+				var params *mgmt.ControlParameters
+				if params, err = mgmt.DecodeControlParameters(inner); err == nil {
+					msg.ControlParams = *params
+				}
+			}
+		case tlvControlResponse:
+			var inner *tlv.Block
+			if inner, _, err = tlv.DecodeBlock(elem.Value()); err == nil {
+				var response *mgmt.ControlResponse
+				if response, err = mgmt.DecodeControlResponse(inner); err == nil {
+					msg.ControlResponse = *response
+				}
+			}
+		case tlvFaceQueryFilter:
+			var filter *mgmt.FaceQueryFilter
+			if filter, err = mgmt.DecodeFaceQueryFilterFromEncoded(elem.Value()); err == nil {
+				msg.FaceQueryFilter = *filter
+			}
+		default:
+			if tlv.IsCritical(elem.Type()) {
+				err = tlv.ErrUnrecognizedCritical
+			}
+		}
+		if err != nil {
+			return msg, err
+		}
+	}
+	return msg, nil
+}
@@ -0,0 +1,241 @@
+package mgmtconn
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/named-data/YaNFD/ndn"
+	"github.com/named-data/YaNFD/ndn/mgmt"
+)
+
+// testMessages returns a Message of each kind exchanged with the forwarder.
+func testMessages(t testing.TB) map[string]*Message {
+	t.Helper()
+	name, err := ndn.NameFromString("/example/prefix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	strategy, err := ndn.NameFromString("/localhost/nfd/strategy/multicast/v=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	faceID := uint64(300)
+	cost := uint64(10)
+	persistency := uint64(1)
+	params := mgmt.MakeControlParameters()
+	params.Name = name
+	params.FaceID = &faceID
+	params.URI = ndn.MakeUDPFaceURI(4, "192.0.2.1", 6363)
+	params.LocalURI = ndn.MakeUDPFaceURI(4, "192.0.2.2", 6363)
+	params.Cost = &cost
+	params.Strategy = strategy
+	params.FacePersistency = &persistency
+	body, err := params.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheme := "udp4"
+	filter := mgmt.FaceQueryFilter{
+		FaceID:    &faceID,
+		URIScheme: &scheme,
+		URI:       ndn.MakeUDPFaceURI(4, "192.0.2.1", 6363),
+	}
+
+	return map[string]*Message{
+		"hello": {
+			RequestID:       1,
+			Command:         "hello",
+			ProtocolVersion: ProtocolVersion,
+		},
+		"hello reply": {
+			RequestID:       1,
+			ProtocolVersion: ProtocolVersion,
+			Commands:        []string{"insert", "remove", "replacenexthops"},
+			BuildInfo:       "test",
+		},
+		"insert": {
+			RequestID: 2,
+			Command:   "insert",
+			Name:      "/example/prefix",
+			FaceID:    300,
+			Cost:      10,
+		},
+		"replacenexthops": {
+			RequestID: 3,
+			Command:   "replacenexthops",
+			Name:      "/example/prefix",
+			NextHops:  []NextHop{{FaceID: 300, Cost: 0}, {FaceID: 301, Cost: 20}},
+		},
+		"strategy versions": {
+			RequestID: 4,
+			Strategy:  "multicast",
+			Versions:  []uint64{1, 2},
+		},
+		"dataset": {
+			RequestID: 5,
+			Dataset:   bytes.Repeat([]byte{0x80, 0x01, 0x00}, 100),
+		},
+		"error": {
+			RequestID:    6,
+			ErrorCode:    501,
+			ErrorMessage: "Unknown command",
+		},
+		"createface": {
+			RequestID:     7,
+			Command:       "createface",
+			ControlParams: *params,
+		},
+		"createface reply": {
+			RequestID:       7,
+			ControlResponse: *mgmt.MakeControlResponse(200, "OK", body),
+		},
+		"listface": {
+			RequestID:       8,
+			Command:         "listface",
+			FaceQueryFilter: filter,
+			ParamsValid:     true,
+		},
+		"face event": {
+			Command:         "event",
+			Event:           "created",
+			FaceID:          300,
+			URI:             "udp4://192.0.2.1:6363",
+			LocalURI:        "udp4://192.0.2.2:6363",
+			FaceScope:       0,
+			FacePersistency: 1,
+			LinkType:        0,
+			Flags:           1,
+			Valid:           true,
+		},
+		"shared memory": {
+			RequestID: 9,
+			Command:   "sharedmemory",
+			Channel:   "/dev/shm/mgmt",
+			Segment:   "mgmt-1",
+			Capacity:  65536,
+		},
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	for kind, msg := range testMessages(t) {
+		// The TLV encoding is canonical, so messages are compared by their TLV wire, which shows that both codecs decode the message that was encoded
+		expected, err := EncodeMessage(msg, "tlv")
+		if err != nil {
+			t.Fatalf("%s: unable to encode in tlv: %v", kind, err)
+		}
+		for _, encoding := range []string{"json", "tlv"} {
+			wire, err := EncodeMessage(msg, encoding)
+			if err != nil {
+				t.Fatalf("%s: unable to encode in %s: %v", kind, encoding, err)
+			}
+			if MessageEncoding(wire) != encoding {
+				t.Errorf("%s: %s message detected as %s", kind, encoding, MessageEncoding(wire))
+			}
+			roundTrip, err := DecodeMessage(wire)
+			if err != nil {
+				t.Fatalf("%s: unable to decode %s: %v", kind, encoding, err)
+			}
+			roundTripWire, err := EncodeMessage(&roundTrip, "tlv")
+			if err != nil {
+				t.Fatalf("%s: unable to encode message decoded from %s: %v", kind, encoding, err)
+			}
+			if !bytes.Equal(roundTripWire, expected) {
+				t.Errorf("%s: message changed in %s round trip:\n%+v\n%+v", kind, encoding, *msg, roundTrip)
+			}
+		}
+	}
+}
+
+func TestCodecRoundTripSimpleMessages(t *testing.T) {
+	for kind, msg := range testMessages(t) {
+		if !reflect.ValueOf(msg.ControlParams).IsZero() || !reflect.ValueOf(msg.ControlResponse).IsZero() || !reflect.ValueOf(msg.FaceQueryFilter).IsZero() {
+			// Decoded NDN structures keep their wire, so they are not equal to the ones they were encoded from
+			continue
+		}
+		for _, encoding := range []string{"json", "tlv"} {
+			wire, err := EncodeMessage(msg, encoding)
+			if err != nil {
+				t.Fatalf("%s: unable to encode in %s: %v", kind, encoding, err)
+			}
+			decoded, err := DecodeMessage(wire)
+			if err != nil {
+				t.Fatalf("%s: unable to decode %s: %v", kind, encoding, err)
+			}
+			if !reflect.DeepEqual(decoded, *msg) {
+				t.Errorf("%s: message changed in %s round trip:\n%+v\n%+v", kind, encoding, *msg, decoded)
+			}
+		}
+	}
+}
+
+func TestDecodeInvalidMessage(t *testing.T) {
+	for _, wire := range [][]byte{
+		{},
+		{0x80, 0x05, 0x81},
+		{0x06, 0x00},
+		[]byte(`{"requestid":"one"}`),
+	} {
+		if _, err := DecodeMessage(wire); err == nil {
+			t.Errorf("decoded invalid message %x", wire)
+		}
+	}
+}
+
+func benchmarkEncode(b *testing.B, encoding string) {
+	messages := testMessages(b)
+	codec, err := makeCodec(encoding)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, msg := range messages {
+			if _, err := codec.encode(msg); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func benchmarkDecode(b *testing.B, encoding string) {
+	codec, err := makeCodec(encoding)
+	if err != nil {
+		b.Fatal(err)
+	}
+	wires := make([][]byte, 0)
+	for _, msg := range testMessages(b) {
+		wire, err := codec.encode(msg)
+		if err != nil {
+			b.Fatal(err)
+		}
+		wires = append(wires, wire)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, wire := range wires {
+			if _, err := codec.decode(wire); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkEncodeJSON(b *testing.B) {
+	benchmarkEncode(b, "json")
+}
+
+func BenchmarkEncodeTLV(b *testing.B) {
+	benchmarkEncode(b, "tlv")
+}
+
+func BenchmarkDecodeJSON(b *testing.B) {
+	benchmarkDecode(b, "json")
+}
+
+func BenchmarkDecodeTLV(b *testing.B) {
+	benchmarkDecode(b, "tlv")
+}
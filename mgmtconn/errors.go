@@ -0,0 +1,66 @@
+package mgmtconn
+
+import (
+	"errors"
+	"strconv"
+)
+
+// ErrClosed is returned for commands sent on, or still waiting for a reply on, a closed connection.
+var ErrClosed = errors.New("forwarder connection closed")
+
+// ErrDisconnected is returned for commands sent while, or still waiting for a reply when, the forwarder is unreachable. The connection is re-established in the background.
+var ErrDisconnected = errors.New("forwarder disconnected")
+
+// TimeoutError is returned when the context of a command ends before the forwarder replies.
+type TimeoutError struct {
+	Command string
+	Err     error
+}
+
+func (e *TimeoutError) Error() string {
+	return "forwarder did not reply to " + e.Command + ": " + e.Err.Error()
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// EncodingError is returned when a command cannot be encoded or its reply cannot be decoded.
+type EncodingError struct {
+	Command string
+	Err     error
+}
+
+func (e *EncodingError) Error() string {
+	return "unable to encode " + e.Command + " for forwarder: " + e.Err.Error()
+}
+
+func (e *EncodingError) Unwrap() error {
+	return e.Err
+}
+
+// ForwarderError is returned when the forwarder replies to a command with an error.
+type ForwarderError struct {
+	Command string
+	Code    int
+	Message string
+}
+
+func (e *ForwarderError) Error() string {
+	return "forwarder rejected " + e.Command + " with " + strconv.Itoa(e.Code) + " " + e.Message
+}
+
+// UnsupportedError is returned for commands that the connected forwarder reported it does not support.
+type UnsupportedError struct {
+	Command string
+}
+
+func (e *UnsupportedError) Error() string {
+	return "forwarder does not support " + e.Command
+}
+
+// IsUnavailable returns whether the error means that the forwarder could not be reached, as opposed to the forwarder rejecting the command.
+func IsUnavailable(err error) bool {
+	var timeout *TimeoutError
+	return errors.Is(err, ErrClosed) || errors.Is(err, ErrDisconnected) || errors.As(err, &timeout)
+}
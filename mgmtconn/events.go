@@ -0,0 +1,287 @@
+package mgmtconn
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/named-data/YaNFD/ndn"
+)
+
+// eventQueueSize is the number of events that may wait for each subscriber before further events are dropped, unless the subscriber is unbounded.
+const eventQueueSize = 256
+
+// EventType is the type of an event reported by the forwarder. The face event types have the values of the corresponding FaceEventKind.
+type EventType uint64
+
+// Forwarder event types.
+const (
+	EventFaceCreated       EventType = 1
+	EventFaceDestroyed     EventType = 2
+	EventFaceUp            EventType = 3
+	EventFaceDown          EventType = 4
+	EventCsCapacityChanged EventType = 5
+	EventStrategyChanged   EventType = 6
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventFaceCreated:
+		return "FaceCreated"
+	case EventFaceDestroyed:
+		return "FaceDestroyed"
+	case EventFaceUp:
+		return "FaceUp"
+	case EventFaceDown:
+		return "FaceDown"
+	case EventCsCapacityChanged:
+		return "CsCapacityChanged"
+	case EventStrategyChanged:
+		return "StrategyChanged"
+	default:
+		return "Unknown"
+	}
+}
+
+// eventTypes maps the event names used on the wire to event types.
+var eventTypes = map[string]EventType{
+	"facecreated":   EventFaceCreated,
+	"facedestroyed": EventFaceDestroyed,
+	"faceup":        EventFaceUp,
+	"facedown":      EventFaceDown,
+	"cscapacity":    EventCsCapacityChanged,
+	"strategy":      EventStrategyChanged,
+}
+
+// FaceInfo describes the face that a face event is about.
+type FaceInfo struct {
+	FaceID      uint64
+	URI         *ndn.URI
+	LocalURI    *ndn.URI
+	Scope       uint64
+	Persistency uint64
+	LinkType    uint64
+	Flags       uint64
+}
+
+// Event is an event reported by the forwarder.
+type Event struct {
+	Type EventType
+	// Face is set for face events
+	Face FaceInfo
+	// Capacity is set for CsCapacityChanged
+	Capacity int
+	// Name and Strategy are set for StrategyChanged. Strategy is nil if the strategy choice was unset.
+	Name     *ndn.Name
+	Strategy *ndn.Name
+}
+
+// decodeEvent converts an event message from the forwarder into an Event. Messages with any other non-empty command are from forwarders predating typed events, which only report destroyed faces.
+func decodeEvent(msg *Message) (Event, error) {
+	if msg.Command != "event" {
+		return Event{Type: EventFaceDestroyed, Face: FaceInfo{FaceID: msg.FaceID}}, nil
+	}
+
+	eventType, ok := eventTypes[msg.Event]
+	if !ok {
+		return Event{}, fmt.Errorf("unknown event '%s'", msg.Event)
+	}
+	event := Event{Type: eventType}
+	switch eventType {
+	case EventCsCapacityChanged:
+		event.Capacity = msg.Capacity
+	case EventStrategyChanged:
+		name, err := ndn.NameFromString(msg.Name)
+		if err != nil {
+			return Event{}, err
+		}
+		event.Name = name
+		if msg.Strategy != "" {
+			if event.Strategy, err = ndn.NameFromString(msg.Strategy); err != nil {
+				return Event{}, err
+			}
+		}
+	default:
+		event.Face = FaceInfo{
+			FaceID:      msg.FaceID,
+			Scope:       msg.FaceScope,
+			Persistency: msg.FacePersistency,
+			LinkType:    msg.LinkType,
+			Flags:       msg.Flags,
+		}
+		if msg.URI != "" {
+			event.Face.URI = ndn.DecodeURIString(msg.URI)
+		}
+		if msg.LocalURI != "" {
+			event.Face.LocalURI = ndn.DecodeURIString(msg.LocalURI)
+		}
+	}
+	return event, nil
+}
+
+// subscriber receives the events of some types.
+type subscriber struct {
+	events chan Event
+	types  map[EventType]bool
+
+	// unbounded subscribers queue events in backlog, from which a goroutine delivers them to events, instead of dropping them
+	unbounded bool
+	mutex     sync.Mutex
+	cond      *sync.Cond
+	backlog   []Event
+	// closed is set once no more events are published to the subscriber, and stop is closed if the remaining events are not wanted either
+	closed bool
+	stop   chan struct{}
+}
+
+func makeSubscriber(types []EventType, unbounded bool) *subscriber {
+	s := &subscriber{
+		events:    make(chan Event, eventQueueSize),
+		types:     make(map[EventType]bool),
+		unbounded: unbounded,
+		stop:      make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mutex)
+	for _, eventType := range types {
+		s.types[eventType] = true
+	}
+	if unbounded {
+		go s.run()
+	}
+	return s
+}
+
+// deliver queues an event for the subscriber. Bounded subscribers drop it if their queue is full.
+func (s *subscriber) deliver(event Event) {
+	if !s.unbounded {
+		select {
+		case s.events <- event:
+		default:
+			fmt.Println("Dropping", event.Type, "event for slow subscriber")
+		}
+		return
+	}
+	s.mutex.Lock()
+	s.backlog = append(s.backlog, event)
+	s.mutex.Unlock()
+	s.cond.Signal()
+}
+
+// run delivers the backlog of an unbounded subscriber in order, closing the channel once the subscriber is closed and the backlog is empty, or as soon as it is stopped.
+func (s *subscriber) run() {
+	defer close(s.events)
+	for {
+		s.mutex.Lock()
+		for len(s.backlog) == 0 && !s.closed {
+			s.cond.Wait()
+		}
+		if len(s.backlog) == 0 {
+			s.mutex.Unlock()
+			return
+		}
+		event := s.backlog[0]
+		s.backlog[0] = Event{}
+		s.backlog = s.backlog[1:]
+		s.mutex.Unlock()
+
+		select {
+		case s.events <- event:
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// close ends the subscription. The remaining backlog of an unbounded subscriber is still delivered unless discard is set.
+func (s *subscriber) close(discard bool) {
+	if !s.unbounded {
+		close(s.events)
+		return
+	}
+	s.mutex.Lock()
+	s.closed = true
+	if discard {
+		s.backlog = nil
+		close(s.stop)
+	}
+	s.mutex.Unlock()
+	s.cond.Signal()
+}
+
+// eventBus delivers events to subscribers.
+type eventBus struct {
+	mutex       sync.Mutex
+	subscribers map[*subscriber]bool
+	closed      bool
+}
+
+// Subscribe returns a channel that receives the forwarder events of the specified types, or of all types if none are specified, and a function that ends the subscription. Events are dropped if the subscriber falls more than eventQueueSize events behind. The channel is closed when the subscription ends or the connection is closed.
+func (a *AckConn) Subscribe(types ...EventType) (<-chan Event, func()) {
+	return a.events.subscribe(makeSubscriber(types, false))
+}
+
+// SubscribeUnbounded is like Subscribe, but events are never dropped. They are queued without bound while the subscriber is behind, so it must keep receiving them. Subscribers that would be left inconsistent by a missed event, such as the RIB missing a destroyed face, use it. When the connection is closed, the events already queued are delivered before the channel is closed.
+func (a *AckConn) SubscribeUnbounded(types ...EventType) (<-chan Event, func()) {
+	return a.events.subscribe(makeSubscriber(types, true))
+}
+
+func (b *eventBus) subscribe(s *subscriber) (<-chan Event, func()) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.closed {
+		s.close(true)
+		return s.events, func() {}
+	}
+	if b.subscribers == nil {
+		b.subscribers = make(map[*subscriber]bool)
+	}
+	b.subscribers[s] = true
+	return s.events, func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		if b.subscribers[s] {
+			delete(b.subscribers, s)
+			s.close(true)
+		}
+	}
+}
+
+func (b *eventBus) publish(event Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for s := range b.subscribers {
+		if len(s.types) > 0 && !s.types[event.Type] {
+			continue
+		}
+		s.deliver(event)
+	}
+}
+
+func (b *eventBus) close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.closed = true
+	for s := range b.subscribers {
+		s.close(false)
+	}
+	b.subscribers = nil
+}
+
+// handleEvent records the forwarder configuration changes reported by an event, so that they are replayed after reconnecting, and delivers the event to subscribers.
+func (a *AckConn) handleEvent(msg *Message) {
+	event, err := decodeEvent(msg)
+	if err != nil {
+		fmt.Println("Dropping undecodable event from forwarder:", err)
+		return
+	}
+	switch event.Type {
+	case EventCsCapacityChanged:
+		a.state.setCapacity(event.Capacity)
+	case EventStrategyChanged:
+		if event.Strategy != nil {
+			a.state.setStrategy(event.Name, event.Strategy)
+		} else {
+			a.state.unsetStrategy(event.Name)
+		}
+	}
+	a.events.publish(event)
+}
@@ -0,0 +1,107 @@
+package mgmtconn
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// ProtocolVersion is the version of the command protocol spoken by mgmt.
+const ProtocolVersion = 1
+
+// Capabilities describes the forwarder at the other end of the connection, as reported in its reply to hello.
+type Capabilities struct {
+	ProtocolVersion uint64
+	// Commands contains the commands the forwarder supports, or is nil if the forwarder did not complete the handshake, in which case all commands are attempted
+	Commands  map[string]bool
+	BuildInfo string
+}
+
+// capabilityStore holds the Capabilities of the current connection.
+type capabilityStore struct {
+	mutex        sync.RWMutex
+	capabilities Capabilities
+	// known is closed once the capabilities of the current connection are known, or nil if there is no handshake to wait for
+	known chan struct{}
+}
+
+func (c *capabilityStore) get() Capabilities {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.capabilities
+}
+
+// reset forgets the capabilities when connecting to a forwarder, until the handshake sets them.
+func (c *capabilityStore) reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.capabilities = Capabilities{}
+	c.known = make(chan struct{})
+}
+
+// set sets the capabilities, waking up the commands waiting for them.
+func (c *capabilityStore) set(capabilities Capabilities) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.capabilities = capabilities
+	if c.known != nil {
+		close(c.known)
+		c.known = nil
+	}
+}
+
+// wait waits until the capabilities are known or the context ends.
+func (c *capabilityStore) wait(ctx context.Context) error {
+	c.mutex.RLock()
+	known := c.known
+	c.mutex.RUnlock()
+	if known == nil {
+		return nil
+	}
+	select {
+	case <-known:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Capabilities returns the capabilities reported by the connected forwarder.
+func (a *AckConn) Capabilities() Capabilities {
+	return a.capabilities.get()
+}
+
+// Supports returns whether the connected forwarder supports the command. Commands are assumed to be supported with forwarders that do not understand hello. SendCommand waits for the handshake before checking this, so commands are not attempted before the forwarder has answered hello.
+func (a *AckConn) Supports(command string) bool {
+	commands := a.capabilities.get().Commands
+	return commands == nil || commands[command]
+}
+
+// handshake exchanges hello with the forwarder to learn its protocol version and supported commands. Forwarders that do not answer hello are treated as supporting every command.
+func (a *AckConn) handshake() {
+	ctx, cancel := context.WithTimeout(context.Background(), a.Timeout)
+	defer cancel()
+	reply, err := a.SendCommand(ctx, Message{
+		Command:         "hello",
+		ProtocolVersion: ProtocolVersion,
+	})
+	if err != nil {
+		fmt.Println("Forwarder did not answer hello, assuming it supports all commands:", err)
+		a.capabilities.set(Capabilities{})
+		return
+	}
+
+	capabilities := Capabilities{
+		ProtocolVersion: reply.ProtocolVersion,
+		Commands:        make(map[string]bool, len(reply.Commands)),
+		BuildInfo:       reply.BuildInfo,
+	}
+	for _, command := range reply.Commands {
+		capabilities.Commands[command] = true
+	}
+	if capabilities.ProtocolVersion != ProtocolVersion {
+		fmt.Println("Forwarder speaks protocol version", capabilities.ProtocolVersion, "instead of", ProtocolVersion)
+	}
+	a.capabilities.set(capabilities)
+	fmt.Println("Connected to forwarder", capabilities.BuildInfo, "supporting", len(capabilities.Commands), "commands")
+}
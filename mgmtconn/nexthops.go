@@ -0,0 +1,93 @@
+package mgmtconn
+
+import (
+	"context"
+	"sync"
+
+	"github.com/named-data/YaNFD/ndn"
+)
+
+// maxPipelinedBatches is the number of replacenexthops commands that may await replies at once.
+const maxPipelinedBatches = 32
+
+// NextHop is a nexthop in a replacenexthops command.
+type NextHop struct {
+	FaceID uint64 `json:"faceid"`
+	Cost   uint64 `json:"cost"`
+}
+
+// NextHopUpdate is an update to the nexthops of a prefix. Unless Incremental is set, NextHops is the complete set of nexthops for the prefix. Otherwise, NextHops are the nexthops to add or change the cost of, and Removed are the faces whose nexthops are removed.
+type NextHopUpdate struct {
+	Name        *ndn.Name
+	NextHops    []NextHop
+	Incremental bool
+	Removed     []uint64
+}
+
+// ReplaceNextHops atomically replaces all nexthops of the prefix in the FIB. With forwarders that do not support replacenexthops, the nexthops are cleared and then inserted one at a time instead.
+func (a *AckConn) ReplaceNextHops(ctx context.Context, name *ndn.Name, nexthops []NextHop) error {
+	if !a.Supports("replacenexthops") {
+		if err := a.ClearNextHops(ctx, name); err != nil {
+			return err
+		}
+		for _, nexthop := range nexthops {
+			if err := a.InsertNextHop(ctx, name, nexthop.FaceID, nexthop.Cost); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	msg := Message{
+		Command:  "replacenexthops",
+		Name:     name.String(),
+		NextHops: nexthops,
+	}
+	_, err := a.SendCommand(ctx, msg)
+	return err
+}
+
+// UpdateNextHops applies an update to the nexthops of a prefix in the FIB. Incremental updates insert nexthops before removing any, so the prefix keeps nexthops throughout.
+func (a *AckConn) UpdateNextHops(ctx context.Context, update NextHopUpdate) error {
+	if !update.Incremental {
+		return a.ReplaceNextHops(ctx, update.Name, update.NextHops)
+	}
+	for _, nexthop := range update.NextHops {
+		if err := a.InsertNextHop(ctx, update.Name, nexthop.FaceID, nexthop.Cost); err != nil {
+			return err
+		}
+	}
+	for _, faceID := range update.Removed {
+		if err := a.RemoveNextHop(ctx, update.Name, faceID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateNextHopsPipelined applies the updates with up to maxPipelinedBatches updates awaiting replies at once, instead of waiting for each update to complete before sending the next. Besides ctx, each update is bounded by its own Timeout from when it is sent, so that many updates can be applied without a deadline covering all of them. All updates are attempted and the first error is returned.
+func (a *AckConn) UpdateNextHopsPipelined(ctx context.Context, updates []NextHopUpdate) error {
+	window := make(chan struct{}, maxPipelinedBatches)
+	errs := make(chan error, len(updates))
+	var wg sync.WaitGroup
+	for _, update := range updates {
+		window <- struct{}{}
+		wg.Add(1)
+		go func(update NextHopUpdate) {
+			defer wg.Done()
+			updateCtx, cancel := context.WithTimeout(ctx, a.Timeout)
+			defer cancel()
+			errs <- a.UpdateNextHops(updateCtx, update)
+			<-window
+		}(update)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package mgmtconn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/amazingtapioca17/mgmt/shm"
+)
+
+// Channels that a shared memory segment can be attached to.
+const (
+	ChannelCommands = "commands"
+	ChannelPackets  = "packets"
+)
+
+// attachSharedMemory offers the forwarder a shared memory segment for the commands on a socket that was just connected, before any other command is sent on it. It returns a connection over the segment if the forwarder accepts it, and the socket otherwise.
+func (a *AckConn) attachSharedMemory(socket net.Conn) net.Conn {
+	if a.SharedMemorySize <= 0 {
+		return socket
+	}
+	segment, err := shm.CreateTemp("ndn-mgmt-commands-*", a.SharedMemorySize)
+	if err != nil {
+		fmt.Println("Unable to create shared memory segment, using the socket for commands:", err)
+		return socket
+	}
+	defer segment.Unlink()
+
+	if err := a.requestSharedMemory(socket, segment.Path()); err != nil {
+		fmt.Println("Forwarder did not accept shared memory, using the socket for commands:", err)
+		segment.Close()
+		return socket
+	}
+	fmt.Println("Using shared memory for commands")
+	return segment.Conn(socket)
+}
+
+// requestSharedMemory sends the sharedmemory command for the command channel directly on the socket, since the forwarder switches to the segment once it has replied. Events received before the reply are dropped, as the forwarder state is resynchronized after connecting anyway.
+func (a *AckConn) requestSharedMemory(socket net.Conn, segment string) error {
+	command := Message{
+		Command: "sharedmemory",
+		Channel: ChannelCommands,
+		Segment: segment,
+	}
+	wire, err := a.codec.encode(&command)
+	if err != nil {
+		return err
+	}
+	socket.SetDeadline(time.Now().Add(a.Timeout))
+	defer socket.SetDeadline(time.Time{})
+	if _, err := socket.Write(wire); err != nil {
+		return err
+	}
+
+	for {
+		message, err := readMessage(socket)
+		if err == errMessageTooLarge {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		reply, err := DecodeMessage(message)
+		if err != nil || reply.Command != "" {
+			continue
+		}
+		if reply.ErrorCode != 0 {
+			return &ForwarderError{Command: command.Command, Code: reply.ErrorCode, Message: reply.ErrorMessage}
+		}
+		return nil
+	}
+}
+
+// AttachSharedMemory asks the forwarder to exchange the packets of a channel other than the command channel over the shared memory segment at the path. The segment must have been created by the caller, who switches to it once this returns without error.
+func (a *AckConn) AttachSharedMemory(ctx context.Context, channel string, segment string) error {
+	if channel == ChannelCommands {
+		return errors.New("the command channel attaches shared memory when connecting")
+	}
+	msg := Message{
+		Command: "sharedmemory",
+		Channel: channel,
+		Segment: segment,
+	}
+	_, err := a.SendCommand(ctx, msg)
+	return err
+}
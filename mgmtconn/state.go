@@ -0,0 +1,61 @@
+package mgmtconn
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/named-data/YaNFD/ndn"
+)
+
+// strategyChoice is a strategy set for a prefix.
+type strategyChoice struct {
+	name     *ndn.Name
+	strategy *ndn.Name
+}
+
+// forwarderState records the configuration that mgmt has successfully pushed to the forwarder, other than the nexthops derived from the RIB.
+type forwarderState struct {
+	mutex      sync.Mutex
+	capacity   *int
+	strategies map[string]strategyChoice
+}
+
+func (s *forwarderState) setCapacity(capacity int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.capacity = &capacity
+}
+
+func (s *forwarderState) setStrategy(name *ndn.Name, strategy *ndn.Name) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.strategies == nil {
+		s.strategies = make(map[string]strategyChoice)
+	}
+	s.strategies[name.String()] = strategyChoice{name: name.DeepCopy(), strategy: strategy.DeepCopy()}
+}
+
+func (s *forwarderState) unsetStrategy(name *ndn.Name) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.strategies, name.String())
+}
+
+// snapshot returns the CS capacity, if set, and the strategy choices ordered from shorter to longer prefixes.
+func (s *forwarderState) snapshot() (*int, []strategyChoice) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var capacity *int
+	if s.capacity != nil {
+		capacity = new(int)
+		*capacity = *s.capacity
+	}
+	strategies := make([]strategyChoice, 0, len(s.strategies))
+	for _, choice := range s.strategies {
+		strategies = append(strategies, choice)
+	}
+	sort.Slice(strategies, func(i, j int) bool {
+		return strategies[i].name.Size() < strategies[j].name.Size()
+	})
+	return capacity, strategies
+}
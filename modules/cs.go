@@ -16,31 +16,28 @@ import (
 
 // ContentStoreModule is the module that handles Content Store Management.
 type ContentStoreModule struct {
-	manager            *Thread
-	nextDatasetVersion uint64
+	manager *Thread
 }
 
 func (c *ContentStoreModule) String() string {
 	return "ContentStoreMgmt"
 }
 
-func (c *ContentStoreModule) registerManager(manager *Thread) {
+func (c *ContentStoreModule) RegisterManager(manager *Thread) {
 	c.manager = manager
 }
 
-func (c *ContentStoreModule) getManager() *Thread {
+func (c *ContentStoreModule) GetManager() *Thread {
 	return c.manager
 }
 
-func (c *ContentStoreModule) handleIncomingInterest(interest *ndn.Interest, pitToken []byte, inFace uint64) {
-	// Only allow from /localhost
-	if !c.manager.localPrefix.PrefixOf(interest.Name()) {
-		core.LogWarn(c, "Received CS management Interest from non-local source - DROP")
-		return
-	}
+func (c *ContentStoreModule) CommandVerbs() []string {
+	return []string{"config", "erase"}
+}
 
+func (c *ContentStoreModule) HandleIncomingInterest(interest *ndn.Interest, pitToken []byte, inFace uint64) {
 	// Dispatch by verb
-	verb := interest.Name().At(c.manager.prefixLength() + 1).String()
+	verb := interest.Name().At(c.manager.PrefixLength() + 1).String()
 	switch verb {
 	case "config":
 		c.config(interest, pitToken, inFace)
@@ -55,7 +52,7 @@ func (c *ContentStoreModule) handleIncomingInterest(interest *ndn.Interest, pitT
 	default:
 		core.LogWarn(c, "Received Interest for non-existent verb '", verb, "'")
 		response := mgmt.MakeControlResponse(501, "Unknown verb", nil)
-		c.manager.sendResponse(response, interest, pitToken, inFace)
+		c.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 }
@@ -63,25 +60,25 @@ func (c *ContentStoreModule) handleIncomingInterest(interest *ndn.Interest, pitT
 func (c *ContentStoreModule) config(interest *ndn.Interest, pitToken []byte, inFace uint64) {
 	var response *mgmt.ControlResponse
 
-	if interest.Name().Size() < c.manager.prefixLength()+3 {
+	if interest.Name().Size() < c.manager.PrefixLength()+3 {
 		// Name not long enough to contain ControlParameters
 		core.LogWarn(c, "Missing ControlParameters in ", interest.Name())
 		response = mgmt.MakeControlResponse(400, "ControlParameters is incorrect", nil)
-		c.manager.sendResponse(response, interest, pitToken, inFace)
+		c.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
-	params := decodeControlParameters(c, interest)
+	params := DecodeControlParameters(c, interest)
 	if params == nil {
 		response = mgmt.MakeControlResponse(400, "ControlParameters is incorrect", nil)
-		c.manager.sendResponse(response, interest, pitToken, inFace)
+		c.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
 	if (params.Flags == nil && params.Mask != nil) || (params.Flags != nil && params.Mask == nil) {
 		core.LogWarn(c, "Flags and Mask fields must either both be present or both be not present")
 		response = mgmt.MakeControlResponse(409, "ControlParameters are incorrect", nil)
-		c.manager.sendResponse(response, interest, pitToken, inFace)
+		c.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
@@ -89,7 +86,12 @@ func (c *ContentStoreModule) config(interest *ndn.Interest, pitToken []byte, inF
 		core.LogInfo(c, "Setting CS capacity to ", *params.Capacity)
 		//easy fix just send mgmtconn.Conn.SetCapacity or smth
 		//table.SetCsCapacity(int(*params.Capacity))
-		mgmtconn.AcksConn.SetCapacity(int(*params.Capacity))
+		ctx, cancel := c.manager.ForwarderContext()
+		defer cancel()
+		if err := mgmtconn.AcksConn.SetCapacity(ctx, int(*params.Capacity)); err != nil {
+			c.manager.SendResponse(ForwarderErrorResponse(c, interest, err), interest, pitToken, inFace)
+			return
+		}
 	}
 
 	/*if params.Flags != nil {
@@ -117,29 +119,10 @@ func (c *ContentStoreModule) config(interest *ndn.Interest, pitToken []byte, inF
 	} else {
 		response = mgmt.MakeControlResponse(200, "OK", responseParamsWire)
 	}
-	c.manager.sendResponse(response, interest, pitToken, inFace)
+	c.manager.SendResponse(response, interest, pitToken, inFace)
 }
 
 func (c *ContentStoreModule) info(interest *ndn.Interest, pitToken []byte, inFace uint64) {
-	if interest.Name().Size() > c.manager.prefixLength()+2 {
-		// Ignore because contains version and/or segment components
-		return
-	}
-
-	// Generate new dataset
-	dataset := mgmtconn.AcksConn.CsInfo()
-
 	name, _ := ndn.NameFromString(c.manager.localPrefix.String() + "/cs/info")
-	segments := mgmt.MakeStatusDataset(name, c.nextDatasetVersion, dataset)
-	for _, segment := range segments {
-		encoded, err := segment.Encode()
-		if err != nil {
-			core.LogError(c, "Unable to encode forwarder status dataset: ", err)
-			return
-		}
-		c.manager.transport.Send(encoded, pitToken, nil)
-	}
-
-	core.LogTrace(c, "Published forwarder status dataset version=", c.nextDatasetVersion, ", containing ", len(segments), " segments")
-	c.nextDatasetVersion++
+	c.manager.ServeDataset(c, interest, pitToken, name, mgmtconn.AcksConn.CsInfo)
 }
@@ -0,0 +1,211 @@
+package modules
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/named-data/YaNFD/core"
+	"github.com/named-data/YaNFD/ndn"
+	"github.com/named-data/YaNFD/ndn/tlv"
+)
+
+// maxDatasetSegmentSize is the maximum amount of dataset content placed in each segment.
+const maxDatasetSegmentSize = 8000
+
+// metadataFreshnessPeriod is the FreshnessPeriod of RDR metadata packets, which must be short so that consumers discover new versions.
+const metadataFreshnessPeriod = 1 * time.Millisecond
+
+// datasetVersion is a generated version of a status dataset.
+type datasetVersion struct {
+	version  uint64
+	segments []*tlv.Block
+	expires  time.Time
+}
+
+// datasetPublisher caches generated status dataset versions for a short window and serves their segments on demand.
+type datasetPublisher struct {
+	mutex       sync.Mutex
+	lifetime    time.Duration
+	versions    map[string][]*datasetVersion
+	lastVersion map[string]uint64
+}
+
+func makeDatasetPublisher(lifetime time.Duration) *datasetPublisher {
+	p := new(datasetPublisher)
+	p.lifetime = lifetime
+	p.versions = make(map[string][]*datasetVersion)
+	p.lastVersion = make(map[string]uint64)
+	return p
+}
+
+// makeStatusDataset splits a dataset into segments under the specified version. It is equivalent to mgmt.MakeStatusDataset, except that each segment only contains its own part of the dataset.
+func makeStatusDataset(name *ndn.Name, version uint64, dataset []byte) []*ndn.Data {
+	nSegments := (len(dataset) + maxDatasetSegmentSize - 1) / maxDatasetSegmentSize
+	if nSegments == 0 {
+		// Empty dataset is published as a single empty segment
+		nSegments = 1
+	}
+	segments := make([]*ndn.Data, nSegments)
+	for segment := 0; segment < nSegments; segment++ {
+		end := maxDatasetSegmentSize * (segment + 1)
+		if end > len(dataset) {
+			end = len(dataset)
+		}
+		content := dataset[maxDatasetSegmentSize*segment : end]
+		segmentName := name.DeepCopy().Append(ndn.NewVersionNameComponent(version)).Append(ndn.NewSegmentNameComponent(uint64(segment)))
+		data := ndn.NewData(segmentName, content)
+		metaInfo := ndn.NewMetaInfo()
+		metaInfo.SetFreshnessPeriod(1000 * time.Millisecond)
+		metaInfo.SetFinalBlockID(ndn.NewSegmentNameComponent(uint64(nSegments - 1)))
+		data.SetMetaInfo(metaInfo)
+		segments[segment] = data
+	}
+	return segments
+}
+
+// expire removes versions whose caching window has passed. The caller must hold the mutex.
+func (p *datasetPublisher) expire(now time.Time) {
+	for key, versions := range p.versions {
+		remaining := versions[:0]
+		for _, version := range versions {
+			if now.Before(version.expires) {
+				remaining = append(remaining, version)
+			}
+		}
+		if len(remaining) == 0 {
+			delete(p.versions, key)
+		} else {
+			p.versions[key] = remaining
+		}
+	}
+}
+
+// newVersion returns the version number for a new version of the dataset, which, as in NFD, is the current time in milliseconds since the Unix epoch, so that versions published after a restart do not reuse the names of versions that may still be cached downstream. It is increased if needed to exceed the last version published. The caller must hold the mutex.
+func (p *datasetPublisher) newVersion(key string) uint64 {
+	version := uint64(time.Now().UnixMilli())
+	if last, ok := p.lastVersion[key]; ok && version <= last {
+		version = last + 1
+	}
+	return version
+}
+
+// publish encodes a new version of the dataset and caches it.
+func (p *datasetPublisher) publish(name *ndn.Name, dataset []byte) (*datasetVersion, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	key := name.String()
+	version := &datasetVersion{
+		version: p.newVersion(key),
+		expires: time.Now().Add(p.lifetime),
+	}
+	for _, segment := range makeStatusDataset(name, version.version, dataset) {
+		encoded, err := segment.Encode()
+		if err != nil {
+			return nil, err
+		}
+		version.segments = append(version.segments, encoded)
+	}
+	p.lastVersion[key] = version.version
+
+	p.expire(time.Now())
+	p.versions[key] = append(p.versions[key], version)
+	return version, nil
+}
+
+// find returns the cached version of the dataset, if it has not expired.
+func (p *datasetPublisher) find(name *ndn.Name, version uint64) *datasetVersion {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.expire(time.Now())
+	for _, cached := range p.versions[name.String()] {
+		if cached.version == version {
+			return cached
+		}
+	}
+	return nil
+}
+
+// isMetadataInterest returns whether the Interest is a Realtime Data Retrieval (RDR) discovery Interest for the dataset.
+func isMetadataInterest(interest *ndn.Interest, datasetName *ndn.Name) bool {
+	if interest.Name().Size() != datasetName.Size()+1 {
+		return false
+	}
+	component := interest.Name().At(datasetName.Size())
+	return component.Type() == tlv.KeywordNameComponent && string(component.Value()) == "metadata"
+}
+
+// sendMetadata answers an RDR discovery Interest with the versioned name of a newly generated dataset version.
+func (m *Thread) sendMetadata(module Module, interest *ndn.Interest, pitToken []byte, datasetName *ndn.Name, published *datasetVersion) {
+	versionedName := datasetName.DeepCopy().Append(ndn.NewVersionNameComponent(published.version))
+	content, err := versionedName.Encode().Wire()
+	if err != nil {
+		core.LogError(module, "Unable to encode metadata for dataset ", datasetName, ": ", err)
+		return
+	}
+
+	metadataName := interest.Name().DeepCopy().Append(ndn.NewVersionNameComponent(published.version)).Append(ndn.NewSegmentNameComponent(0))
+	data := ndn.NewData(metadataName, content)
+	metaInfo := ndn.NewMetaInfo()
+	metaInfo.SetFreshnessPeriod(metadataFreshnessPeriod)
+	metaInfo.SetFinalBlockID(ndn.NewSegmentNameComponent(0))
+	data.SetMetaInfo(metaInfo)
+	encoded, err := data.Encode()
+	if err != nil {
+		core.LogError(module, "Unable to encode metadata for dataset ", datasetName, ": ", err)
+		return
+	}
+	m.transport.Send(encoded, pitToken, nil)
+}
+
+// ServeDataset answers an Interest for the status dataset at datasetName. An Interest naming a version and segment is answered from the cache. An RDR metadata Interest causes a new version to be generated, whose name is returned in the metadata. Otherwise, a new version is generated and its first segment is returned.
+func (m *Thread) ServeDataset(module Module, interest *ndn.Interest, pitToken []byte, datasetName *ndn.Name, generate func(ctx context.Context) ([]byte, error)) {
+	isMetadata := isMetadataInterest(interest, datasetName)
+	if interest.Name().Size() > datasetName.Size() && !isMetadata {
+		versionComponent, ok := interest.Name().At(datasetName.Size()).(*ndn.VersionNameComponent)
+		if !ok {
+			core.LogInfo(module, "Dataset Interest ", interest.Name(), " has an illegible version - DROP")
+			return
+		}
+		segment := uint64(0)
+		if interest.Name().Size() > datasetName.Size()+1 {
+			segmentComponent, ok := interest.Name().At(datasetName.Size() + 1).(*ndn.SegmentNameComponent)
+			if !ok {
+				core.LogInfo(module, "Dataset Interest ", interest.Name(), " has an illegible segment - DROP")
+				return
+			}
+			segment, _ = tlv.DecodeNNI(segmentComponent.Value())
+		}
+
+		cached := m.datasets.find(datasetName, versionComponent.Version())
+		if cached == nil || segment >= uint64(len(cached.segments)) {
+			core.LogDebug(module, "Dataset Interest ", interest.Name(), " is for an unknown or expired segment - DROP")
+			return
+		}
+		m.transport.Send(cached.segments[segment], pitToken, nil)
+		return
+	}
+
+	// Generate new dataset
+	ctx, cancel := m.ForwarderContext()
+	defer cancel()
+	dataset, err := generate(ctx)
+	if err != nil {
+		core.LogError(module, "Unable to generate dataset ", datasetName, ": ", err)
+		return
+	}
+	published, err := m.datasets.publish(datasetName, dataset)
+	if err != nil {
+		core.LogError(module, "Unable to encode dataset ", datasetName, ": ", err)
+		return
+	}
+	if isMetadata {
+		m.sendMetadata(module, interest, pitToken, datasetName, published)
+	} else {
+		m.transport.Send(published.segments[0], pitToken, nil)
+	}
+
+	core.LogTrace(module, "Published dataset ", datasetName, " version=", published.version, ", containing ", len(published.segments), " segments")
+}
@@ -0,0 +1,146 @@
+package modules
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/named-data/YaNFD/ndn"
+)
+
+// segmentContents decodes the segments of a cached version, checking that they are named and linked as a segmented dataset.
+func segmentContents(t *testing.T, name *ndn.Name, version *datasetVersion) [][]byte {
+	t.Helper()
+	contents := make([][]byte, 0, len(version.segments))
+	for i, segment := range version.segments {
+		data, err := ndn.DecodeData(segment, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectedName := name.DeepCopy().Append(ndn.NewVersionNameComponent(version.version)).Append(ndn.NewSegmentNameComponent(uint64(i)))
+		if !data.Name().Equals(expectedName) {
+			t.Errorf("segment %d is named %s, expected %s", i, data.Name(), expectedName)
+		}
+		finalBlockID := data.MetaInfo().FinalBlockID()
+		if finalBlockID == nil || !finalBlockID.Equals(ndn.NewSegmentNameComponent(uint64(len(version.segments)-1))) {
+			t.Errorf("segment %d has FinalBlockID %v with %d segments", i, finalBlockID, len(version.segments))
+		}
+		contents = append(contents, data.Content())
+	}
+	return contents
+}
+
+func TestPublishDataset(t *testing.T) {
+	publisher := makeDatasetPublisher(time.Minute)
+	name := testName(t, "/localhost/nfd/faces/list")
+	dataset := bytes.Repeat([]byte{0x80, 0x02, 0x01, 0x02}, maxDatasetSegmentSize/2)
+
+	published, err := publisher.publish(name, dataset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := segmentContents(t, name, published)
+	if len(contents) != 2 {
+		t.Fatalf("dataset of %d bytes published in %d segments", len(dataset), len(contents))
+	}
+	if !bytes.Equal(bytes.Join(contents, nil), dataset) {
+		t.Error("segments do not contain the dataset")
+	}
+	if len(contents[0]) != maxDatasetSegmentSize {
+		t.Errorf("first segment contains %d bytes", len(contents[0]))
+	}
+
+	if cached := publisher.find(name, published.version); cached != published {
+		t.Error("published version is not cached")
+	}
+	if cached := publisher.find(name, published.version+1); cached != nil {
+		t.Error("found a version that was not published")
+	}
+	if cached := publisher.find(testName(t, "/localhost/nfd/fib/list"), published.version); cached != nil {
+		t.Error("found a version of another dataset")
+	}
+}
+
+func TestPublishEmptyDataset(t *testing.T) {
+	publisher := makeDatasetPublisher(time.Minute)
+	name := testName(t, "/localhost/nfd/rib/list")
+	published, err := publisher.publish(name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contents := segmentContents(t, name, published); len(contents) != 1 || len(contents[0]) != 0 {
+		t.Errorf("empty dataset published as %d segments", len(contents))
+	}
+}
+
+func TestDatasetVersions(t *testing.T) {
+	publisher := makeDatasetPublisher(time.Minute)
+	name := testName(t, "/localhost/nfd/fib/list")
+	before := uint64(time.Now().UnixMilli())
+
+	versions := make([]*datasetVersion, 0)
+	for i := 0; i < 5; i++ {
+		published, err := publisher.publish(name, []byte{byte(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		versions = append(versions, published)
+	}
+	if versions[0].version < before {
+		t.Errorf("version %d is not a timestamp after %d", versions[0].version, before)
+	}
+	for i, published := range versions {
+		if i > 0 && published.version <= versions[i-1].version {
+			t.Errorf("version %d follows version %d", published.version, versions[i-1].version)
+		}
+		// Older versions stay cached while they are fresh, so that fetchers of an older version can finish
+		if cached := publisher.find(name, published.version); cached == nil || !bytes.Equal(segmentContents(t, name, cached)[0], []byte{byte(i)}) {
+			t.Errorf("version %d is not cached", published.version)
+		}
+	}
+}
+
+func TestDatasetExpiry(t *testing.T) {
+	publisher := makeDatasetPublisher(20 * time.Millisecond)
+	name := testName(t, "/localhost/nfd/status/general")
+	published, err := publisher.publish(name, []byte{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if publisher.find(name, published.version) == nil {
+		t.Fatal("published version is not cached")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if publisher.find(name, published.version) != nil {
+		t.Error("version is still cached after its lifetime")
+	}
+	if len(publisher.versions) != 0 {
+		t.Errorf("%d datasets are still cached after their lifetime", len(publisher.versions))
+	}
+
+	// Versions keep increasing after the cache is emptied
+	republished, err := publisher.publish(name, []byte{2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if republished.version <= published.version {
+		t.Errorf("version %d follows expired version %d", republished.version, published.version)
+	}
+}
+
+func TestIsMetadataInterest(t *testing.T) {
+	datasetName := testName(t, "/localhost/nfd/rib/list")
+	metadata := datasetName.DeepCopy().Append(ndn.NewKeywordNameComponent([]byte("metadata")))
+	for name, expected := range map[*ndn.Name]bool{
+		metadata: true,
+		datasetName.DeepCopy().Append(ndn.NewVersionNameComponent(1)):                  false,
+		datasetName.DeepCopy().Append(ndn.NewGenericNameComponent([]byte("metadata"))): false,
+		metadata.DeepCopy().Append(ndn.NewVersionNameComponent(1)):                     false,
+		datasetName.DeepCopy().Append(ndn.NewKeywordNameComponent([]byte("other"))):    false,
+		datasetName: false,
+	} {
+		if isMetadataInterest(ndn.NewInterest(name), datasetName) != expected {
+			t.Errorf("isMetadataInterest(%s) is not %t", name, expected)
+		}
+	}
+}
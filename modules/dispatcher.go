@@ -0,0 +1,116 @@
+package modules
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/named-data/YaNFD/core"
+	"github.com/named-data/YaNFD/ndn"
+)
+
+// dispatchTask is a management Interest waiting to be handled by a module.
+type dispatchTask struct {
+	module   Module
+	interest *ndn.Interest
+	pitToken []byte
+	inFace   uint64
+}
+
+// DispatchStats contains the queue metrics of the management dispatcher.
+type DispatchStats struct {
+	// Workers is the number of workers running the handlers of each module
+	Workers int
+	// QueueDepths is the number of Interests waiting for each module
+	QueueDepths map[string]int
+	Dispatched  uint64
+	Dropped     uint64
+}
+
+// dispatcher runs module handlers with workers and a queue for each module, so that a slow handler only delays later Interests for the same module. With one worker per module, the Interests for each module are processed in order.
+type dispatcher struct {
+	workers    int
+	queueSize  int
+	queues     map[string]chan *dispatchTask
+	dispatched uint64
+	dropped    uint64
+	wg         sync.WaitGroup
+}
+
+func makeDispatcher(workers int, queueSize int) *dispatcher {
+	if workers < 1 {
+		workers = 1
+	}
+	d := new(dispatcher)
+	d.workers = workers
+	d.queueSize = queueSize
+	d.queues = make(map[string]chan *dispatchTask)
+	return d
+}
+
+func (d *dispatcher) String() string {
+	return "MgmtDispatcher"
+}
+
+// addQueue creates the queue for a module. Queues must be added before the dispatcher is started.
+func (d *dispatcher) addQueue(key string) {
+	d.queues[key] = make(chan *dispatchTask, d.queueSize)
+}
+
+// start starts the workers.
+func (d *dispatcher) start() {
+	for _, queue := range d.queues {
+		for i := 0; i < d.workers; i++ {
+			d.wg.Add(1)
+			go d.runWorker(queue)
+		}
+	}
+}
+
+// stop stops accepting tasks and waits for the queued tasks to be handled.
+func (d *dispatcher) stop() {
+	for _, queue := range d.queues {
+		close(queue)
+	}
+	d.wg.Wait()
+}
+
+func (d *dispatcher) runWorker(queue chan *dispatchTask) {
+	defer d.wg.Done()
+	for task := range queue {
+		task.module.HandleIncomingInterest(task.interest, task.pitToken, task.inFace)
+	}
+}
+
+// dispatch queues a task for the module with the key. The task is dropped if the queue of that module is full, or if the module has no queue.
+func (d *dispatcher) dispatch(key string, task *dispatchTask) bool {
+	queue, ok := d.queues[key]
+	if !ok {
+		atomic.AddUint64(&d.dropped, 1)
+		core.LogWarn(d, "No queue for ", key, " - DROP")
+		return false
+	}
+
+	select {
+	case queue <- task:
+		atomic.AddUint64(&d.dispatched, 1)
+		core.LogTrace(d, "Queued Interest for ", key, ", QueueDepth=", len(queue))
+		return true
+	default:
+		atomic.AddUint64(&d.dropped, 1)
+		core.LogWarn(d, "Queue for ", key, " is full - DROP")
+		return false
+	}
+}
+
+func (d *dispatcher) stats() DispatchStats {
+	stats := DispatchStats{
+		Workers:     d.workers,
+		QueueDepths: make(map[string]int, len(d.queues)),
+		Dispatched:  atomic.LoadUint64(&d.dispatched),
+		Dropped:     atomic.LoadUint64(&d.dropped),
+	}
+	for key, queue := range d.queues {
+		stats.QueueDepths[key] = len(queue)
+	}
+	return stats
+}
@@ -0,0 +1,145 @@
+package modules
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/named-data/YaNFD/ndn"
+)
+
+// blockingModule is a module whose handler blocks on Interests for its "block" verb until they are released, and handles others at once.
+type blockingModule struct {
+	blocked chan *ndn.Interest
+	mutex   sync.Mutex
+	gate    chan struct{}
+}
+
+func makeBlockingModule() *blockingModule {
+	b := new(blockingModule)
+	b.blocked = make(chan *ndn.Interest, 16)
+	b.gate = make(chan struct{})
+	return b
+}
+
+func (b *blockingModule) String() string {
+	return "BlockingModule"
+}
+
+func (b *blockingModule) RegisterManager(manager *Thread) {
+}
+
+func (b *blockingModule) GetManager() *Thread {
+	return nil
+}
+
+func (b *blockingModule) HandleIncomingInterest(interest *ndn.Interest, pitToken []byte, inFace uint64) {
+	if interest.Name().At(-1).String() != "block" {
+		return
+	}
+	b.mutex.Lock()
+	gate := b.gate
+	b.mutex.Unlock()
+	b.blocked <- interest
+	<-gate
+}
+
+// release unblocks the handlers blocked so far. Later Interests block until the next release.
+func (b *blockingModule) release() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	close(b.gate)
+	b.gate = make(chan struct{})
+}
+
+// waitBlocked waits until the handler blocks on an Interest.
+func (b *blockingModule) waitBlocked(t *testing.T) {
+	t.Helper()
+	select {
+	case <-b.blocked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler did not block on an Interest")
+	}
+}
+
+// dispatchTestInterest dispatches an Interest for the verb of the module with the key.
+func dispatchTestInterest(t *testing.T, d *dispatcher, key string, module Module, verb string) bool {
+	t.Helper()
+	return d.dispatch(key, &dispatchTask{
+		module:   module,
+		interest: ndn.NewInterest(testName(t, localPrefix+"/"+key+"/"+verb)),
+	})
+}
+
+func TestDispatcherIsolatesModules(t *testing.T) {
+	slow, fast := makeBlockingModule(), makeBlockingModule()
+	d := makeDispatcher(1, 4)
+	d.addQueue("slow")
+	d.addQueue("fast")
+	d.start()
+	defer d.stop()
+	defer slow.release()
+	defer fast.release()
+
+	if !dispatchTestInterest(t, d, "slow", slow, "block") {
+		t.Fatal("Interest for slow module was not dispatched")
+	}
+	slow.waitBlocked(t)
+	// The slow module is still handling its Interest, which must not delay the other module
+	if !dispatchTestInterest(t, d, "fast", fast, "block") {
+		t.Fatal("Interest for fast module was not dispatched")
+	}
+	fast.waitBlocked(t)
+}
+
+func TestDispatcherQueueFull(t *testing.T) {
+	module := makeBlockingModule()
+	d := makeDispatcher(1, 2)
+	d.addQueue("blocking")
+	d.start()
+	defer d.stop()
+	defer module.release()
+
+	if !dispatchTestInterest(t, d, "blocking", module, "block") {
+		t.Fatal("first Interest was not dispatched")
+	}
+	module.waitBlocked(t)
+	for i := 0; i < 2; i++ {
+		if !dispatchTestInterest(t, d, "blocking", module, "verb") {
+			t.Fatalf("Interest %d was not queued", i)
+		}
+	}
+	if dispatchTestInterest(t, d, "blocking", module, "verb") {
+		t.Error("Interest was queued beyond the queue size")
+	}
+	if dispatchTestInterest(t, d, "unknown", module, "verb") {
+		t.Error("Interest was dispatched to a module without a queue")
+	}
+
+	stats := d.stats()
+	if stats.Dispatched != 3 || stats.Dropped != 2 || stats.QueueDepths["blocking"] != 2 || stats.Workers != 1 {
+		t.Errorf("stats are %+v", stats)
+	}
+}
+
+func TestDispatcherWorkers(t *testing.T) {
+	module := makeBlockingModule()
+	d := makeDispatcher(3, 4)
+	d.addQueue("blocking")
+	d.start()
+	defer d.stop()
+	defer module.release()
+
+	// Each worker handles one of the Interests at the same time
+	for i := 0; i < 3; i++ {
+		if !dispatchTestInterest(t, d, "blocking", module, "block") {
+			t.Fatalf("Interest %d was not dispatched", i)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		module.waitBlocked(t)
+	}
+	if depth := d.stats().QueueDepths["blocking"]; depth != 0 {
+		t.Errorf("%d Interests are waiting with idle workers", depth)
+	}
+}
@@ -0,0 +1,71 @@
+package modules
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/amazingtapioca17/mgmt/mgmtconn"
+	"github.com/named-data/YaNFD/face"
+	"github.com/named-data/YaNFD/ndn/tlv"
+)
+
+// faceEventLog keeps the most recent face events reported by the forwarder, encoded as FaceEventNotifications, for the faces/events stream.
+type faceEventLog struct {
+	mutex         sync.Mutex
+	notifications [face.FaceEventsCacheSize][]byte
+	nextID        uint64
+}
+
+func makeFaceEventLog() *faceEventLog {
+	return new(faceEventLog)
+}
+
+// add appends the event to the log and returns its ID.
+func (l *faceEventLog) add(event mgmtconn.Event) (uint64, error) {
+	notification, err := encodeFaceEventNotification(event)
+	if err != nil {
+		return 0, err
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	id := l.nextID
+	l.notifications[id%face.FaceEventsCacheSize] = notification
+	l.nextID++
+	return id, nil
+}
+
+// get returns the encoded FaceEventNotification with the specified ID, or nil if it has been discarded or does not exist yet.
+func (l *faceEventLog) get(id uint64) []byte {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if id >= l.nextID || l.nextID-id > face.FaceEventsCacheSize {
+		return nil
+	}
+	return l.notifications[id%face.FaceEventsCacheSize]
+}
+
+// lastID returns the ID of the most recent event, if there has been any.
+func (l *faceEventLog) lastID() (uint64, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.nextID - 1, l.nextID > 0
+}
+
+func encodeFaceEventNotification(event mgmtconn.Event) ([]byte, error) {
+	if event.Face.URI == nil {
+		return nil, errors.New("URI is required, but unset")
+	}
+	if event.Face.LocalURI == nil {
+		return nil, errors.New("LocalUri is required, but unset")
+	}
+	wire := tlv.NewEmptyBlock(tlv.FaceEventNotification)
+	wire.Append(tlv.EncodeNNIBlock(tlv.FaceEventKind, uint64(event.Type)))
+	wire.Append(tlv.EncodeNNIBlock(tlv.FaceID, event.Face.FaceID))
+	wire.Append(tlv.NewBlock(tlv.URI, []byte(event.Face.URI.String())))
+	wire.Append(tlv.NewBlock(tlv.LocalURI, []byte(event.Face.LocalURI.String())))
+	wire.Append(tlv.EncodeNNIBlock(tlv.FaceScope, event.Face.Scope))
+	wire.Append(tlv.EncodeNNIBlock(tlv.FacePersistency, event.Face.Persistency))
+	wire.Append(tlv.EncodeNNIBlock(tlv.LinkType, event.Face.LinkType))
+	wire.Append(tlv.EncodeNNIBlock(tlv.Flags, event.Face.Flags))
+	return wire.Wire()
+}
@@ -8,6 +8,7 @@
 package modules
 
 import (
+	"context"
 	"net"
 	"time"
 
@@ -21,33 +22,44 @@ import (
 
 // FaceModule is the module that handles Face Management.
 type FaceModule struct {
-	manager                   *Thread
-	nextFaceDatasetVersion    uint64
-	nextChannelDatasetVersion uint64
+	manager  *Thread
+	eventLog *faceEventLog
 }
 
 func (f *FaceModule) String() string {
 	return "FaceMgmt"
 }
 
-func (f *FaceModule) registerManager(manager *Thread) {
+func (f *FaceModule) RegisterManager(manager *Thread) {
 	f.manager = manager
-	face.FaceEventSendFunc = f.sendFaceEventNotification
+	f.eventLog = makeFaceEventLog()
+	events, _ := mgmtconn.AcksConn.Subscribe(mgmtconn.EventFaceCreated, mgmtconn.EventFaceDestroyed, mgmtconn.EventFaceUp, mgmtconn.EventFaceDown)
+	go f.runEvents(events)
 }
 
-func (f *FaceModule) getManager() *Thread {
+// runEvents records the face events reported by the forwarder and publishes each as a FaceEventNotification.
+func (f *FaceModule) runEvents(events <-chan mgmtconn.Event) {
+	for event := range events {
+		id, err := f.eventLog.add(event)
+		if err != nil {
+			core.LogError(f, "Cannot encode FaceEventNotification for ", event.Type, " of FaceID=", event.Face.FaceID, ": ", err)
+			continue
+		}
+		f.sendFaceEventNotification(id, nil)
+	}
+}
+
+func (f *FaceModule) GetManager() *Thread {
 	return f.manager
 }
 
-func (f *FaceModule) handleIncomingInterest(interest *ndn.Interest, pitToken []byte, inFace uint64) {
-	// Only allow from /localhost
-	if !f.manager.localPrefix.PrefixOf(interest.Name()) {
-		core.LogWarn(f, "Received face management Interest from non-local source - DROP")
-		return
-	}
+func (f *FaceModule) CommandVerbs() []string {
+	return []string{"create", "update", "destroy"}
+}
 
+func (f *FaceModule) HandleIncomingInterest(interest *ndn.Interest, pitToken []byte, inFace uint64) {
 	// Dispatch by verb
-	verb := interest.Name().At(f.manager.prefixLength() + 1).String()
+	verb := interest.Name().At(f.manager.PrefixLength() + 1).String()
 	switch verb {
 	case "create":
 		f.create(interest, pitToken, inFace)
@@ -66,7 +78,7 @@ func (f *FaceModule) handleIncomingInterest(interest *ndn.Interest, pitToken []b
 	default:
 		core.LogWarn(f, "Received Interest for non-existent verb '", verb, "'")
 		response := mgmt.MakeControlResponse(501, "Unknown verb", nil)
-		f.manager.sendResponse(response, interest, pitToken, inFace)
+		f.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 }
@@ -74,63 +86,69 @@ func (f *FaceModule) handleIncomingInterest(interest *ndn.Interest, pitToken []b
 func (f *FaceModule) create(interest *ndn.Interest, pitToken []byte, inFace uint64) {
 	var response *mgmt.ControlResponse
 
-	if interest.Name().Size() < f.manager.prefixLength()+3 {
+	if interest.Name().Size() < f.manager.PrefixLength()+3 {
 		// Name not long enough to contain ControlParameters
 		core.LogWarn(f, "Missing ControlParameters in ", interest.Name())
 		response = mgmt.MakeControlResponse(400, "ControlParameters is incorrect", nil)
-		f.manager.sendResponse(response, interest, pitToken, inFace)
+		f.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
-	params := decodeControlParameters(f, interest)
+	params := DecodeControlParameters(f, interest)
 	if params == nil {
 		response = mgmt.MakeControlResponse(400, "ControlParameters is incorrect", nil)
-		f.manager.sendResponse(response, interest, pitToken, inFace)
+		f.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
 	if params.URI == nil {
 		core.LogWarn(f, "Missing URI in ControlParameters for ", interest.Name())
 		response = mgmt.MakeControlResponse(400, "ControlParameters is incorrect", nil)
-		f.manager.sendResponse(response, interest, pitToken, inFace)
+		f.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
 	if params.URI.Canonize() != nil {
 		core.LogWarn(f, "Cannot canonize remote URI in ControlParameters for ", interest.Name())
 		response = mgmt.MakeControlResponse(406, "URI could not be canonized", nil)
-		f.manager.sendResponse(response, interest, pitToken, inFace)
+		f.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
 	if (params.Flags != nil && params.Mask == nil) || (params.Flags == nil && params.Mask != nil) {
 		core.LogWarn(f, "Flags and Mask fields either both be present or both be not present")
 		response = mgmt.MakeControlResponse(409, "Incomplete Flags/Mask combination", nil)
-		f.manager.sendResponse(response, interest, pitToken, inFace)
+		f.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
 	// Ensure does not conflict with existing face
-	forwarderResponse := mgmtconn.AcksConn.CreateFace(*params)
+	ctx, cancel := f.manager.ForwarderContext()
+	defer cancel()
+	forwarderResponse, err := mgmtconn.AcksConn.CreateFace(ctx, *params)
+	if err != nil {
+		f.manager.SendResponse(ForwarderErrorResponse(f, interest, err), interest, pitToken, inFace)
+		return
+	}
 	response = &forwarderResponse
-	f.manager.sendResponse(response, interest, pitToken, inFace)
+	f.manager.SendResponse(response, interest, pitToken, inFace)
 }
 
 func (f *FaceModule) update(interest *ndn.Interest, pitToken []byte, inFace uint64) {
 	var response *mgmt.ControlResponse
 
-	if interest.Name().Size() < f.manager.prefixLength()+3 {
+	if interest.Name().Size() < f.manager.PrefixLength()+3 {
 		// Name not long enough to contain ControlParameters
 		core.LogWarn(f, "Missing ControlParameters in ", interest.Name())
 		response = mgmt.MakeControlResponse(400, "ControlParameters is incorrect", nil)
-		f.manager.sendResponse(response, interest, pitToken, inFace)
+		f.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
-	params := decodeControlParameters(f, interest)
+	params := DecodeControlParameters(f, interest)
 	if params == nil {
 		response = mgmt.MakeControlResponse(400, "ControlParameters is incorrect", nil)
-		f.manager.sendResponse(response, interest, pitToken, inFace)
+		f.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
@@ -140,37 +158,48 @@ func (f *FaceModule) update(interest *ndn.Interest, pitToken []byte, inFace uint
 	}
 
 	// Validate parameters
-	forwarderResponse := mgmtconn.AcksConn.UpdateFace(*params, faceID)
+	ctx, cancel := f.manager.ForwarderContext()
+	defer cancel()
+	forwarderResponse, err := mgmtconn.AcksConn.UpdateFace(ctx, *params, faceID)
+	if err != nil {
+		f.manager.SendResponse(ForwarderErrorResponse(f, interest, err), interest, pitToken, inFace)
+		return
+	}
 	response = &forwarderResponse
-	f.manager.sendResponse(response, interest, pitToken, inFace)
+	f.manager.SendResponse(response, interest, pitToken, inFace)
 }
 
 func (f *FaceModule) destroy(interest *ndn.Interest, pitToken []byte, inFace uint64) {
 	var response *mgmt.ControlResponse
 
-	if interest.Name().Size() < f.manager.prefixLength()+3 {
+	if interest.Name().Size() < f.manager.PrefixLength()+3 {
 		// Name not long enough to contain ControlParameters
 		core.LogWarn(f, "Missing ControlParameters in ", interest.Name())
 		response = mgmt.MakeControlResponse(400, "ControlParameters is incorrect", nil)
-		f.manager.sendResponse(response, interest, pitToken, inFace)
+		f.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
-	params := decodeControlParameters(f, interest)
+	params := DecodeControlParameters(f, interest)
 	if params == nil {
 		response = mgmt.MakeControlResponse(400, "ControlParameters is incorrect", nil)
-		f.manager.sendResponse(response, interest, pitToken, inFace)
+		f.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
 	if params.FaceID == nil {
 		core.LogWarn(f, "Missing FaceId in ControlParameters for ", interest.Name())
 		response = mgmt.MakeControlResponse(400, "ControlParameters is incorrect", nil)
-		f.manager.sendResponse(response, interest, pitToken, inFace)
+		f.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
-	mgmtconn.AcksConn.DestroyFace(*params.FaceID)
+	ctx, cancel := f.manager.ForwarderContext()
+	defer cancel()
+	if _, err := mgmtconn.AcksConn.DestroyFace(ctx, *params.FaceID); err != nil {
+		f.manager.SendResponse(ForwarderErrorResponse(f, interest, err), interest, pitToken, inFace)
+		return
+	}
 
 	responseParamsWire, err := params.Encode()
 	if err != nil {
@@ -179,60 +208,30 @@ func (f *FaceModule) destroy(interest *ndn.Interest, pitToken []byte, inFace uin
 	} else {
 		response = mgmt.MakeControlResponse(200, "OK", responseParamsWire)
 	}
-	forwarderResponse := mgmtconn.AcksConn.CreateFace(*params)
-	response = &forwarderResponse
-	f.manager.sendResponse(response, interest, pitToken, inFace)
+	f.manager.SendResponse(response, interest, pitToken, inFace)
 }
 
 func (f *FaceModule) list(interest *ndn.Interest, pitToken []byte, inFace uint64) {
-	if interest.Name().Size() > f.manager.prefixLength()+2 {
-		// Ignore because contains version and/or segment components
-		return
-	}
-
-	// Generate new dataset
-	dataset := mgmtconn.AcksConn.ListFace()
 	name, _ := ndn.NameFromString(f.manager.localPrefix.String() + "/faces/list")
-	segments := mgmt.MakeStatusDataset(name, f.nextFaceDatasetVersion, dataset)
-	for _, segment := range segments {
-		encoded, err := segment.Encode()
-		if err != nil {
-			core.LogError(f, "Unable to encode face status dataset: ", err)
-			return
-		}
-		f.manager.transport.Send(encoded, pitToken, nil)
-	}
-
-	core.LogTrace(f, "Published face dataset version=", f.nextFaceDatasetVersion, ", containing ", len(segments), " segments")
-	f.nextFaceDatasetVersion++
+	f.manager.ServeDataset(f, interest, pitToken, name, mgmtconn.AcksConn.ListFace)
 }
 
 func (f *FaceModule) query(interest *ndn.Interest, pitToken []byte, inFace uint64) {
-	if interest.Name().Size() < f.manager.prefixLength()+3 {
+	if interest.Name().Size() < f.manager.PrefixLength()+3 {
 		// Name not long enough to contain FaceQueryFilter
 		core.LogWarn(f, "Missing FaceQueryFilter in ", interest.Name())
 		return
 	}
 
-	filter, err := mgmt.DecodeFaceQueryFilterFromEncoded(interest.Name().At(f.manager.prefixLength() + 2).Value())
+	filter, err := mgmt.DecodeFaceQueryFilterFromEncoded(interest.Name().At(f.manager.PrefixLength() + 2).Value())
 	if err != nil {
 		return
 	}
 
-	dataset := mgmtconn.AcksConn.Query(*filter)
-
-	segments := mgmt.MakeStatusDataset(interest.Name(), f.nextFaceDatasetVersion, dataset)
-	for _, segment := range segments {
-		encoded, err := segment.Encode()
-		if err != nil {
-			core.LogError(f, "Unable to encode face query dataset: ", err)
-			return
-		}
-		f.manager.transport.Send(encoded, pitToken, nil)
-	}
-
-	core.LogTrace(f, "Published face query dataset version=", f.nextFaceDatasetVersion, ", containing ", len(segments), " segments")
-	f.nextFaceDatasetVersion++
+	name := interest.Name().Prefix(f.manager.PrefixLength() + 3)
+	f.manager.ServeDataset(f, interest, pitToken, name, func(ctx context.Context) ([]byte, error) {
+		return mgmtconn.AcksConn.Query(ctx, *filter)
+	})
 }
 
 func (f *FaceModule) createDataset(selectedFace face.LinkService) []byte {
@@ -292,23 +291,26 @@ func (f *FaceModule) createDataset(selectedFace face.LinkService) []byte {
 }
 
 func (f *FaceModule) channels(interest *ndn.Interest, pitToken []byte, inFace uint64) {
-	if interest.Name().Size() < f.manager.prefixLength()+2 {
+	if interest.Name().Size() < f.manager.PrefixLength()+2 {
 		core.LogWarn(f, "Channel dataset Interest too short: ", interest.Name())
 		return
 	}
 
+	name := interest.Name().Prefix(f.manager.PrefixLength() + 2)
+	f.manager.ServeDataset(f, interest, pitToken, name, f.generateChannelDataset)
+}
+
+func (f *FaceModule) generateChannelDataset(ctx context.Context) ([]byte, error) {
 	dataset := make([]byte, 0)
 	// UDP channel
 	ifaces, err := net.Interfaces()
 	if err != nil {
-		core.LogWarn(f, "Unable to access channel dataset: ", err)
-		return
+		return nil, err
 	}
 	for _, iface := range ifaces {
 		addrs, err := iface.Addrs()
 		if err != nil {
-			core.LogWarn(f, "Unable to access IP addresses for ", iface.Name, ": ", err)
-			return
+			return nil, err
 		}
 		for _, addr := range addrs {
 			ipAddr := addr.(*net.IPNet)
@@ -343,28 +345,14 @@ func (f *FaceModule) channels(interest *ndn.Interest, pitToken []byte, inFace ui
 	channel := mgmt.MakeChannelStatus(uri)
 	channelEncoded, err := channel.Encode()
 	if err != nil {
-		core.LogError(f, "Cannot encode ChannelStatus for Channel=", uri, ": ", err)
-		return
+		return nil, err
 	}
 	channelWire, err := channelEncoded.Wire()
 	if err != nil {
-		core.LogError(f, "Cannot encode ChannelStatus for Channel=", uri, ": ", err)
-		return
+		return nil, err
 	}
 	dataset = append(dataset, channelWire...)
-
-	segments := mgmt.MakeStatusDataset(interest.Name(), f.nextChannelDatasetVersion, dataset)
-	for _, segment := range segments {
-		encoded, err := segment.Encode()
-		if err != nil {
-			core.LogError(f, "Unable to encode channel dataset: ", err)
-			return
-		}
-		f.manager.transport.Send(encoded, pitToken, nil)
-	}
-
-	core.LogTrace(f, "Published channel dataset version=", f.nextChannelDatasetVersion, ", containing ", len(segments), " segments")
-	f.nextChannelDatasetVersion++
+	return dataset, nil
 }
 
 func (f *FaceModule) fillFaceProperties(params *mgmt.ControlParameters, selectedFace face.LinkService) {
@@ -395,15 +383,19 @@ func (f *FaceModule) events(interest *ndn.Interest, pitToken []byte, inFace uint
 	var id uint64 = 0
 	var err error
 
-	if interest.Name().Size() < f.manager.prefixLength()+3 {
+	if interest.Name().Size() < f.manager.PrefixLength()+3 {
 		// Name is a prefix, take the last one
-		id = face.FaceEventLastId()
+		var ok bool
+		if id, ok = f.eventLog.lastID(); !ok {
+			core.LogDebug(f, "No face events to answer ", interest.Name())
+			return
+		}
 		if !interest.CanBePrefix() {
 			core.LogInfo(f, "FaceEvent Interest with a prefix should set CanBePrefix=true: ", interest.Name())
 			return
 		}
 	} else {
-		seg, ok := interest.Name().At(f.manager.prefixLength() + 2).(*ndn.SequenceNumNameComponent)
+		seg, ok := interest.Name().At(f.manager.PrefixLength() + 2).(*ndn.SequenceNumNameComponent)
 		if !ok {
 			core.LogInfo(f, "FaceEvent Interest with an illegible event ID: ", interest.Name())
 			return
@@ -419,27 +411,12 @@ func (f *FaceModule) events(interest *ndn.Interest, pitToken []byte, inFace uint
 }
 
 func (f *FaceModule) sendFaceEventNotification(id uint64, pitToken []byte) {
-	event := face.GetFaceEvent(id)
-	if event == nil {
+	wire := f.eventLog.get(id)
+	if wire == nil {
 		return
 	}
 
-	eventBlock, err := event.Encode()
-	if err != nil {
-		core.LogError(f, "Cannot encode FaceEventNotification for EventID=", id, ": ", err)
-		return
-	}
-	wire, err := eventBlock.Wire()
-	if err != nil {
-		core.LogError(f, "Cannot encode FaceEventNotification for EventID=", id, ": ", err)
-		return
-	}
-
-	dataName, err := ndn.NameFromString("/localhost/nfd/faces/events")
-	if err != nil {
-		core.LogError(f, "Cannot encode FaceEventNotification name.")
-		return
-	}
+	dataName := f.manager.localPrefix.DeepCopy().Append(ndn.NewGenericNameComponent([]byte("faces"))).Append(ndn.NewGenericNameComponent([]byte("events")))
 	dataName = dataName.Append(ndn.NewSequenceNumNameComponent(id))
 	data := ndn.NewData(dataName, wire)
 	metaInfo := ndn.NewMetaInfo()
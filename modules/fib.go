@@ -16,31 +16,28 @@ import (
 
 // FIBModule is the module that handles FIB Management.
 type FIBModule struct {
-	manager               *Thread
-	nextFIBDatasetVersion uint64
+	manager *Thread
 }
 
 func (f *FIBModule) String() string {
 	return "FIBMgmt"
 }
 
-func (f *FIBModule) registerManager(manager *Thread) {
+func (f *FIBModule) RegisterManager(manager *Thread) {
 	f.manager = manager
 }
 
-func (f *FIBModule) getManager() *Thread {
+func (f *FIBModule) GetManager() *Thread {
 	return f.manager
 }
 
-func (f *FIBModule) handleIncomingInterest(interest *ndn.Interest, pitToken []byte, inFace uint64) {
-	// Only allow from /localhost
-	if !f.manager.localPrefix.PrefixOf(interest.Name()) {
-		core.LogWarn(f, "Received FIB management Interest from non-local source - DROP")
-		return
-	}
+func (f *FIBModule) CommandVerbs() []string {
+	return []string{"add-nexthop", "remove-nexthop"}
+}
 
+func (f *FIBModule) HandleIncomingInterest(interest *ndn.Interest, pitToken []byte, inFace uint64) {
 	// Dispatch by verb
-	verb := interest.Name().At(f.manager.prefixLength() + 1).String()
+	verb := interest.Name().At(f.manager.PrefixLength() + 1).String()
 	switch verb {
 	case "add-nexthop":
 		f.add(interest, pitToken, inFace)
@@ -51,7 +48,7 @@ func (f *FIBModule) handleIncomingInterest(interest *ndn.Interest, pitToken []by
 	default:
 		core.LogWarn(f, "Received Interest for non-existent verb '", verb, "'")
 		response := mgmt.MakeControlResponse(501, "Unknown verb", nil)
-		f.manager.sendResponse(response, interest, pitToken, inFace)
+		f.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 }
@@ -59,36 +56,43 @@ func (f *FIBModule) handleIncomingInterest(interest *ndn.Interest, pitToken []by
 func (f *FIBModule) add(interest *ndn.Interest, pitToken []byte, inFace uint64) {
 	var response *mgmt.ControlResponse
 
-	if interest.Name().Size() < f.manager.prefixLength()+3 {
+	if interest.Name().Size() < f.manager.PrefixLength()+3 {
 		// Name not long enough to contain ControlParameters
 		core.LogWarn(f, "Missing ControlParameters in ", interest.Name())
 		response = mgmt.MakeControlResponse(400, "ControlParameters is incorrect", nil)
-		f.manager.sendResponse(response, interest, pitToken, inFace)
+		f.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
-	params := decodeControlParameters(f, interest)
+	params := DecodeControlParameters(f, interest)
 	if params == nil {
 		response = mgmt.MakeControlResponse(400, "ControlParameters is incorrect", nil)
-		f.manager.sendResponse(response, interest, pitToken, inFace)
+		f.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
 	if params.Name == nil {
 		core.LogWarn(f, "Missing Name in ControlParameters for ", interest.Name())
 		response = mgmt.MakeControlResponse(400, "ControlParameters is incorrect", nil)
-		f.manager.sendResponse(response, interest, pitToken, inFace)
+		f.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
 	//maybe need to ask forwarder for facetable
 	//need ack comm for this
+	ctx, cancel := f.manager.ForwarderContext()
+	defer cancel()
 	faceID := inFace
 	if params.FaceID != nil && *params.FaceID != 0 {
 		faceID = *params.FaceID
-		if mgmtconn.AcksConn.GetFaceId(faceID) {
+		missing, err := mgmtconn.AcksConn.GetFaceId(ctx, faceID)
+		if err != nil {
+			f.manager.SendResponse(ForwarderErrorResponse(f, interest, err), interest, pitToken, inFace)
+			return
+		}
+		if missing {
 			response = mgmt.MakeControlResponse(410, "Face does not exist", nil)
-			f.manager.sendResponse(response, interest, pitToken, inFace)
+			f.manager.SendResponse(response, interest, pitToken, inFace)
 			return
 		}
 	}
@@ -99,7 +103,10 @@ func (f *FIBModule) add(interest *ndn.Interest, pitToken []byte, inFace uint64)
 	}
 
 	//table.FibStrategyTable.InsertNextHop(params.Name, faceID, cost)
-	mgmtconn.AcksConn.InsertNextHop(params.Name, faceID, cost)
+	if err := mgmtconn.AcksConn.InsertNextHop(ctx, params.Name, faceID, cost); err != nil {
+		f.manager.SendResponse(ForwarderErrorResponse(f, interest, err), interest, pitToken, inFace)
+		return
+	}
 	core.LogInfo(f, "Created nexthop for ", params.Name, " to FaceID=", faceID, "with Cost=", cost)
 	responseParams := mgmt.MakeControlParameters()
 	responseParams.Name = params.Name
@@ -114,31 +121,31 @@ func (f *FIBModule) add(interest *ndn.Interest, pitToken []byte, inFace uint64)
 	} else {
 		response = mgmt.MakeControlResponse(200, "OK", responseParamsWire)
 	}
-	f.manager.sendResponse(response, interest, pitToken, inFace)
+	f.manager.SendResponse(response, interest, pitToken, inFace)
 }
 
 func (f *FIBModule) remove(interest *ndn.Interest, pitToken []byte, inFace uint64) {
 	var response *mgmt.ControlResponse
 
-	if interest.Name().Size() < f.manager.prefixLength()+3 {
+	if interest.Name().Size() < f.manager.PrefixLength()+3 {
 		// Name not long enough to contain ControlParameters
 		core.LogWarn(f, "Missing ControlParameters in ", interest.Name())
 		response = mgmt.MakeControlResponse(400, "ControlParameters is incorrect", nil)
-		f.manager.sendResponse(response, interest, pitToken, inFace)
+		f.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
-	params := decodeControlParameters(f, interest)
+	params := DecodeControlParameters(f, interest)
 	if params == nil {
 		response = mgmt.MakeControlResponse(400, "ControlParameters is incorrect", nil)
-		f.manager.sendResponse(response, interest, pitToken, inFace)
+		f.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
 	if params.Name == nil {
 		core.LogWarn(f, "Missing Name in ControlParameters for ", interest.Name())
 		response = mgmt.MakeControlResponse(400, "ControlParameters is incorrect", nil)
-		f.manager.sendResponse(response, interest, pitToken, inFace)
+		f.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
@@ -148,7 +155,12 @@ func (f *FIBModule) remove(interest *ndn.Interest, pitToken []byte, inFace uint6
 	}
 
 	//table.FibStrategyTable.RemoveNextHop(params.Name, faceID)
-	mgmtconn.AcksConn.RemoveNextHop(params.Name, faceID)
+	ctx, cancel := f.manager.ForwarderContext()
+	defer cancel()
+	if err := mgmtconn.AcksConn.RemoveNextHop(ctx, params.Name, faceID); err != nil {
+		f.manager.SendResponse(ForwarderErrorResponse(f, interest, err), interest, pitToken, inFace)
+		return
+	}
 	core.LogInfo(f, "Removed nexthop for ", params.Name, " to FaceID=", faceID)
 	responseParams := mgmt.MakeControlParameters()
 	responseParams.Name = params.Name
@@ -161,32 +173,11 @@ func (f *FIBModule) remove(interest *ndn.Interest, pitToken []byte, inFace uint6
 	} else {
 		response = mgmt.MakeControlResponse(200, "OK", responseParamsWire)
 	}
-	f.manager.sendResponse(response, interest, pitToken, inFace)
+	f.manager.SendResponse(response, interest, pitToken, inFace)
 }
 
 func (f *FIBModule) list(interest *ndn.Interest, pitToken []byte, inFace uint64) {
-	if interest.Name().Size() > f.manager.prefixLength()+2 {
-		// Ignore because contains version and/or segment components
-		return
-	}
-
-	// Generate new dataset
 	// TODO: For thread safety, we should lock the FIB from writes until we are done
-	// figure out a way to get all fib entries through communication?
-	// need ack comm for this
-	dataset := mgmtconn.AcksConn.GetAllFIBEntries()
-
 	name, _ := ndn.NameFromString(f.manager.localPrefix.String() + "/fib/list")
-	segments := mgmt.MakeStatusDataset(name, f.nextFIBDatasetVersion, dataset)
-	for _, segment := range segments {
-		encoded, err := segment.Encode()
-		if err != nil {
-			core.LogError(f, "Unable to encode FIB dataset: ", err)
-			return
-		}
-		f.manager.transport.Send(encoded, pitToken, nil)
-	}
-
-	core.LogTrace(f, "Published FIB dataset version=", f.nextFIBDatasetVersion, ", containing ", len(segments), " segments")
-	f.nextFIBDatasetVersion++
+	f.manager.ServeDataset(f, interest, pitToken, name, mgmtconn.AcksConn.GetAllFIBEntries)
 }
@@ -8,14 +8,16 @@
 package modules
 
 import (
+	"github.com/amazingtapioca17/mgmt/mgmtconn"
 	"github.com/named-data/YaNFD/core"
 	"github.com/named-data/YaNFD/ndn"
 	"github.com/named-data/YaNFD/ndn/mgmt"
 	"github.com/named-data/YaNFD/ndn/tlv"
 )
 
-func decodeControlParameters(m Module, interest *ndn.Interest) *mgmt.ControlParameters {
-	paramsRaw, _, err := tlv.DecodeBlock(interest.Name().At(m.getManager().prefixLength() + 2).Value())
+// DecodeControlParameters decodes the ControlParameters following the module and verb in the name of a command Interest. It returns nil if they are missing or malformed.
+func DecodeControlParameters(m Module, interest *ndn.Interest) *mgmt.ControlParameters {
+	paramsRaw, _, err := tlv.DecodeBlock(interest.Name().At(m.GetManager().PrefixLength() + 2).Value())
 	if err != nil {
 		core.LogWarn(m, "Could not decode ControlParameters in ", interest.Name(), ": ", err)
 		return nil
@@ -27,3 +29,18 @@ func decodeControlParameters(m Module, interest *ndn.Interest) *mgmt.ControlPara
 	}
 	return params
 }
+
+// ForwarderErrorResponse returns the ControlResponse for a command that failed in the forwarder. Commands the forwarder did not reply to in time result in 503 and commands it does not support in 501, while errors reported by the forwarder are passed through.
+func ForwarderErrorResponse(m Module, interest *ndn.Interest, err error) *mgmt.ControlResponse {
+	core.LogWarn(m, "Unable to execute ", interest.Name(), " in forwarder: ", err)
+	if mgmtconn.IsUnavailable(err) {
+		return mgmt.MakeControlResponse(503, "Forwarder unavailable", nil)
+	}
+	if _, ok := err.(*mgmtconn.UnsupportedError); ok {
+		return mgmt.MakeControlResponse(501, "Not supported by forwarder", nil)
+	}
+	if forwarderErr, ok := err.(*mgmtconn.ForwarderError); ok {
+		return mgmt.MakeControlResponse(uint64(forwarderErr.Code), forwarderErr.Message, nil)
+	}
+	return mgmt.MakeControlResponse(500, "Internal error", nil)
+}
@@ -0,0 +1,208 @@
+package modules
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/named-data/YaNFD/ndn"
+	"github.com/named-data/YaNFD/ndn/mgmt"
+	"github.com/named-data/YaNFD/ndn/security"
+	"github.com/named-data/YaNFD/ndn/tlv"
+)
+
+// testSigner signs command Interests with an ECDSA key.
+type testSigner struct {
+	keyName *ndn.Name
+	key     *ecdsa.PrivateKey
+	mutex   sync.Mutex
+	// lastTime is the SignatureTime of the last command, which must increase for the command to be accepted
+	lastTime time.Time
+}
+
+func makeTestSigner(identity string) (*testSigner, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	keyName, err := ndn.NameFromString(identity + "/KEY/test-key")
+	if err != nil {
+		return nil, err
+	}
+	return &testSigner{keyName: keyName, key: key}, nil
+}
+
+// writeCertificate writes a self-signed certificate for the key to the file.
+func (s *testSigner) writeCertificate(file string) error {
+	content, err := x509.MarshalPKIXPublicKey(&s.key.PublicKey)
+	if err != nil {
+		return err
+	}
+	name := s.keyName.DeepCopy()
+	name.Append(ndn.NewGenericNameComponent([]byte("self")))
+	name.Append(ndn.NewVersionNameComponent(1))
+	block, err := ndn.NewData(name, content).Encode()
+	if err != nil {
+		return err
+	}
+	wire, err := block.Wire()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, wire, 0600)
+}
+
+// issueCertificate writes a certificate for the key of the subject to the file, signed by the key of the signer and valid between the specified times.
+func (s *testSigner) issueCertificate(file string, subject *testSigner, notBefore time.Time, notAfter time.Time) error {
+	content, err := x509.MarshalPKIXPublicKey(&subject.key.PublicKey)
+	if err != nil {
+		return err
+	}
+	name := subject.keyName.DeepCopy()
+	name.Append(ndn.NewGenericNameComponent([]byte("issuer")))
+	name.Append(ndn.NewVersionNameComponent(1))
+
+	keyLocator := tlv.NewEmptyBlock(tlv.KeyLocator)
+	keyLocator.Append(s.keyName.Encode())
+	validityPeriod := tlv.NewEmptyBlock(tlv.ValidityPeriod)
+	validityPeriod.Append(tlv.NewBlock(tlv.NotBefore, []byte(notBefore.UTC().Format(certificateTimeLayout))))
+	validityPeriod.Append(tlv.NewBlock(tlv.NotAfter, []byte(notAfter.UTC().Format(certificateTimeLayout))))
+	sigInfo := tlv.NewEmptyBlock(tlv.SignatureInfo)
+	sigInfo.Append(tlv.EncodeNNIBlock(tlv.SignatureType, uint64(security.SignatureSha256WithEcdsaType)))
+	sigInfo.Append(keyLocator)
+	sigInfo.Append(validityPeriod)
+
+	// The signed portion is the Name, Content, and SignatureInfo
+	signedPortion := make([]byte, 0)
+	for _, block := range []*tlv.Block{name.Encode(), tlv.NewBlock(tlv.Content, content), sigInfo} {
+		wire, err := block.Wire()
+		if err != nil {
+			return err
+		}
+		signedPortion = append(signedPortion, wire...)
+	}
+	digest := sha256.Sum256(signedPortion)
+	signature, err := ecdsa.SignASN1(rand.Reader, s.key, digest[:])
+	if err != nil {
+		return err
+	}
+	signatureValue, err := tlv.NewBlock(tlv.SignatureValue, signature).Wire()
+	if err != nil {
+		return err
+	}
+	wire, err := tlv.NewBlock(tlv.Data, append(signedPortion, signatureValue...)).Wire()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, wire, 0600)
+}
+
+// command returns a command Interest for the verb of the module under the local prefix, signed as specified in the NDN signed Interest format.
+func (s *testSigner) command(module string, verb string, params *mgmt.ControlParameters) (*ndn.Interest, error) {
+	return s.commandUnder(localPrefix, module, verb, params)
+}
+
+// commandUnder returns a signed command Interest for the verb of the module under the management prefix.
+func (s *testSigner) commandUnder(prefix string, module string, verb string, params *mgmt.ControlParameters) (*ndn.Interest, error) {
+	name, err := ndn.NameFromString(prefix + "/" + module + "/" + verb)
+	if err != nil {
+		return nil, err
+	}
+	encodedParams, err := params.Encode()
+	if err != nil {
+		return nil, err
+	}
+	paramsWire, err := encodedParams.Wire()
+	if err != nil {
+		return nil, err
+	}
+	name.Append(ndn.NewGenericNameComponent(paramsWire))
+	return s.sign(name)
+}
+
+// sign returns an Interest for the name with the parameters, signed as specified in the NDN signed Interest format.
+func (s *testSigner) sign(name *ndn.Name, parameters ...*tlv.Block) (*ndn.Interest, error) {
+	// The digest is computed when parameters are appended, but YaNFD can only replace an existing digest component in a name of generic components
+	name.Append(ndn.NewParametersSha256DigestComponent(make([]byte, sha256.Size)))
+	interest := ndn.NewInterest(name)
+	for _, parameter := range parameters {
+		interest.AppendApplicationParameter(parameter)
+	}
+
+	s.mutex.Lock()
+	signatureTime := time.Now().Truncate(time.Millisecond)
+	if !signatureTime.After(s.lastTime) {
+		signatureTime = s.lastTime.Add(time.Millisecond)
+	}
+	s.lastTime = signatureTime
+	s.mutex.Unlock()
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	keyLocator := tlv.NewEmptyBlock(tlv.KeyLocator)
+	keyLocator.Append(s.keyName.Encode())
+	sigInfo := tlv.NewEmptyBlock(tlv.InterestSignatureInfo)
+	sigInfo.Append(tlv.EncodeNNIBlock(tlv.SignatureType, uint64(security.SignatureSha256WithEcdsaType)))
+	sigInfo.Append(keyLocator)
+	sigInfo.Append(tlv.NewBlock(tlv.SignatureNonce, nonce))
+	sigInfo.Append(tlv.EncodeNNIBlock(tlv.SignatureTime, uint64(signatureTime.UnixMilli())))
+	interest.AppendApplicationParameter(sigInfo)
+
+	// The signed portion is the name without the ParametersSha256DigestComponent, followed by the parameters up to InterestSignatureInfo
+	signedPortion := make([]byte, 0)
+	for i := 0; i < interest.Name().Size(); i++ {
+		component := interest.Name().At(i)
+		if component.Type() == tlv.ParametersSha256DigestComponent {
+			continue
+		}
+		wire, err := component.Encode().Wire()
+		if err != nil {
+			return nil, err
+		}
+		signedPortion = append(signedPortion, wire...)
+	}
+	for _, param := range interest.ApplicationParameters() {
+		param := param
+		wire, err := param.Wire()
+		if err != nil {
+			return nil, err
+		}
+		signedPortion = append(signedPortion, wire...)
+	}
+	digest := sha256.Sum256(signedPortion)
+	signature, err := ecdsa.SignASN1(rand.Reader, s.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	interest.AppendApplicationParameter(tlv.NewBlock(tlv.InterestSignatureValue, signature))
+	return interest, nil
+}
+
+func makeTestSigners(t *testing.T, identities ...string) []*testSigner {
+	t.Helper()
+	signers := make([]*testSigner, 0, len(identities))
+	for _, identity := range identities {
+		signer, err := makeTestSigner(identity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signers = append(signers, signer)
+	}
+	return signers
+}
+
+func testName(t *testing.T, name string) *ndn.Name {
+	t.Helper()
+	parsed, err := ndn.NameFromString(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
@@ -8,13 +8,177 @@
 package modules
 
 import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/amazingtapioca17/mgmt/peercred"
 	"github.com/named-data/YaNFD/core"
+	"github.com/named-data/YaNFD/ndn"
 )
 
+// builtinModules contains the names of the modules registered by MakeMgmtThread.
+var builtinModules = []string{"cs", "faces", "fib", "rib", "status", "strategy-choice"}
+
+// localPrefix is the management prefix for local commands.
+var localPrefix = "/localhost/nfd"
+
+// localhopPrefix is the management prefix for commands from neighbors.
+var localhopPrefix = "/localhop/nfd"
+
+// forwarderSocket is the path of the forwarder socket that management Interests are received on.
+var forwarderSocket = "/run/nfd.sock"
+
+// legacyPort is the UDP address of the legacy text command channel.
+var legacyPort = ":1080"
+
+// disabledModules contains the names of the built-in modules that are not registered.
+var disabledModules = map[string]bool{}
+
 // enableLocalhopManagement determines whether management will listen for command and dataset Interests on non-local faces.
 var enableLocalhopManagement bool
 
-// Configure configures the face system.
-func Configure() {
+// dispatchWorkers is the number of workers that run the handlers of each module concurrently.
+var dispatchWorkers = 1
+
+// dispatchQueueSize is the number of Interests that may wait for each module.
+var dispatchQueueSize = 1024
+
+// datasetCacheLifetime is how long generated status dataset versions are kept to answer segment Interests.
+var datasetCacheLifetime = 10 * time.Second
+
+// forwarderTimeout is how long modules wait for the forwarder to reply to a command.
+var forwarderTimeout = 4 * time.Second
+
+// sharedMemorySize is the size of each ring of the shared memory segment offered to the forwarder for packets, or 0 to only use the forwarder socket.
+var sharedMemorySize = 0
+
+// forwarderPeers are the processes allowed on the other end of the forwarder socket.
+var forwarderPeers *peercred.Allowlist
+
+// trustAnchorFiles contains the paths of the certificates trusted to sign control commands.
+var trustAnchorFiles []string
+
+// certificateFiles contains the paths of the certificates of keys that may sign control commands if their certificate chain leads to a trust anchor.
+var certificateFiles []string
+
+// localhopTrustSchemaFile is the path of the trust schema that localhop commands must satisfy.
+var localhopTrustSchemaFile string
+
+// commandPolicyFile is the path of the policy file mapping signing keys to allowed commands. If empty, all validly signed commands are allowed.
+var commandPolicyFile string
+
+// commandGracePeriod is how far the SignatureTime of the first command from a key may be from the current time.
+var commandGracePeriod = 60 * time.Second
+
+// commandRecordLifetime is how long the last command from a key is remembered for replay protection.
+var commandRecordLifetime = 1 * time.Hour
+
+// maxCommandRecords is the maximum number of keys remembered for replay protection.
+var maxCommandRecords = 1000
+
+// Configure configures the management thread and validates the configuration.
+func Configure() error {
+	localPrefix = core.GetConfigStringDefault("mgmt.local_prefix", "/localhost/nfd")
+	localhopPrefix = core.GetConfigStringDefault("mgmt.localhop_prefix", "/localhop/nfd")
+	forwarderSocket = core.GetConfigStringDefault("mgmt.forwarder_socket", "/run/nfd.sock")
+	legacyPort = core.GetConfigStringDefault("mgmt.port", ":1080")
 	enableLocalhopManagement = core.GetConfigBoolDefault("mgmt.allow_localhop", false)
+	dispatchWorkers = core.GetConfigIntDefault("mgmt.dispatch_workers", 1)
+	dispatchQueueSize = core.GetConfigIntDefault("mgmt.dispatch_queue_size", 1024)
+	datasetCacheLifetime = time.Duration(core.GetConfigIntDefault("mgmt.dataset_cache_lifetime", 10000)) * time.Millisecond
+	forwarderTimeout = time.Duration(core.GetConfigIntDefault("mgmt.forwarder_timeout", 4000)) * time.Millisecond
+	sharedMemorySize = core.GetConfigIntDefault("mgmt.shared_memory_size", 0)
+	peers, err := peercred.ParseAllowlist(core.GetConfigArrayString("mgmt.forwarder_peers"))
+	if err != nil {
+		return errors.New("mgmt.forwarder_peers: " + err.Error())
+	}
+	forwarderPeers = peers
+
+	disabledModules = map[string]bool{}
+	for _, name := range core.GetConfigArrayString("mgmt.disabled_modules") {
+		disabledModules[name] = true
+	}
+
+	trustAnchorFiles = nil
+	for _, file := range core.GetConfigArrayString("mgmt.trust_anchors") {
+		trustAnchorFiles = append(trustAnchorFiles, core.ResolveConfigFileRelPath(file))
+	}
+	certificateFiles = nil
+	for _, file := range core.GetConfigArrayString("mgmt.certificates") {
+		certificateFiles = append(certificateFiles, core.ResolveConfigFileRelPath(file))
+	}
+	localhopTrustSchemaFile = core.GetConfigStringDefault("mgmt.localhop_trust_schema", "")
+	if localhopTrustSchemaFile != "" {
+		localhopTrustSchemaFile = core.ResolveConfigFileRelPath(localhopTrustSchemaFile)
+	}
+	commandPolicyFile = core.GetConfigStringDefault("mgmt.policy", "")
+	if commandPolicyFile != "" {
+		commandPolicyFile = core.ResolveConfigFileRelPath(commandPolicyFile)
+	}
+	commandGracePeriod = time.Duration(core.GetConfigIntDefault("mgmt.command_grace_period", 60)) * time.Second
+	commandRecordLifetime = time.Duration(core.GetConfigIntDefault("mgmt.command_record_lifetime", 3600)) * time.Second
+	maxCommandRecords = core.GetConfigIntDefault("mgmt.command_max_records", 1000)
+
+	return validateConfig()
+}
+
+// validateConfig checks that the configured values are usable.
+func validateConfig() error {
+	local, err := ndn.NameFromString(localPrefix)
+	if err != nil || local.Size() == 0 {
+		return errors.New("mgmt.local_prefix '" + localPrefix + "' is not a valid name")
+	}
+	localhop, err := ndn.NameFromString(localhopPrefix)
+	if err != nil || localhop.Size() == 0 {
+		return errors.New("mgmt.localhop_prefix '" + localhopPrefix + "' is not a valid name")
+	}
+	if local.Size() != localhop.Size() {
+		return errors.New("mgmt.local_prefix and mgmt.localhop_prefix must have the same number of components")
+	}
+	if forwarderSocket == "" {
+		return errors.New("mgmt.forwarder_socket must not be empty")
+	}
+	if dispatchWorkers < 1 {
+		return errors.New("mgmt.dispatch_workers must be positive")
+	}
+	if dispatchQueueSize < 1 {
+		return errors.New("mgmt.dispatch_queue_size must be positive")
+	}
+	if forwarderTimeout <= 0 {
+		return errors.New("mgmt.forwarder_timeout must be positive")
+	}
+	if sharedMemorySize < 0 {
+		return errors.New("mgmt.shared_memory_size must not be negative")
+	}
+	if datasetCacheLifetime <= 0 || commandGracePeriod <= 0 || commandRecordLifetime <= 0 || maxCommandRecords < 1 {
+		return errors.New("dataset cache and command record settings must be positive")
+	}
+
+	for name := range disabledModules {
+		isBuiltin := false
+		for _, builtin := range builtinModules {
+			isBuiltin = isBuiltin || builtin == name
+		}
+		if !isBuiltin {
+			return errors.New("mgmt.disabled_modules contains unknown module '" + name + "'")
+		}
+	}
+
+	files := append(append([]string{}, trustAnchorFiles...), certificateFiles...)
+	if commandPolicyFile != "" {
+		files = append(files, commandPolicyFile)
+	}
+	if enableLocalhopManagement && localhopTrustSchemaFile != "" {
+		files = append(files, localhopTrustSchemaFile)
+	}
+	for _, file := range files {
+		if _, err := os.Stat(file); err != nil {
+			return err
+		}
+	}
+	if len(trustAnchorFiles) == 0 {
+		core.LogWarn("Config", "No trust anchors are configured, so all control commands will be rejected")
+	}
+	return nil
 }
@@ -9,10 +9,16 @@ package modules
 
 import "github.com/named-data/YaNFD/ndn"
 
-// Module represents a management module
+// Module represents a management module. Modules outside of this package can be added with Thread.RegisterModule.
 type Module interface {
 	String() string
-	registerManager(manager *Thread)
-	getManager() *Thread
-	handleIncomingInterest(interest *ndn.Interest, pitToken []byte, inFace uint64)
+	RegisterManager(manager *Thread)
+	GetManager() *Thread
+	HandleIncomingInterest(interest *ndn.Interest, pitToken []byte, inFace uint64)
+}
+
+// CommandModule is a management module that accepts control commands. Interests for the verbs it returns must be signed and authorized before they are passed to the module.
+type CommandModule interface {
+	Module
+	CommandVerbs() []string
 }
@@ -0,0 +1,138 @@
+package modules
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/named-data/YaNFD/core"
+	"github.com/named-data/YaNFD/ndn"
+	"github.com/named-data/YaNFD/ndn/mgmt"
+	"github.com/named-data/YaNFD/ndn/tlv"
+	"github.com/pelletier/go-toml"
+)
+
+// policyRule grants the keys under a name prefix access to a set of module/verb pairs.
+type policyRule struct {
+	signer *ndn.Name
+	// allow contains "module/verb", "module/*", or "*" entries.
+	allow []string
+	// ownPrefix restricts the commands to names under the identity of the signing key.
+	ownPrefix bool
+}
+
+// commandPolicy maps signing keys to the commands they are authorized to issue.
+type commandPolicy struct {
+	rules []*policyRule
+}
+
+func (p *commandPolicy) String() string {
+	return "CommandPolicy"
+}
+
+// loadCommandPolicy loads a policy file in the following format:
+//
+//	[[rule]]
+//	signer = "/example/ops"
+//	allow = ["*"]
+//
+//	[[rule]]
+//	signer = "/example/apps"
+//	allow = ["rib/register", "rib/unregister"]
+//	own_prefix = true
+func loadCommandPolicy(file string) (*commandPolicy, error) {
+	tree, err := toml.LoadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		Rules []struct {
+			Signer    string   `toml:"signer"`
+			Allow     []string `toml:"allow"`
+			OwnPrefix bool     `toml:"own_prefix"`
+		} `toml:"rule"`
+	}
+	if err := tree.Unmarshal(&config); err != nil {
+		return nil, err
+	}
+
+	p := new(commandPolicy)
+	for _, rawRule := range config.Rules {
+		signer, err := ndn.NameFromString(rawRule.Signer)
+		if err != nil {
+			return nil, err
+		}
+		for _, allowed := range rawRule.Allow {
+			if allowed != "*" && strings.Count(allowed, "/") != 1 {
+				return nil, errors.New("invalid allow entry '" + allowed + "' for signer " + rawRule.Signer)
+			}
+		}
+		p.rules = append(p.rules, &policyRule{
+			signer:    signer,
+			allow:     rawRule.Allow,
+			ownPrefix: rawRule.OwnPrefix,
+		})
+	}
+	core.LogInfo(p, "Loaded ", len(p.rules), " rules from ", file)
+	return p, nil
+}
+
+func (r *policyRule) allows(moduleName string, verb string) bool {
+	for _, allowed := range r.allow {
+		if allowed == "*" || allowed == moduleName+"/*" || allowed == moduleName+"/"+verb {
+			return true
+		}
+	}
+	return false
+}
+
+// keyIdentity returns the identity of a key name of the form /<identity>/KEY/<key-id>.
+func keyIdentity(keyName *ndn.Name) *ndn.Name {
+	for i := keyName.Size() - 1; i >= 0; i-- {
+		if keyName.At(i).String() == "KEY" {
+			return keyName.Prefix(i)
+		}
+	}
+	return keyName
+}
+
+// authorize returns whether the key that signed the command may issue it. target is the name the command operates on, or nil if it has none.
+func (p *commandPolicy) authorize(keyName *ndn.Name, moduleName string, verb string, target *ndn.Name) bool {
+	for _, rule := range p.rules {
+		if !rule.signer.PrefixOf(keyName) || !rule.allows(moduleName, verb) {
+			continue
+		}
+		if rule.ownPrefix && (target == nil || !keyIdentity(keyName).PrefixOf(target)) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// commandTarget returns the name that a control command operates on, or nil if it does not have one.
+func (m *Thread) commandTarget(interest *ndn.Interest, verb string) *ndn.Name {
+	if verb == "announce" {
+		data := prefixAnnouncementParameter(interest)
+		if data == nil {
+			return nil
+		}
+		prefixAnnouncement, err := ndn.DecodePrefixAnnouncement(data)
+		if err != nil {
+			return nil
+		}
+		return prefixAnnouncement.Prefix()
+	}
+
+	if interest.Name().Size() < m.PrefixLength()+3 {
+		return nil
+	}
+	paramsRaw, _, err := tlv.DecodeBlock(interest.Name().At(m.PrefixLength() + 2).Value())
+	if err != nil {
+		return nil
+	}
+	params, err := mgmt.DecodeControlParameters(paramsRaw)
+	if err != nil {
+		return nil
+	}
+	return params.Name
+}
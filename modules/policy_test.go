@@ -0,0 +1,88 @@
+package modules
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/named-data/YaNFD/ndn"
+)
+
+// loadTestCommandPolicy writes the command policy to a file and loads it.
+func loadTestCommandPolicy(t *testing.T, policy string) *commandPolicy {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "policy.toml")
+	if err := os.WriteFile(file, []byte(policy), 0600); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadCommandPolicy(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loaded
+}
+
+func TestCommandPolicyAuthorize(t *testing.T) {
+	policy := loadTestCommandPolicy(t, `
+[[rule]]
+signer = "/example/ops"
+allow = ["*"]
+
+[[rule]]
+signer = "/example/monitor"
+allow = ["cs/*"]
+
+[[rule]]
+signer = "/example/apps"
+allow = ["rib/register", "rib/unregister"]
+own_prefix = true
+`)
+	for _, test := range []struct {
+		key      string
+		module   string
+		verb     string
+		target   string
+		expected bool
+	}{
+		// Allowed by "*"
+		{"/example/ops/KEY/k1", "faces", "create", "", true},
+		{"/example/ops/site/KEY/k2", "rib", "register", "/anything", true},
+		// Allowed by a wildcard verb, and denied for other modules
+		{"/example/monitor/KEY/k3", "cs", "config", "", true},
+		{"/example/monitor/KEY/k3", "cs", "erase", "", true},
+		{"/example/monitor/KEY/k3", "fib", "add-nexthop", "/example", false},
+		// Allowed verbs, only under the identity of the key
+		{"/example/apps/chat/KEY/k4", "rib", "register", "/example/apps/chat/room", true},
+		{"/example/apps/chat/KEY/k4", "rib", "unregister", "/example/apps/chat", true},
+		{"/example/apps/chat/KEY/k4", "rib", "register", "/example/apps/mail", false},
+		{"/example/apps/chat/KEY/k4", "rib", "register", "", false},
+		{"/example/apps/chat/KEY/k4", "rib", "announce", "/example/apps/chat", false},
+		// Denied by default to keys no rule applies to
+		{"/example/KEY/k5", "rib", "register", "/example", false},
+		{"/other/ops/KEY/k6", "faces", "create", "", false},
+	} {
+		var target *ndn.Name
+		if test.target != "" {
+			target = testName(t, test.target)
+		}
+		if policy.authorize(testName(t, test.key), test.module, test.verb, target) != test.expected {
+			t.Errorf("authorization of %s/%s by %s for %q is not %t", test.module, test.verb, test.key, test.target, test.expected)
+		}
+	}
+}
+
+func TestInvalidCommandPolicy(t *testing.T) {
+	for _, policy := range []string{
+		"[[rule]]\nsigner = \"/example\"\nallow = [\"rib\"]\n",
+		"[[rule]]\nsigner = \"/example\"\nallow = [\"rib/register/extra\"]\n",
+		"[[rule]]\nsigner = \"/example\"\nallow = \"*\"\n",
+	} {
+		file := filepath.Join(t.TempDir(), "policy.toml")
+		if err := os.WriteFile(file, []byte(policy), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadCommandPolicy(file); err == nil {
+			t.Errorf("invalid policy accepted: %s", policy)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package modules
+
+import (
+	"container/list"
+	"errors"
+	"time"
+)
+
+var (
+	errCommandOutOfGrace = errors.New("SignatureTime is outside of the grace period")
+	errCommandReplayed   = errors.New("command is replayed or reordered")
+)
+
+// replayRecord tracks the most recent command accepted from a signing key.
+type replayRecord struct {
+	keyName  string
+	time     time.Time
+	seqNum   *uint64
+	lastUsed time.Time
+}
+
+// replayStore rejects replayed and reordered commands, in the same manner as NFD's CommandInterestValidator.
+type replayStore struct {
+	gracePeriod    time.Duration
+	recordLifetime time.Duration
+	maxRecords     int
+	records        map[string]*list.Element
+	lru            *list.List
+}
+
+func makeReplayStore(gracePeriod time.Duration, recordLifetime time.Duration, maxRecords int) *replayStore {
+	r := new(replayStore)
+	r.gracePeriod = gracePeriod
+	r.recordLifetime = recordLifetime
+	r.maxRecords = maxRecords
+	r.records = make(map[string]*list.Element)
+	r.lru = list.New()
+	return r
+}
+
+// expire removes records that have not been used within the record lifetime.
+func (r *replayStore) expire(now time.Time) {
+	for r.lru.Len() > 0 {
+		oldest := r.lru.Back().Value.(*replayRecord)
+		if now.Sub(oldest.lastUsed) < r.recordLifetime {
+			break
+		}
+		delete(r.records, oldest.keyName)
+		r.lru.Remove(r.lru.Back())
+	}
+}
+
+// check returns whether the command signature is newer than the last accepted command from the same key.
+func (r *replayStore) check(signature *commandSignature) error {
+	now := time.Now()
+	r.expire(now)
+
+	element, ok := r.records[signature.keyName.String()]
+	if !ok {
+		// First command seen from this key, so the timestamp must be close to the current time
+		if signature.time.Before(now.Add(-r.gracePeriod)) || signature.time.After(now.Add(r.gracePeriod)) {
+			return errCommandOutOfGrace
+		}
+		return nil
+	}
+
+	record := element.Value.(*replayRecord)
+	if !signature.time.After(record.time) {
+		return errCommandReplayed
+	}
+	if signature.seqNum != nil && record.seqNum != nil && *signature.seqNum <= *record.seqNum {
+		return errCommandReplayed
+	}
+	return nil
+}
+
+// commit records the command signature as the last accepted command from its key.
+func (r *replayStore) commit(signature *commandSignature) {
+	now := time.Now()
+	keyName := signature.keyName.String()
+	if element, ok := r.records[keyName]; ok {
+		record := element.Value.(*replayRecord)
+		record.time = signature.time
+		if signature.seqNum != nil {
+			record.seqNum = signature.seqNum
+		}
+		record.lastUsed = now
+		r.lru.MoveToFront(element)
+		return
+	}
+
+	r.records[keyName] = r.lru.PushFront(&replayRecord{
+		keyName:  keyName,
+		time:     signature.time,
+		seqNum:   signature.seqNum,
+		lastUsed: now,
+	})
+	for r.lru.Len() > r.maxRecords {
+		delete(r.records, r.lru.Back().Value.(*replayRecord).keyName)
+		r.lru.Remove(r.lru.Back())
+	}
+}
@@ -8,12 +8,13 @@
 package modules
 
 import (
+	"context"
 	"strconv"
 	"time"
 
+	"github.com/amazingtapioca17/mgmt/mgmtconn"
 	customrib "github.com/amazingtapioca17/mgmt/table"
 	"github.com/named-data/YaNFD/core"
-	"github.com/named-data/YaNFD/face"
 	"github.com/named-data/YaNFD/ndn"
 	"github.com/named-data/YaNFD/ndn/mgmt"
 	"github.com/named-data/YaNFD/ndn/tlv"
@@ -22,25 +23,28 @@ import (
 
 // RIBModule is the module that handles RIB Management.
 type RIBModule struct {
-	manager               *Thread
-	nextRIBDatasetVersion uint64
+	manager *Thread
 }
 
 func (r *RIBModule) String() string {
 	return "RIBMgmt"
 }
 
-func (r *RIBModule) registerManager(manager *Thread) {
+func (r *RIBModule) RegisterManager(manager *Thread) {
 	r.manager = manager
 }
 
-func (r *RIBModule) getManager() *Thread {
+func (r *RIBModule) GetManager() *Thread {
 	return r.manager
 }
 
-func (r *RIBModule) handleIncomingInterest(interest *ndn.Interest, pitToken []byte, inFace uint64) {
+func (r *RIBModule) CommandVerbs() []string {
+	return []string{"register", "unregister", "announce"}
+}
+
+func (r *RIBModule) HandleIncomingInterest(interest *ndn.Interest, pitToken []byte, inFace uint64) {
 	// Dispatch by verb
-	verb := interest.Name().At(r.manager.prefixLength() + 1).String()
+	verb := interest.Name().At(r.manager.PrefixLength() + 1).String()
 	switch verb {
 	case "register":
 		r.register(interest, pitToken, inFace)
@@ -53,7 +57,7 @@ func (r *RIBModule) handleIncomingInterest(interest *ndn.Interest, pitToken []by
 	default:
 		core.LogWarn(r, "Received Interest for non-existent verb '", verb, "'")
 		response := mgmt.MakeControlResponse(501, "Unknown verb", nil)
-		r.manager.sendResponse(response, interest, pitToken, inFace)
+		r.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 }
@@ -62,34 +66,42 @@ func (r *RIBModule) register(interest *ndn.Interest, pitToken []byte, inFace uin
 	//keep in mind we are importing yanfd table here for default values, should migrate
 	var response *mgmt.ControlResponse
 
-	if interest.Name().Size() < r.manager.prefixLength()+3 {
+	if interest.Name().Size() < r.manager.PrefixLength()+3 {
 		// Name not long enough to contain ControlParameters
 		core.LogWarn(r, "Missing ControlParameters in ", interest.Name())
 		response = mgmt.MakeControlResponse(400, "ControlParameters is incorrect", nil)
-		r.manager.sendResponse(response, interest, pitToken, inFace)
+		r.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
-	params := decodeControlParameters(r, interest)
+	params := DecodeControlParameters(r, interest)
 	if params == nil {
 		response = mgmt.MakeControlResponse(400, "ControlParameters is incorrect", nil)
-		r.manager.sendResponse(response, interest, pitToken, inFace)
+		r.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
 	if params.Name == nil {
 		core.LogWarn(r, "Missing Name in ControlParameters for ", interest.Name())
 		response = mgmt.MakeControlResponse(400, "ControlParameters is incorrect", nil)
-		r.manager.sendResponse(response, interest, pitToken, inFace)
+		r.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
+	ctx, cancel := r.manager.ForwarderContext()
+	defer cancel()
 	faceID := inFace
 	if params.FaceID != nil && *params.FaceID != 0 {
 		faceID = *params.FaceID
-		if face.FaceTable.Get(faceID) == nil {
+		// The faces are in the forwarder, so it is asked whether the face exists
+		missing, err := mgmtconn.AcksConn.GetFaceId(ctx, faceID)
+		if err != nil {
+			r.manager.SendResponse(ForwarderErrorResponse(r, interest, err), interest, pitToken, inFace)
+			return
+		}
+		if missing {
 			response = mgmt.MakeControlResponse(410, "Face does not exist", nil)
-			r.manager.sendResponse(response, interest, pitToken, inFace)
+			r.manager.SendResponse(response, interest, pitToken, inFace)
 			return
 		}
 	}
@@ -116,7 +128,10 @@ func (r *RIBModule) register(interest *ndn.Interest, pitToken []byte, inFace uin
 	}
 
 	//table.Rib.AddRoute(params.Name, faceID, origin, cost, flags, expirationPeriod)
-	customrib.Rib.AddRoute(params.Name, faceID, origin, cost, flags, expirationPeriod)
+	if err := customrib.Rib.AddRoute(ctx, params.Name, faceID, origin, cost, flags, expirationPeriod); err != nil {
+		r.manager.SendResponse(ForwarderErrorResponse(r, interest, err), interest, pitToken, inFace)
+		return
+	}
 	// ack := r.manager.InsertNextHop(params.Name, faceID, cost)
 	// fmt.Println(ack, "got an ack")
 	if expirationPeriod != nil {
@@ -145,31 +160,31 @@ func (r *RIBModule) register(interest *ndn.Interest, pitToken []byte, inFace uin
 	} else {
 		response = mgmt.MakeControlResponse(200, "OK", responseParamsWire)
 	}
-	r.manager.sendResponse(response, interest, pitToken, inFace)
+	r.manager.SendResponse(response, interest, pitToken, inFace)
 }
 
 func (r *RIBModule) unregister(interest *ndn.Interest, pitToken []byte, inFace uint64) {
 	var response *mgmt.ControlResponse
 
-	if interest.Name().Size() < r.manager.prefixLength()+3 {
+	if interest.Name().Size() < r.manager.PrefixLength()+3 {
 		// Name not long enough to contain ControlParameters
 		core.LogWarn(r, "Missing ControlParameters in ", interest.Name())
 		response = mgmt.MakeControlResponse(400, "ControlParameters is incorrect", nil)
-		r.manager.sendResponse(response, interest, pitToken, inFace)
+		r.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
-	params := decodeControlParameters(r, interest)
+	params := DecodeControlParameters(r, interest)
 	if params == nil {
 		response = mgmt.MakeControlResponse(400, "ControlParameters is incorrect", nil)
-		r.manager.sendResponse(response, interest, pitToken, inFace)
+		r.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
 	if params.Name == nil {
 		core.LogWarn(r, "Missing Name in ControlParameters for ", interest.Name())
 		response = mgmt.MakeControlResponse(400, "ControlParameters is incorrect", nil)
-		r.manager.sendResponse(response, interest, pitToken, inFace)
+		r.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
@@ -184,7 +199,12 @@ func (r *RIBModule) unregister(interest *ndn.Interest, pitToken []byte, inFace u
 	}
 
 	//table.Rib.RemoveRoute(params.Name, faceID, origin)
-	customrib.Rib.RemoveRoute(params.Name, faceID, origin)
+	ctx, cancel := r.manager.ForwarderContext()
+	defer cancel()
+	if err := customrib.Rib.RemoveRoute(ctx, params.Name, faceID, origin); err != nil {
+		r.manager.SendResponse(ForwarderErrorResponse(r, interest, err), interest, pitToken, inFace)
+		return
+	}
 	core.LogInfo(r, "Removed route for Prefix=", params.Name, ", FaceID=", faceID, ", Origin=", origin)
 	responseParams := mgmt.MakeControlParameters()
 	responseParams.Name = params.Name
@@ -199,55 +219,69 @@ func (r *RIBModule) unregister(interest *ndn.Interest, pitToken []byte, inFace u
 	} else {
 		response = mgmt.MakeControlResponse(200, "OK", responseParamsWire)
 	}
-	r.manager.sendResponse(response, interest, pitToken, inFace)
+	r.manager.SendResponse(response, interest, pitToken, inFace)
 }
 
 func (r *RIBModule) announce(interest *ndn.Interest, pitToken []byte, inFace uint64) {
 	var response *mgmt.ControlResponse
 
-	if interest.Name().Size() != r.manager.prefixLength()+3 || interest.Name().At(r.manager.prefixLength()+2).Type() != tlv.ParametersSha256DigestComponent {
+	if interest.Name().Size() != r.manager.PrefixLength()+3 || interest.Name().At(r.manager.PrefixLength()+2).Type() != tlv.ParametersSha256DigestComponent {
 		// Name not long enough to contain ControlParameters
 		core.LogWarn(r, "Name of Interest=", interest.Name(), " is either too short or incorrectly formatted to be rib/announce")
 		response = mgmt.MakeControlResponse(400, "Name is incorrect", nil)
-		r.manager.sendResponse(response, interest, pitToken, inFace)
+		r.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
 	// Get PrefixAnnouncement
-	if len(interest.ApplicationParameters()) == 0 || interest.ApplicationParameters()[0].Type() != tlv.Data {
+	prefixAnnouncementData := prefixAnnouncementParameter(interest)
+	if prefixAnnouncementData == nil {
 		core.LogWarn(r, "PrefixAnnouncement Interest=", interest.Name(), " missing PrefixAnnouncement")
 		response = mgmt.MakeControlResponse(400, "PrefixAnnouncement is missing", nil)
-		r.manager.sendResponse(response, interest, pitToken, inFace)
+		r.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
-	prefixAnnouncement, err := ndn.DecodePrefixAnnouncement(interest.ApplicationParameters()[0].DeepCopy())
+	prefixAnnouncement, err := ndn.DecodePrefixAnnouncement(prefixAnnouncementData.DeepCopy())
 	if err != nil {
 		core.LogWarn(r, "PrefixAnnouncement Interest=", interest.Name(), " has invalid PrefixAnnouncement")
 		response = mgmt.MakeControlResponse(400, "PrefixAnnouncement is invalid", nil)
-		r.manager.sendResponse(response, interest, pitToken, inFace)
+		r.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
-	prefix := prefixAnnouncement.Prefix()
+	notBefore, notAfter, err := prefixAnnouncementValidity(prefixAnnouncementData)
+	if err != nil {
+		core.LogWarn(r, "PrefixAnnouncement Interest=", interest.Name(), " has invalid ValidityPeriod: ", err)
+		response = mgmt.MakeControlResponse(400, "PrefixAnnouncement is invalid", nil)
+		r.manager.SendResponse(response, interest, pitToken, inFace)
+		return
+	}
+
+	// The name returned by Prefix has an empty cached encoding, so it must be copied to be encoded
+	prefix := prefixAnnouncement.Prefix().DeepCopy()
 	faceID := inFace
 	origin := table.RouteOriginPrefixAnn
 	cost := uint64(0)
 	expirationPeriod := time.Duration(prefixAnnouncement.ExpirationPeriod()) * time.Millisecond
 
 	// Use more restrictive of ExpirationPeriod and ValidityPeriod
-	notBefore, notAfter := prefixAnnouncement.ValidityPeriod()
-	if notBefore.Unix() == 0 && notAfter.Unix() == 0 {
-	} else if notBefore.After(time.Now()) && notAfter.Before(time.Now()) {
-		core.LogWarn(r, "PrefixAnnouncement Interest=", interest.Name(), " is in the future")
+	if notBefore.IsZero() && notAfter.IsZero() {
+	} else if notBefore.After(time.Now()) || notAfter.Before(time.Now()) {
+		core.LogWarn(r, "PrefixAnnouncement Interest=", interest.Name(), " is outside its ValidityPeriod")
 		response = mgmt.MakeControlResponse(416, "Time out of range", nil)
-		r.manager.sendResponse(response, interest, pitToken, inFace)
+		r.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	} else if notAfter.Before(time.Now().Add(expirationPeriod)) {
 		expirationPeriod = time.Until(notAfter)
 	}
 
-	customrib.Rib.AddRoute(prefix, faceID, origin, cost, 0, &expirationPeriod)
+	ctx, cancel := r.manager.ForwarderContext()
+	defer cancel()
+	if err := customrib.Rib.AddRoute(ctx, prefix, faceID, origin, cost, 0, &expirationPeriod); err != nil {
+		r.manager.SendResponse(ForwarderErrorResponse(r, interest, err), interest, pitToken, inFace)
+		return
+	}
 	//investigate expiration period
 
 	core.LogInfo(r, "Created route via PrefixAnnouncement for Prefix=", prefix, ", FaceID=", faceID, ", Origin=", origin, ", Cost=", cost, ", Flags=0x0, ExpirationPeriod=", expirationPeriod)
@@ -271,16 +305,45 @@ func (r *RIBModule) announce(interest *ndn.Interest, pitToken []byte, inFace uin
 	} else {
 		response = mgmt.MakeControlResponse(200, "OK", responseParamsWire)
 	}
-	r.manager.sendResponse(response, interest, pitToken, inFace)
+	r.manager.SendResponse(response, interest, pitToken, inFace)
 }
 
-func (r *RIBModule) list(interest *ndn.Interest, pitToken []byte, inFace uint64) {
-	if interest.Name().Size() > r.manager.prefixLength()+2 {
-		// Ignore because contains version and/or segment components
-		return
+// prefixAnnouncementParameter returns the PrefixAnnouncement Data carried in the ApplicationParameters of a rib/announce Interest, or nil if there is none.
+func prefixAnnouncementParameter(interest *ndn.Interest) *tlv.Block {
+	params := interest.ApplicationParameters()
+	if len(params) == 0 || params[0].Type() != tlv.ApplicationParameters {
+		return nil
 	}
+	data, _, err := tlv.DecodeBlock(params[0].Value())
+	if err != nil || data.Type() != tlv.Data {
+		return nil
+	}
+	return data
+}
 
-	// Generate new dataset
+// prefixAnnouncementValidity returns the ValidityPeriod in the content of the PrefixAnnouncement Data, or zero times if it has none. PrefixAnnouncement.ValidityPeriod in YaNFD cannot be used, since it only dereferences the ValidityPeriod when it is missing.
+func prefixAnnouncementValidity(wire *tlv.Block) (time.Time, time.Time, error) {
+	data, err := ndn.DecodeData(wire, false)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	content := tlv.NewBlock(tlv.Content, data.Content())
+	if err := content.Parse(); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	validityPeriod := content.Find(tlv.ValidityPeriod)
+	if validityPeriod == nil {
+		return time.Time{}, time.Time{}, nil
+	}
+	return decodeValidityPeriod(validityPeriod)
+}
+
+func (r *RIBModule) list(interest *ndn.Interest, pitToken []byte, inFace uint64) {
+	name, _ := ndn.NameFromString(interest.Name().Prefix(r.manager.PrefixLength()).String() + "/rib/list")
+	r.manager.ServeDataset(r, interest, pitToken, name, r.generateDataset)
+}
+
+func (r *RIBModule) generateDataset(ctx context.Context) ([]byte, error) {
 	entries := customrib.Rib.GetAllEntries()
 	dataset := make([]byte, 0)
 	for _, entry := range entries {
@@ -291,8 +354,8 @@ func (r *RIBModule) list(interest *ndn.Interest, pitToken []byte, inFace uint64)
 			res.Origin = route.Origin
 			res.Cost = route.Cost
 			res.Flags = route.Flags
-			if route.ExpirationPeriod != nil {
-				res.ExpirationPeriod = route.ExpirationPeriod
+			if remaining := route.RemainingLifetime(); remaining != nil {
+				res.ExpirationPeriod = remaining
 			}
 			ribEntry.Routes = append(ribEntry.Routes, res)
 		}
@@ -309,18 +372,5 @@ func (r *RIBModule) list(interest *ndn.Interest, pitToken []byte, inFace uint64)
 		}
 		dataset = append(dataset, encoded...)
 	}
-
-	name, _ := ndn.NameFromString(interest.Name().Prefix(r.manager.prefixLength()).String() + "/rib/list")
-	segments := mgmt.MakeStatusDataset(name, r.nextRIBDatasetVersion, dataset)
-	for _, segment := range segments {
-		encoded, err := segment.Encode()
-		if err != nil {
-			core.LogError(r, "Unable to encode RIB dataset: ", err)
-			return
-		}
-		r.manager.transport.Send(encoded, pitToken, nil)
-	}
-
-	core.LogTrace(r, "Published RIB dataset version=", r.nextRIBDatasetVersion, ", containing ", len(segments), " segments")
-	r.nextRIBDatasetVersion++
+	return dataset, nil
 }
@@ -17,33 +17,30 @@ import (
 
 // StrategyChoiceModule is the module that handles Strategy Choice Management.
 type StrategyChoiceModule struct {
-	manager                    *Thread
-	nextStrategyDatasetVersion uint64
-	strategyPrefix             *ndn.Name
+	manager        *Thread
+	strategyPrefix *ndn.Name
 }
 
 func (s *StrategyChoiceModule) String() string {
 	return "StrategyChoiceMgmt"
 }
 
-func (s *StrategyChoiceModule) registerManager(manager *Thread) {
+func (s *StrategyChoiceModule) RegisterManager(manager *Thread) {
 	s.manager = manager
 	s.strategyPrefix = s.manager.localPrefix.DeepCopy().Append(ndn.NewGenericNameComponent([]byte("strategy")))
 }
 
-func (s *StrategyChoiceModule) getManager() *Thread {
+func (s *StrategyChoiceModule) GetManager() *Thread {
 	return s.manager
 }
 
-func (s *StrategyChoiceModule) handleIncomingInterest(interest *ndn.Interest, pitToken []byte, inFace uint64) {
-	// Only allow from /localhost
-	if !s.manager.localPrefix.PrefixOf(interest.Name()) {
-		core.LogWarn(s, "Received strategy management Interest from non-local source - DROP")
-		return
-	}
+func (s *StrategyChoiceModule) CommandVerbs() []string {
+	return []string{"set", "unset"}
+}
 
+func (s *StrategyChoiceModule) HandleIncomingInterest(interest *ndn.Interest, pitToken []byte, inFace uint64) {
 	// Dispatch by verb
-	verb := interest.Name().At(s.manager.prefixLength() + 1).String()
+	verb := interest.Name().At(s.manager.PrefixLength() + 1).String()
 	switch verb {
 	case "set":
 		s.set(interest, pitToken, inFace)
@@ -54,7 +51,7 @@ func (s *StrategyChoiceModule) handleIncomingInterest(interest *ndn.Interest, pi
 	default:
 		core.LogWarn(s, "Received Interest for non-existent verb '", verb, "'")
 		response := mgmt.MakeControlResponse(501, "Unknown verb", nil)
-		s.manager.sendResponse(response, interest, pitToken, inFace)
+		s.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 }
@@ -62,48 +59,54 @@ func (s *StrategyChoiceModule) handleIncomingInterest(interest *ndn.Interest, pi
 func (s *StrategyChoiceModule) set(interest *ndn.Interest, pitToken []byte, inFace uint64) {
 	var response *mgmt.ControlResponse
 
-	if interest.Name().Size() < s.manager.prefixLength()+3 {
+	if interest.Name().Size() < s.manager.PrefixLength()+3 {
 		// Name not long enough to contain ControlParameters
 		core.LogWarn(s, "Missing ControlParameters in ", interest.Name())
 		response = mgmt.MakeControlResponse(400, "ControlParameters is incorrect", nil)
-		s.manager.sendResponse(response, interest, pitToken, inFace)
+		s.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
-	params := decodeControlParameters(s, interest)
+	params := DecodeControlParameters(s, interest)
 	if params == nil {
 		response = mgmt.MakeControlResponse(400, "ControlParameters is incorrect", nil)
-		s.manager.sendResponse(response, interest, pitToken, inFace)
+		s.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
 	if params.Name == nil {
 		core.LogWarn(s, "Missing Name in ControlParameters for ", interest.Name())
 		response = mgmt.MakeControlResponse(400, "ControlParameters is incorrect", nil)
-		s.manager.sendResponse(response, interest, pitToken, inFace)
+		s.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
 	if params.Strategy == nil {
 		core.LogWarn(s, "Missing Strategy in ControlParameters for ", interest.Name())
 		response = mgmt.MakeControlResponse(400, "ControlParameters is incorrect", nil)
-		s.manager.sendResponse(response, interest, pitToken, inFace)
+		s.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
 	if !s.strategyPrefix.PrefixOf(params.Strategy) {
 		core.LogWarn(s, "Unknown Strategy=", params.Strategy, " in ControlParameters for Interest=", interest.Name())
 		response = mgmt.MakeControlResponse(404, "Unknown strategy", nil)
-		s.manager.sendResponse(response, interest, pitToken, inFace)
+		s.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
 	strategyName := params.Strategy.At(s.strategyPrefix.Size()).String()
-	availableVersions, ok := mgmtconn.AcksConn.Versions(strategyName)
+	ctx, cancel := s.manager.ForwarderContext()
+	defer cancel()
+	availableVersions, ok, err := mgmtconn.AcksConn.Versions(ctx, strategyName)
+	if err != nil {
+		s.manager.SendResponse(ForwarderErrorResponse(s, interest, err), interest, pitToken, inFace)
+		return
+	}
 	if !ok {
 		core.LogWarn(s, "Unknown Strategy=", params.Strategy, " in ControlParameters for Interest=", interest.Name())
 		response = mgmt.MakeControlResponse(404, "Unknown strategy", nil)
-		s.manager.sendResponse(response, interest, pitToken, inFace)
+		s.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
@@ -117,7 +120,7 @@ func (s *StrategyChoiceModule) set(interest *ndn.Interest, pitToken []byte, inFa
 	if params.Strategy.Size() > s.strategyPrefix.Size()+1 && params.Strategy.At(s.strategyPrefix.Size()+1).Type() != tlv.VersionNameComponent {
 		core.LogWarn(s, "Unknown Version=", params.Strategy.At(s.strategyPrefix.Size()+1), " for Strategy=", params.Strategy, " in ControlParameters for Interest=", interest.Name())
 		response = mgmt.MakeControlResponse(404, "Unknown strategy version", nil)
-		s.manager.sendResponse(response, interest, pitToken, inFace)
+		s.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	} else if params.Strategy.Size() > s.strategyPrefix.Size()+1 {
 		strategyVersion := params.Strategy.At(s.strategyPrefix.Size() + 1).(*ndn.VersionNameComponent).Version()
@@ -130,7 +133,7 @@ func (s *StrategyChoiceModule) set(interest *ndn.Interest, pitToken []byte, inFa
 		if !foundMatchingVersion {
 			core.LogWarn(s, "Unknown Version=", strategyVersion, " for Strategy=", params.Strategy, " in ControlParameters for Interest=", interest.Name())
 			response = mgmt.MakeControlResponse(404, "Unknown strategy version", nil)
-			s.manager.sendResponse(response, interest, pitToken, inFace)
+			s.manager.SendResponse(response, interest, pitToken, inFace)
 			return
 		}
 	} else {
@@ -139,7 +142,10 @@ func (s *StrategyChoiceModule) set(interest *ndn.Interest, pitToken []byte, inFa
 	}
 
 	//table.FibStrategyTable.SetStrategy(params.Name, params.Strategy)
-	mgmtconn.AcksConn.SetStrategy(params.Name, params.Strategy)
+	if err := mgmtconn.AcksConn.SetStrategy(ctx, params.Name, params.Strategy); err != nil {
+		s.manager.SendResponse(ForwarderErrorResponse(s, interest, err), interest, pitToken, inFace)
+		return
+	}
 	core.LogInfo(s, "Set strategy for Name=", params.Name, " to Strategy=", params.Strategy)
 	responseParams := mgmt.MakeControlParameters()
 	responseParams.Name = params.Name
@@ -151,43 +157,48 @@ func (s *StrategyChoiceModule) set(interest *ndn.Interest, pitToken []byte, inFa
 	} else {
 		response = mgmt.MakeControlResponse(200, "OK", responseParamsWire)
 	}
-	s.manager.sendResponse(response, interest, pitToken, inFace)
+	s.manager.SendResponse(response, interest, pitToken, inFace)
 }
 
 func (s *StrategyChoiceModule) unset(interest *ndn.Interest, pitToken []byte, inFace uint64) {
 	var response *mgmt.ControlResponse
 
-	if interest.Name().Size() < s.manager.prefixLength()+3 {
+	if interest.Name().Size() < s.manager.PrefixLength()+3 {
 		// Name not long enough to contain ControlParameters
 		core.LogWarn(s, "Missing ControlParameters in ", interest.Name())
 		response = mgmt.MakeControlResponse(400, "ControlParameters is incorrect", nil)
-		s.manager.sendResponse(response, interest, pitToken, inFace)
+		s.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
-	params := decodeControlParameters(s, interest)
+	params := DecodeControlParameters(s, interest)
 	if params == nil {
 		response = mgmt.MakeControlResponse(400, "ControlParameters is incorrect", nil)
-		s.manager.sendResponse(response, interest, pitToken, inFace)
+		s.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
 	if params.Name == nil {
 		core.LogWarn(s, "Missing Name in ControlParameters for ", interest.Name())
 		response = mgmt.MakeControlResponse(400, "ControlParameters is incorrect", nil)
-		s.manager.sendResponse(response, interest, pitToken, inFace)
+		s.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
 	if params.Name.Size() == 0 {
 		core.LogWarn(s, "Cannot unset strategy for Name=", params.Name)
 		response = mgmt.MakeControlResponse(400, "ControlParameters is incorrect", nil)
-		s.manager.sendResponse(response, interest, pitToken, inFace)
+		s.manager.SendResponse(response, interest, pitToken, inFace)
 		return
 	}
 
 	//table.FibStrategyTable.UnsetStrategy(params.Name)
-	mgmtconn.AcksConn.UnsetStrategy(params.Name)
+	ctx, cancel := s.manager.ForwarderContext()
+	defer cancel()
+	if err := mgmtconn.AcksConn.UnsetStrategy(ctx, params.Name); err != nil {
+		s.manager.SendResponse(ForwarderErrorResponse(s, interest, err), interest, pitToken, inFace)
+		return
+	}
 	core.LogInfo(s, "Unset Strategy for Name=", params.Name)
 	responseParams := mgmt.MakeControlParameters()
 	responseParams.Name = params.Name
@@ -198,31 +209,11 @@ func (s *StrategyChoiceModule) unset(interest *ndn.Interest, pitToken []byte, in
 	} else {
 		response = mgmt.MakeControlResponse(200, "OK", responseParamsWire)
 	}
-	s.manager.sendResponse(response, interest, pitToken, inFace)
+	s.manager.SendResponse(response, interest, pitToken, inFace)
 }
 
 func (s *StrategyChoiceModule) list(interest *ndn.Interest, pitToken []byte, inFace uint64) {
-	if interest.Name().Size() > s.manager.prefixLength()+2 {
-		// Ignore because contains version and/or segment components
-		return
-	}
-
-	// Generate new dataset
 	// TODO: For thread safety, we should lock the Strategy table from writes until we are done
-	// another area where we have to request forwarder data
-	dataset := mgmtconn.AcksConn.ListStrategy()
-
 	name, _ := ndn.NameFromString(s.manager.localPrefix.String() + "/strategy-choice/list")
-	segments := mgmt.MakeStatusDataset(name, s.nextStrategyDatasetVersion, dataset)
-	for _, segment := range segments {
-		encoded, err := segment.Encode()
-		if err != nil {
-			core.LogError(s, "Unable to encode strategy choice dataset: ", err)
-			return
-		}
-		s.manager.transport.Send(encoded, pitToken, nil)
-	}
-
-	core.LogTrace(s, "Published strategy choice dataset version=", s.nextStrategyDatasetVersion, ", containing ", len(segments), " segments")
-	s.nextStrategyDatasetVersion++
+	s.manager.ServeDataset(s, interest, pitToken, name, mgmtconn.AcksConn.ListStrategy)
 }
@@ -8,9 +8,14 @@
 package modules
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
+	"sync"
+	"time"
 
+	"github.com/amazingtapioca17/mgmt/mgmtconn"
 	temp "github.com/amazingtapioca17/mgmt/transport"
 	"github.com/named-data/YaNFD/core"
 	"github.com/named-data/YaNFD/ndn"
@@ -20,11 +25,21 @@ import (
 
 // Thread Represents the management thread
 type Thread struct {
-	transport      *temp.FakeTransport
-	port           string
-	localPrefix    *ndn.Name
-	nonLocalPrefix *ndn.Name
-	modules        map[string]Module
+	transport        *temp.FakeTransport
+	port             string
+	localPrefix      *ndn.Name
+	nonLocalPrefix   *ndn.Name
+	modules          map[string]Module
+	commands         map[string]map[string]bool
+	validator        *commandValidator
+	replay           *replayStore
+	policy           *commandPolicy
+	localhopSchema   *trustSchema
+	allowLocalhop    bool
+	forwarderTimeout time.Duration
+	authMutex        sync.RWMutex
+	dispatcher       *dispatcher
+	datasets         *datasetPublisher
 }
 
 func (m *Thread) ClearNextHop(name *ndn.Name) string {
@@ -118,39 +133,157 @@ func (m *Thread) InsertNextHop(name *ndn.Name, faceID uint64, cost uint64) strin
 func MakeMgmtThread() *Thread {
 	m := new(Thread)
 	var err error
-	m.localPrefix, err = ndn.NameFromString("/localhost/nfd")
+	m.localPrefix, err = ndn.NameFromString(localPrefix)
 	if err != nil {
 		core.LogFatal(m, "Unable to create name for management prefix: ", err)
 	}
-	m.nonLocalPrefix, err = ndn.NameFromString("/localhop/nfd")
+	m.nonLocalPrefix, err = ndn.NameFromString(localhopPrefix)
 	if err != nil {
 		core.LogFatal(m, "Unable to create name for management prefix: ", err)
 	}
-	m.port = ":1080"
+	m.port = legacyPort
+	m.replay = makeReplayStore(commandGracePeriod, commandRecordLifetime, maxCommandRecords)
+	m.allowLocalhop = enableLocalhopManagement
+	m.forwarderTimeout = forwarderTimeout
+	m.validator, m.policy, m.localhopSchema, err = loadCommandAuthorization()
+	if err != nil {
+		core.LogFatal(m, err)
+	}
+	m.transport = temp.MakeFakeTransport(forwarderSocket)
+	if err := m.transport.CheckPeer(forwarderPeers); err != nil {
+		core.LogFatal(m, "Refusing forwarder on ", forwarderSocket, ": ", err)
+	}
+	if sharedMemorySize > 0 {
+		err := m.transport.UseSharedMemory(sharedMemorySize, func(segment string) error {
+			ctx, cancel := m.ForwarderContext()
+			defer cancel()
+			return mgmtconn.AcksConn.AttachSharedMemory(ctx, mgmtconn.ChannelPackets, segment)
+		})
+		if err != nil {
+			core.LogWarn(m, "Using the forwarder socket for packets, since shared memory could not be attached: ", err)
+		} else {
+			core.LogInfo(m, "Using shared memory for packets")
+		}
+	}
+	m.dispatcher = makeDispatcher(dispatchWorkers, dispatchQueueSize)
+	m.datasets = makeDatasetPublisher(datasetCacheLifetime)
 	m.modules = make(map[string]Module)
-	m.registerModule("cs", new(ContentStoreModule))
-	m.registerModule("faces", new(FaceModule))
-	m.registerModule("fib", new(FIBModule))
-	m.registerModule("rib", new(RIBModule))
-	m.registerModule("status", new(ForwarderStatusModule))
-	m.registerModule("strategy-choice", new(StrategyChoiceModule))
+	m.commands = make(map[string]map[string]bool)
+	for _, name := range builtinModules {
+		if disabledModules[name] {
+			core.LogInfo(m, "Module ", name, " is disabled")
+			continue
+		}
+		switch name {
+		case "cs":
+			m.RegisterModule(name, new(ContentStoreModule))
+		case "faces":
+			m.RegisterModule(name, new(FaceModule))
+		case "fib":
+			m.RegisterModule(name, new(FIBModule))
+		case "rib":
+			m.RegisterModule(name, new(RIBModule))
+		case "status":
+			m.RegisterModule(name, new(ForwarderStatusModule))
+		case "strategy-choice":
+			m.RegisterModule(name, new(StrategyChoiceModule))
+		}
+	}
 	return m
 }
 
+// loadCommandAuthorization loads the trust anchors, certificates, command policy, and localhop trust schema from the configured files.
+func loadCommandAuthorization() (*commandValidator, *commandPolicy, *trustSchema, error) {
+	var err error
+	var localhopSchema *trustSchema
+	if enableLocalhopManagement && localhopTrustSchemaFile != "" {
+		localhopSchema, err = loadTrustSchema(localhopTrustSchemaFile)
+		if err != nil {
+			return nil, nil, nil, errors.New("unable to load localhop trust schema from " + localhopTrustSchemaFile + ": " + err.Error())
+		}
+	} else if enableLocalhopManagement {
+		core.LogWarn("Management", "Localhop management is enabled without a trust schema, so all localhop commands will be rejected")
+	}
+	var policy *commandPolicy
+	if commandPolicyFile != "" {
+		policy, err = loadCommandPolicy(commandPolicyFile)
+		if err != nil {
+			return nil, nil, nil, errors.New("unable to load command policy from " + commandPolicyFile + ": " + err.Error())
+		}
+	}
+	validator := makeCommandValidator()
+	for _, file := range trustAnchorFiles {
+		if err := validator.loadTrustAnchor(file); err != nil {
+			core.LogError("Management", "Unable to load trust anchor from ", file, ": ", err)
+		}
+	}
+	for _, file := range certificateFiles {
+		if err := validator.loadCertificate(file); err != nil {
+			core.LogError("Management", "Unable to load certificate from ", file, ": ", err)
+		}
+	}
+	return validator, policy, localhopSchema, nil
+}
+
+// Reload applies the current configuration to command authorization, i.e., the trust anchors, certificates, command policy, localhop trust schema, and replay protection settings, and to the forwarder timeout of commands handled from then on. The other settings only take effect after a restart.
+func (m *Thread) Reload() error {
+	validator, policy, localhopSchema, err := loadCommandAuthorization()
+	if err != nil {
+		return err
+	}
+	m.authMutex.Lock()
+	defer m.authMutex.Unlock()
+	m.validator = validator
+	m.policy = policy
+	m.localhopSchema = localhopSchema
+	m.allowLocalhop = enableLocalhopManagement
+	m.forwarderTimeout = forwarderTimeout
+	m.replay.gracePeriod = commandGracePeriod
+	m.replay.recordLifetime = commandRecordLifetime
+	m.replay.maxRecords = maxCommandRecords
+	core.LogInfo(m, "Reloaded command authorization")
+	return nil
+}
+
+// Stop stops receiving management Interests. Run returns once the Interests already dispatched to modules have been handled.
+func (m *Thread) Stop() {
+	core.LogInfo(m, "Stopping")
+	m.transport.StopReceive()
+}
+
 func (m *Thread) String() string {
 	return "Management"
 }
 
-func (m *Thread) registerModule(name string, module Module) {
+// RegisterModule adds a module that handles Interests under <prefix>/<name>. Modules must be registered before the thread is run.
+func (m *Thread) RegisterModule(name string, module Module) error {
+	if _, ok := m.modules[name]; ok {
+		return errors.New("module " + name + " is already registered")
+	}
 	m.modules[name] = module
-	module.registerManager(m)
+	m.commands[name] = make(map[string]bool)
+	m.dispatcher.addQueue(name)
+	if commandModule, ok := module.(CommandModule); ok {
+		for _, verb := range commandModule.CommandVerbs() {
+			m.commands[name][verb] = true
+		}
+	}
+	module.RegisterManager(m)
+	return nil
 }
 
-func (m *Thread) prefixLength() int {
+// LocalPrefix returns the management prefix for local commands, i.e., /localhost/nfd.
+func (m *Thread) LocalPrefix() *ndn.Name {
+	return m.localPrefix
+}
+
+// PrefixLength returns the number of components in the management prefix, which precede the module name.
+func (m *Thread) PrefixLength() int {
 	return m.localPrefix.Size()
 }
 
-func (m *Thread) sendResponse(response *mgmt.ControlResponse, interest *ndn.Interest, pitToken []byte, inFace uint64) {
+// SendResponse encodes a ControlResponse and sends it as the reply to the command Interest.
+func (m *Thread) SendResponse(response *mgmt.ControlResponse, interest *ndn.Interest, pitToken []byte, inFace uint64) {
 	encodedResponse, err := response.Encode()
 	if err != nil {
 		core.LogWarn(m, "Unable to send ControlResponse for ", interest.Name(), ": ", err)
@@ -172,16 +305,69 @@ func (m *Thread) sendResponse(response *mgmt.ControlResponse, interest *ndn.Inte
 	m.transport.Send(encodedData, pitToken, &inFace)
 }
 
+// ForwarderContext returns the context for commands sent to the forwarder while handling an Interest, which ends after the forwarder timeout configured when the thread was made or last reloaded.
+func (m *Thread) ForwarderContext() (context.Context, context.CancelFunc) {
+	m.authMutex.RLock()
+	timeout := m.forwarderTimeout
+	m.authMutex.RUnlock()
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// DispatchStats returns the queue metrics of the module dispatcher.
+func (m *Thread) DispatchStats() DispatchStats {
+	return m.dispatcher.stats()
+}
+
+// authorizeCommand validates the signature of a control command, protects against replays, and enforces the command policy. It returns nil if the command is accepted.
+func (m *Thread) authorizeCommand(interest *ndn.Interest, moduleName string, verb string) *mgmt.ControlResponse {
+	m.authMutex.RLock()
+	defer m.authMutex.RUnlock()
+	signature, err := m.validator.validate(interest)
+	if err != nil {
+		core.LogWarn(m, "Rejected control command ", interest.Name(), ": ", err)
+		return mgmt.MakeControlResponse(403, "Authorization rejected", nil)
+	}
+
+	if err := m.replay.check(signature); err == errCommandOutOfGrace {
+		core.LogWarn(m, "Rejected control command ", interest.Name(), " signed by ", signature.keyName, ": ", err)
+		return mgmt.MakeControlResponse(416, "SignatureTime out of range", nil)
+	} else if err != nil {
+		core.LogWarn(m, "Rejected control command ", interest.Name(), " signed by ", signature.keyName, ": ", err)
+		return mgmt.MakeControlResponse(409, "Command replayed", nil)
+	}
+
+	target := m.commandTarget(interest, verb)
+	if m.nonLocalPrefix.PrefixOf(interest.Name()) && (m.localhopSchema == nil || !m.localhopSchema.authorize(signature.keyName, target)) {
+		core.LogWarn(m, "Denied localhop command ", interest.Name(), " signed by ", signature.keyName, " by trust schema")
+		return mgmt.MakeControlResponse(403, "Authorization rejected", nil)
+	}
+
+	if m.policy != nil && !m.policy.authorize(signature.keyName, moduleName, verb, target) {
+		core.LogWarn(m, "Denied ", moduleName, "/", verb, " command ", interest.Name(), " signed by ", signature.keyName, " by policy")
+		return mgmt.MakeControlResponse(403, "Authorization rejected", nil)
+	}
+	m.replay.commit(signature)
+	return nil
+}
+
+func (m *Thread) localhopAllowed() bool {
+	m.authMutex.RLock()
+	defer m.authMutex.RUnlock()
+	return m.allowLocalhop
+}
+
 // Run management thread
 func (m *Thread) Run() {
 	fmt.Println("running")
-	m.transport = temp.MakeFakeTransport()
 	go m.transport.RunReceive()
+	defer m.transport.Close()
+	m.dispatcher.start()
+	defer m.dispatcher.stop()
 	// Create and register Internal transport
 	for {
 		block, pitToken, inFace := m.transport.Receive()
 		if block == nil {
-			// Indicates that internal face has quit, which means it's time for us to quit
+			// Indicates that internal face has quit or Stop was called, which means it's time for us to quit
 			core.LogInfo(m, "Face quit, so management quitting")
 			break
 		}
@@ -212,12 +398,32 @@ func (m *Thread) Run() {
 
 		// Dispatch interest based on name
 		moduleName := interest.Name().At(m.localPrefix.Size()).String()
+		verb := interest.Name().At(m.localPrefix.Size() + 1).String()
+		if m.nonLocalPrefix.PrefixOf(interest.Name()) && (!m.localhopAllowed() || !localhopVerbs[moduleName][verb]) {
+			core.LogWarn(m, "Received ", moduleName, "/", verb, " management Interest from non-local source - DROP")
+			continue
+		}
 		if module, ok := m.modules[moduleName]; ok {
-			module.handleIncomingInterest(interest, pitToken, inFace)
+			if m.commands[moduleName][verb] {
+				if response := m.authorizeCommand(interest, moduleName, verb); response != nil {
+					m.SendResponse(response, interest, pitToken, inFace)
+					continue
+				}
+			}
+			dispatched := m.dispatcher.dispatch(moduleName, &dispatchTask{
+				module:   module,
+				interest: interest,
+				pitToken: pitToken,
+				inFace:   inFace,
+			})
+			if !dispatched {
+				response := mgmt.MakeControlResponse(503, "Management is overloaded", nil)
+				m.SendResponse(response, interest, pitToken, inFace)
+			}
 		} else {
 			core.LogWarn(m, "Received management Interest for unknown module ", moduleName)
 			response := mgmt.MakeControlResponse(501, "Unknown module", nil)
-			m.sendResponse(response, interest, pitToken, inFace)
+			m.SendResponse(response, interest, pitToken, inFace)
 		}
 	}
 }
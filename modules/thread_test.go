@@ -0,0 +1,942 @@
+package modules
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/amazingtapioca17/mgmt/fakeforwarder"
+	"github.com/amazingtapioca17/mgmt/mgmtconn"
+	"github.com/amazingtapioca17/mgmt/table"
+	"github.com/named-data/YaNFD/ndn"
+	"github.com/named-data/YaNFD/ndn/mgmt"
+	"github.com/named-data/YaNFD/ndn/tlv"
+)
+
+// forwarder is the fake forwarder that the management thread under test is connected to. Each test uses its own names and faces, since its state is shared.
+var forwarder *fakeforwarder.Forwarder
+
+// operator signs the commands sent by the tests with the key of a trust anchor.
+var operator *testSigner
+
+// router has a certificate issued by the operator, so its commands are trusted through the certificate chain.
+var router *testSigner
+
+// thread is the management thread under test.
+var thread *Thread
+
+// blocking is a module registered with the thread under test whose handler can be blocked, to fill its dispatch queue.
+var blocking *blockingModule
+
+func TestMain(m *testing.M) {
+	code, err := runWithThread(m)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	os.Exit(code)
+}
+
+// runWithThread runs the tests against a management thread connected to a fake forwarder.
+func runWithThread(m *testing.M) (int, error) {
+	dir, err := os.MkdirTemp("", "mgmt")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(dir)
+
+	operator, err = makeTestSigner("/test/operator")
+	if err != nil {
+		return 0, err
+	}
+	anchorFile := filepath.Join(dir, "operator.ndncert")
+	if err := operator.writeCertificate(anchorFile); err != nil {
+		return 0, err
+	}
+	trustAnchorFiles = []string{anchorFile}
+	router, err = makeTestSigner("/test/router")
+	if err != nil {
+		return 0, err
+	}
+	certificateFile := filepath.Join(dir, "router.ndncert")
+	if err := operator.issueCertificate(certificateFile, router, time.Now().Add(-time.Hour), time.Now().Add(time.Hour)); err != nil {
+		return 0, err
+	}
+	certificateFiles = []string{certificateFile}
+
+	ackSocket := filepath.Join(dir, "ack.sock")
+	forwarderSocket = filepath.Join(dir, "packet.sock")
+	forwarder, err = fakeforwarder.Start(ackSocket, forwarderSocket)
+	if err != nil {
+		return 0, err
+	}
+	defer forwarder.Close()
+	if err := mgmtconn.AcksConn.MakeMgmtConn(ackSocket, "json"); err != nil {
+		return 0, err
+	}
+	mgmtconn.AcksConn.Table = &table.Rib
+	go mgmtconn.AcksConn.RunReceive()
+	defer mgmtconn.AcksConn.Close()
+	ribEvents, _ := mgmtconn.AcksConn.SubscribeUnbounded(mgmtconn.EventFaceDestroyed, mgmtconn.EventFaceUp)
+	go table.Rib.HandleEvents(ribEvents, mgmtconn.AcksConn.Timeout)
+
+	thread = MakeMgmtThread()
+	blocking = makeBlockingModule()
+	if err := thread.RegisterModule("blocking", blocking); err != nil {
+		return 0, err
+	}
+	done := make(chan struct{})
+	go func() {
+		thread.Run()
+		close(done)
+	}()
+	if err := waitForThread(); err != nil {
+		return 0, err
+	}
+	code := m.Run()
+	thread.Stop()
+	<-done
+	return code, nil
+}
+
+// waitForThread waits until the management thread answers Interests from the forwarder.
+func waitForThread() error {
+	name, err := ndn.NameFromString(localPrefix + "/unknown/probe")
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		_, err := forwarder.ExpressInterest(ctx, ndn.NewInterest(name), 0)
+		cancel()
+		if !errors.Is(err, fakeforwarder.ErrNotConnected) || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// expressInterest sends an Interest to management as if it was received on inFace, and returns the Data answering it.
+func expressInterest(t *testing.T, interest *ndn.Interest, inFace uint64) *ndn.Data {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	data, err := forwarder.ExpressInterest(ctx, interest, inFace)
+	if err != nil {
+		t.Fatalf("no response to %s: %v", interest.Name(), err)
+	}
+	return data
+}
+
+// expectNoAnswer fails the test if management answers the Interest, which it should drop.
+func expectNoAnswer(t *testing.T, interest *ndn.Interest, inFace uint64) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if data, err := forwarder.ExpressInterest(ctx, interest, inFace); err == nil {
+		t.Errorf("%s was answered with %s", interest.Name(), data.Name())
+	}
+}
+
+// sendCommand sends a command Interest to management as if it was received on inFace, and returns the ControlResponse.
+func sendCommand(t *testing.T, interest *ndn.Interest, inFace uint64) *mgmt.ControlResponse {
+	t.Helper()
+	data := expressInterest(t, interest, inFace)
+	block, _, err := tlv.DecodeBlock(data.Content())
+	if err != nil {
+		t.Fatalf("invalid response to %s: %v", interest.Name(), err)
+	}
+	response, err := mgmt.DecodeControlResponse(block)
+	if err != nil {
+		t.Fatalf("invalid response to %s: %v", interest.Name(), err)
+	}
+	return response
+}
+
+// signedCommand sends a command signed by the operator, and fails the test unless the response has the expected status code.
+func signedCommand(t *testing.T, module string, verb string, params *mgmt.ControlParameters, inFace uint64, expectedStatus uint64) *mgmt.ControlResponse {
+	t.Helper()
+	interest, err := operator.command(module, verb, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := sendCommand(t, interest, inFace)
+	if response.StatusCode != expectedStatus {
+		t.Fatalf("%s/%s returned %d %s, expected %d", module, verb, response.StatusCode, response.StatusText, expectedStatus)
+	}
+	return response
+}
+
+// responseParams decodes the ControlParameters in the body of a response.
+func responseParams(t *testing.T, response *mgmt.ControlResponse) *mgmt.ControlParameters {
+	t.Helper()
+	if response.Body == nil {
+		t.Fatal("response has no body")
+	}
+	params, err := mgmt.DecodeControlParameters(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return params
+}
+
+// addFace creates a face in the forwarder, which is destroyed when the test ends.
+func addFace(t *testing.T, host string) uint64 {
+	faceID := forwarder.AddFace(ndn.MakeUDPFaceURI(4, host, 6363))
+	t.Cleanup(func() {
+		forwarder.RemoveFace(faceID)
+	})
+	return faceID
+}
+
+func uint64Param(value uint64) *uint64 {
+	return &value
+}
+
+// waitFor polls the condition until it holds or a few seconds have passed.
+func waitFor(condition func() bool) bool {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+func TestFaceCommands(t *testing.T) {
+	inFace := addFace(t, "192.0.2.1")
+
+	params := mgmt.MakeControlParameters()
+	params.URI = ndn.MakeUDPFaceURI(4, "192.0.2.100", 6363)
+	params.FacePersistency = uint64Param(1)
+	created := responseParams(t, signedCommand(t, "faces", "create", params, inFace, 200))
+	if created.FaceID == nil {
+		t.Fatal("faces/create response has no FaceId")
+	}
+	face := forwarder.Face(*created.FaceID)
+	if face == nil {
+		t.Fatalf("face %d was not created in the forwarder", *created.FaceID)
+	}
+	if face.URI.String() != params.URI.String() || face.Persistency != 1 {
+		t.Errorf("face was created with URI %s and persistency %d", face.URI, face.Persistency)
+	}
+	signedCommand(t, "faces", "create", params, inFace, 409)
+
+	update := mgmt.MakeControlParameters()
+	update.FaceID = created.FaceID
+	update.FacePersistency = uint64Param(2)
+	signedCommand(t, "faces", "update", update, inFace, 200)
+	if face := forwarder.Face(*created.FaceID); face == nil || face.Persistency != 2 {
+		t.Errorf("face was not updated: %+v", face)
+	}
+
+	destroy := mgmt.MakeControlParameters()
+	destroy.FaceID = created.FaceID
+	destroyed := responseParams(t, signedCommand(t, "faces", "destroy", destroy, inFace, 200))
+	if destroyed.FaceID == nil || *destroyed.FaceID != *created.FaceID {
+		t.Errorf("faces/destroy response has FaceId %v", destroyed.FaceID)
+	}
+	if face := forwarder.Face(*created.FaceID); face != nil {
+		t.Errorf("face %d still exists after faces/destroy", *created.FaceID)
+	}
+}
+
+func TestFibCommands(t *testing.T) {
+	inFace := addFace(t, "192.0.2.2")
+	nexthop := addFace(t, "192.0.2.3")
+	name := testName(t, "/e2e/fib")
+
+	params := mgmt.MakeControlParameters()
+	params.Name = name
+	params.FaceID = &nexthop
+	params.Cost = uint64Param(7)
+	signedCommand(t, "fib", "add-nexthop", params, inFace, 200)
+	if nexthops := forwarder.NextHops(name); !reflect.DeepEqual(nexthops, map[uint64]uint64{nexthop: 7}) {
+		t.Errorf("nexthops after fib/add-nexthop are %v", nexthops)
+	}
+
+	// The nexthop defaults to the face the command was received on
+	params = mgmt.MakeControlParameters()
+	params.Name = name
+	params.Cost = uint64Param(3)
+	signedCommand(t, "fib", "add-nexthop", params, inFace, 200)
+	if nexthops := forwarder.NextHops(name); !reflect.DeepEqual(nexthops, map[uint64]uint64{nexthop: 7, inFace: 3}) {
+		t.Errorf("nexthops after fib/add-nexthop without FaceId are %v", nexthops)
+	}
+
+	missing := uint64(100000)
+	params = mgmt.MakeControlParameters()
+	params.Name = name
+	params.FaceID = &missing
+	signedCommand(t, "fib", "add-nexthop", params, inFace, 410)
+
+	params = mgmt.MakeControlParameters()
+	params.Name = name
+	params.FaceID = &nexthop
+	signedCommand(t, "fib", "remove-nexthop", params, inFace, 200)
+	if nexthops := forwarder.NextHops(name); !reflect.DeepEqual(nexthops, map[uint64]uint64{inFace: 3}) {
+		t.Errorf("nexthops after fib/remove-nexthop are %v", nexthops)
+	}
+}
+
+func TestRibCommands(t *testing.T) {
+	inFace := addFace(t, "192.0.2.4")
+	nexthop := addFace(t, "192.0.2.5")
+	name := testName(t, "/e2e/rib")
+
+	params := mgmt.MakeControlParameters()
+	params.Name = name
+	params.Cost = uint64Param(5)
+	registered := responseParams(t, signedCommand(t, "rib", "register", params, inFace, 200))
+	if registered.FaceID == nil || *registered.FaceID != inFace {
+		t.Errorf("rib/register without FaceId registered FaceId %v instead of %d", registered.FaceID, inFace)
+	}
+
+	params = mgmt.MakeControlParameters()
+	params.Name = name
+	params.FaceID = &nexthop
+	params.Cost = uint64Param(10)
+	signedCommand(t, "rib", "register", params, inFace, 200)
+	if nexthops := forwarder.NextHops(name); !reflect.DeepEqual(nexthops, map[uint64]uint64{inFace: 5, nexthop: 10}) {
+		t.Errorf("nexthops after rib/register are %v", nexthops)
+	}
+
+	missing := uint64(100000)
+	params = mgmt.MakeControlParameters()
+	params.Name = name
+	params.FaceID = &missing
+	signedCommand(t, "rib", "register", params, inFace, 410)
+
+	params = mgmt.MakeControlParameters()
+	params.Name = name
+	signedCommand(t, "rib", "unregister", params, inFace, 200)
+	if nexthops := forwarder.NextHops(name); !reflect.DeepEqual(nexthops, map[uint64]uint64{nexthop: 10}) {
+		t.Errorf("nexthops after rib/unregister are %v", nexthops)
+	}
+
+	// Routes via a face are removed when the forwarder reports that it was destroyed
+	forwarder.RemoveFace(nexthop)
+	if !waitFor(func() bool { return !ribHasFace(name, nexthop) }) {
+		t.Errorf("route via face %d was not removed after the face was destroyed", nexthop)
+	}
+}
+
+// ribHasFace returns whether the RIB has a route for the name via the face.
+func ribHasFace(name *ndn.Name, faceID uint64) bool {
+	for _, entry := range table.Rib.GetAllEntries() {
+		if !entry.Name.Equals(name) {
+			continue
+		}
+		for _, route := range entry.GetRoutes() {
+			if route.FaceID == faceID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestCsCommands(t *testing.T) {
+	inFace := addFace(t, "192.0.2.6")
+
+	params := mgmt.MakeControlParameters()
+	params.Capacity = uint64Param(1234)
+	configured := responseParams(t, signedCommand(t, "cs", "config", params, inFace, 200))
+	if configured.Capacity == nil || *configured.Capacity != 1234 {
+		t.Errorf("cs/config response has Capacity %v", configured.Capacity)
+	}
+	if capacity := forwarder.CsCapacity(); capacity != 1234 {
+		t.Errorf("CS capacity after cs/config is %d", capacity)
+	}
+}
+
+func TestStrategyChoiceCommands(t *testing.T) {
+	inFace := addFace(t, "192.0.2.7")
+	name := testName(t, "/e2e/strategy")
+
+	params := mgmt.MakeControlParameters()
+	params.Name = name
+	params.Strategy = testName(t, "/localhost/nfd/strategy/multicast")
+	signedCommand(t, "strategy-choice", "set", params, inFace, 200)
+	if strategy := forwarder.Strategy(name); strategy == nil || strategy.String() != "/localhost/nfd/strategy/multicast/v=1" {
+		t.Errorf("strategy after strategy-choice/set is %v", strategy)
+	}
+
+	params.Strategy = testName(t, "/localhost/nfd/strategy/unknown")
+	signedCommand(t, "strategy-choice", "set", params, inFace, 404)
+
+	params = mgmt.MakeControlParameters()
+	params.Name = name
+	signedCommand(t, "strategy-choice", "unset", params, inFace, 200)
+	if strategy := forwarder.Strategy(name); strategy != nil {
+		t.Errorf("strategy after strategy-choice/unset is %v", strategy)
+	}
+}
+
+func TestUnauthorizedCommands(t *testing.T) {
+	inFace := addFace(t, "192.0.2.8")
+	name := testName(t, "/e2e/unauthorized")
+	params := mgmt.MakeControlParameters()
+	params.Name = name
+
+	// Unsigned
+	unsigned, err := ndn.NameFromString(localPrefix + "/rib/register")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encodedParams, err := params.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	paramsWire, err := encodedParams.Wire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned.Append(ndn.NewGenericNameComponent(paramsWire))
+	if response := sendCommand(t, ndn.NewInterest(unsigned), inFace); response.StatusCode != 403 {
+		t.Errorf("unsigned command returned %d", response.StatusCode)
+	}
+
+	// Signed by a key that is not trusted
+	stranger, err := makeTestSigner("/test/stranger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	interest, err := stranger.command("rib", "register", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response := sendCommand(t, interest, inFace); response.StatusCode != 403 {
+		t.Errorf("command signed by untrusted key returned %d", response.StatusCode)
+	}
+
+	// Replayed
+	interest, err = operator.command("rib", "register", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response := sendCommand(t, interest, inFace); response.StatusCode != 200 {
+		t.Fatalf("command returned %d", response.StatusCode)
+	}
+	if response := sendCommand(t, interest, inFace); response.StatusCode != 409 {
+		t.Errorf("replayed command returned %d", response.StatusCode)
+	}
+
+	if len(forwarder.NextHops(name)) != 1 {
+		t.Errorf("rejected commands changed the FIB: %v", forwarder.NextHops(name))
+	}
+}
+
+func TestCertificateChainCommands(t *testing.T) {
+	inFace := addFace(t, "192.0.2.10")
+	name := testName(t, "/e2e/certificate-chain")
+	params := mgmt.MakeControlParameters()
+	params.Name = name
+
+	interest, err := router.command("rib", "register", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response := sendCommand(t, interest, inFace); response.StatusCode != 200 {
+		t.Fatalf("command signed by key certified by trust anchor returned %d %s", response.StatusCode, response.StatusText)
+	}
+	if nexthops := forwarder.NextHops(name); !reflect.DeepEqual(nexthops, map[uint64]uint64{inFace: 0}) {
+		t.Errorf("nexthops after rib/register are %v", nexthops)
+	}
+}
+
+func TestDispatchQueueFull(t *testing.T) {
+	if err := forwarder.SendInterest(ndn.NewInterest(testName(t, localPrefix+"/blocking/block")), 0); err != nil {
+		t.Fatal(err)
+	}
+	blocking.waitBlocked(t)
+	defer blocking.release()
+	name := testName(t, localPrefix+"/blocking/verb")
+	for i := 0; i < dispatchQueueSize; i++ {
+		if err := forwarder.SendInterest(ndn.NewInterest(name), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if response := sendCommand(t, ndn.NewInterest(name), 0); response.StatusCode != 503 {
+		t.Errorf("Interest for module with a full queue returned %d", response.StatusCode)
+	}
+	if stats := thread.DispatchStats(); stats.QueueDepths["blocking"] != dispatchQueueSize || stats.Dropped == 0 {
+		t.Errorf("dispatch stats with a full queue are %+v", stats)
+	}
+}
+
+func TestReloadForwarderTimeout(t *testing.T) {
+	previous := forwarderTimeout
+	t.Cleanup(func() {
+		forwarderTimeout = previous
+		if err := thread.Reload(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	// Configure only changes the settings read by the workers once they are reloaded
+	forwarderTimeout = time.Hour
+	ctx, cancel := thread.ForwarderContext()
+	deadline, _ := ctx.Deadline()
+	cancel()
+	if time.Until(deadline) > previous {
+		t.Errorf("forwarder timeout changed to %s before reloading", time.Until(deadline))
+	}
+	if err := thread.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = thread.ForwarderContext()
+	deadline, _ = ctx.Deadline()
+	cancel()
+	if remaining := time.Until(deadline); remaining <= previous || remaining > time.Hour {
+		t.Errorf("forwarder timeout after reloading is %s", remaining)
+	}
+}
+
+func TestUnknownModule(t *testing.T) {
+	inFace := addFace(t, "192.0.2.9")
+	interest, err := operator.command("unknown", "verb", mgmt.MakeControlParameters())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response := sendCommand(t, interest, inFace); response.StatusCode != 501 {
+		t.Errorf("command for unknown module returned %d", response.StatusCode)
+	}
+}
+
+// fetchDataset fetches every segment of a new version of the status dataset, and returns the versioned name and the entries of the dataset.
+func fetchDataset(t *testing.T, name *ndn.Name) (*ndn.Name, []*tlv.Block) {
+	t.Helper()
+	data := expressInterest(t, ndn.NewInterest(name), 0)
+	if data.Name().Size() != name.Size()+2 || !name.PrefixOf(data.Name()) {
+		t.Fatalf("dataset %s answered with %s", name, data.Name())
+	}
+	versioned := data.Name().Prefix(name.Size() + 1)
+	finalBlockID, ok := data.MetaInfo().FinalBlockID().(*ndn.SegmentNameComponent)
+	if !ok {
+		t.Fatalf("dataset %s has no FinalBlockID", data.Name())
+	}
+	lastSegment, err := tlv.DecodeNNI(finalBlockID.Value())
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := append([]byte{}, data.Content()...)
+	for segment := uint64(1); segment <= lastSegment; segment++ {
+		data := expressInterest(t, ndn.NewInterest(versioned.DeepCopy().Append(ndn.NewSegmentNameComponent(segment))), 0)
+		content = append(content, data.Content()...)
+	}
+
+	entries := make([]*tlv.Block, 0)
+	for len(content) > 0 {
+		entry, size, err := tlv.DecodeBlock(content)
+		if err != nil {
+			t.Fatalf("invalid dataset %s: %v", versioned, err)
+		}
+		entry.Parse()
+		entries = append(entries, entry)
+		content = content[size:]
+	}
+	return versioned, entries
+}
+
+// findEntry returns the first dataset entry of the type whose Name is the name, or nil if there is none.
+func findEntry(t *testing.T, entries []*tlv.Block, entryType uint32, name *ndn.Name) *tlv.Block {
+	t.Helper()
+	for _, entry := range entries {
+		if entry.Type() != entryType || entry.Find(tlv.Name) == nil {
+			continue
+		}
+		entryName, err := ndn.DecodeName(entry.Find(tlv.Name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entryName.Equals(name) {
+			return entry
+		}
+	}
+	return nil
+}
+
+// nniField decodes the first non-negative integer of the type in the block, or fails the test if there is none.
+func nniField(t *testing.T, block *tlv.Block, fieldType uint32) uint64 {
+	t.Helper()
+	field := block.Find(fieldType)
+	if field == nil {
+		t.Fatalf("block of type %d has no field of type %d", block.Type(), fieldType)
+	}
+	value, err := tlv.DecodeNNIBlock(field)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func TestStatusDatasets(t *testing.T) {
+	inFace := addFace(t, "192.0.2.11")
+	name := testName(t, "/e2e/datasets")
+	params := mgmt.MakeControlParameters()
+	params.Name = name
+	params.Cost = uint64Param(4)
+	signedCommand(t, "rib", "register", params, inFace, 200)
+	params = mgmt.MakeControlParameters()
+	params.Name = name
+	params.Strategy = testName(t, "/localhost/nfd/strategy/multicast")
+	signedCommand(t, "strategy-choice", "set", params, inFace, 200)
+
+	_, entries := fetchDataset(t, testName(t, localPrefix+"/rib/list"))
+	if entry := findEntry(t, entries, tlv.RibEntry, name); entry == nil {
+		t.Errorf("rib/list has no entry for %s", name)
+	} else if route := entry.Find(tlv.Route); route == nil || route.Parse() != nil || nniField(t, route, tlv.FaceID) != inFace || nniField(t, route, tlv.Cost) != 4 {
+		t.Errorf("rib/list entry for %s does not have the registered route", name)
+	}
+
+	_, entries = fetchDataset(t, testName(t, localPrefix+"/fib/list"))
+	if entry := findEntry(t, entries, tlv.FibEntry, name); entry == nil {
+		t.Errorf("fib/list has no entry for %s", name)
+	} else if nexthop := entry.Find(tlv.NextHopRecord); nexthop == nil || nexthop.Parse() != nil || nniField(t, nexthop, tlv.FaceID) != inFace || nniField(t, nexthop, tlv.Cost) != 4 {
+		t.Errorf("fib/list entry for %s does not have the nexthop of the route", name)
+	}
+
+	_, entries = fetchDataset(t, testName(t, localPrefix+"/strategy-choice/list"))
+	if entry := findEntry(t, entries, tlv.StrategyChoice, name); entry == nil {
+		t.Errorf("strategy-choice/list has no entry for %s", name)
+	} else if strategy := entry.Find(tlv.Strategy); strategy == nil || strategy.Parse() != nil || strategy.Find(tlv.Name) == nil {
+		t.Errorf("strategy-choice/list entry for %s has no strategy", name)
+	} else if strategyName, err := ndn.DecodeName(strategy.Find(tlv.Name)); err != nil || strategyName.String() != "/localhost/nfd/strategy/multicast/v=1" {
+		t.Errorf("strategy-choice/list entry for %s has strategy %v", name, strategyName)
+	}
+
+	_, entries = fetchDataset(t, testName(t, localPrefix+"/faces/list"))
+	found := false
+	for _, entry := range entries {
+		if entry.Type() != tlv.FaceStatus {
+			t.Errorf("faces/list has an entry of type %d", entry.Type())
+		} else if nniField(t, entry, tlv.FaceID) == inFace {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("faces/list has no entry for face %d", inFace)
+	}
+
+	filter := mgmt.MakeFaceQueryFilter()
+	filter.FaceID = &inFace
+	encodedFilter, err := filter.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	filterWire, err := encodedFilter.Wire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	queryName := testName(t, localPrefix+"/faces/query").Append(ndn.NewGenericNameComponent(filterWire))
+	if _, entries = fetchDataset(t, queryName); len(entries) != 1 || nniField(t, entries[0], tlv.FaceID) != inFace {
+		t.Errorf("faces/query for face %d returned %d entries", inFace, len(entries))
+	}
+
+	_, entries = fetchDataset(t, testName(t, localPrefix+"/faces/channels"))
+	for _, entry := range entries {
+		if entry.Type() != tlv.ChannelStatus {
+			t.Errorf("faces/channels has an entry of type %d", entry.Type())
+		}
+	}
+
+	_, entries = fetchDataset(t, testName(t, localPrefix+"/status/general"))
+	if len(entries) == 0 || entries[0].Type() != tlv.NfdVersion || string(entries[0].Value()) != "fakeforwarder" {
+		t.Error("status/general does not start with the NfdVersion of the forwarder")
+	}
+
+	_, entries = fetchDataset(t, testName(t, localPrefix+"/cs/info"))
+	if len(entries) != 1 || entries[0].Type() != tlv.CsInfo || nniField(t, entries[0], tlv.Capacity) != uint64(forwarder.CsCapacity()) {
+		t.Errorf("cs/info does not have the capacity of the CS")
+	}
+}
+
+func TestDatasetVersion(t *testing.T) {
+	name := testName(t, localPrefix+"/rib/list")
+	versioned, _ := fetchDataset(t, name)
+
+	// A segment of a version that was fetched is served from the cache
+	segmentName := versioned.DeepCopy().Append(ndn.NewSegmentNameComponent(0))
+	if data := expressInterest(t, ndn.NewInterest(segmentName), 0); !data.Name().Equals(segmentName) {
+		t.Errorf("Interest for %s answered with %s", segmentName, data.Name())
+	}
+	expectNoAnswer(t, ndn.NewInterest(versioned.DeepCopy().Append(ndn.NewSegmentNameComponent(1000))), 0)
+
+	// Each dataset Interest without a version causes a new version to be generated
+	if next, _ := fetchDataset(t, name); next.At(-1).(*ndn.VersionNameComponent).Version() <= versioned.At(-1).(*ndn.VersionNameComponent).Version() {
+		t.Errorf("version %s follows version %s", next, versioned)
+	}
+}
+
+func TestDatasetMetadata(t *testing.T) {
+	name := testName(t, localPrefix+"/faces/list")
+	metadataName := name.DeepCopy().Append(ndn.NewKeywordNameComponent([]byte("metadata")))
+	interest := ndn.NewInterest(metadataName)
+	interest.SetCanBePrefix(true)
+	interest.SetMustBeFresh(true)
+	data := expressInterest(t, interest, 0)
+
+	if data.Name().Size() != metadataName.Size()+2 || !metadataName.PrefixOf(data.Name()) {
+		t.Fatalf("metadata Interest answered with %s", data.Name())
+	}
+	if freshness := data.MetaInfo().FreshnessPeriod(); freshness == nil || *freshness != metadataFreshnessPeriod {
+		t.Errorf("metadata has FreshnessPeriod %v", freshness)
+	}
+	block, _, err := tlv.DecodeBlock(data.Content())
+	if err != nil {
+		t.Fatal(err)
+	}
+	versioned, err := ndn.DecodeName(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if versioned.Size() != name.Size()+1 || !name.PrefixOf(versioned) || versioned.At(-1).Type() != tlv.VersionNameComponent {
+		t.Fatalf("metadata contains %s, which is not a version of %s", versioned, name)
+	}
+
+	// The version named in the metadata can be fetched
+	segmentName := versioned.DeepCopy().Append(ndn.NewSegmentNameComponent(0))
+	if data := expressInterest(t, ndn.NewInterest(segmentName), 0); !data.Name().Equals(segmentName) {
+		t.Errorf("Interest for %s answered with %s", segmentName, data.Name())
+	}
+}
+
+// prefixAnnouncement encodes ApplicationParameters containing a PrefixAnnouncement for the prefix, which has a ValidityPeriod unless notBefore is zero.
+func prefixAnnouncement(t *testing.T, prefix *ndn.Name, expirationPeriod time.Duration, notBefore time.Time, notAfter time.Time) *tlv.Block {
+	t.Helper()
+	content, err := tlv.EncodeNNIBlock(tlv.ExpirationPeriod, uint64(expirationPeriod.Milliseconds())).Wire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !notBefore.IsZero() {
+		validityPeriod := tlv.NewEmptyBlock(tlv.ValidityPeriod)
+		validityPeriod.Append(tlv.NewBlock(tlv.NotBefore, []byte(notBefore.UTC().Format(certificateTimeLayout))))
+		validityPeriod.Append(tlv.NewBlock(tlv.NotAfter, []byte(notAfter.UTC().Format(certificateTimeLayout))))
+		wire, err := validityPeriod.Wire()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content = append(content, wire...)
+	}
+	name := prefix.DeepCopy().Append(ndn.NewKeywordNameComponent([]byte("PA"))).Append(ndn.NewVersionNameComponent(1)).Append(ndn.NewSegmentNameComponent(0))
+	data := ndn.NewData(name, content)
+	metaInfo := ndn.NewMetaInfo()
+	metaInfo.SetContentType(5)
+	data.SetMetaInfo(metaInfo)
+	encoded, err := data.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wire, err := encoded.Wire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tlv.NewBlock(tlv.ApplicationParameters, wire)
+}
+
+func TestAnnounce(t *testing.T) {
+	inFace := addFace(t, "192.0.2.12")
+	announceName := testName(t, localPrefix+"/rib/announce")
+	now := time.Now()
+
+	for _, test := range []struct {
+		description      string
+		prefix           string
+		notBefore        time.Time
+		notAfter         time.Time
+		expectedStatus   uint64
+		expectedLifetime time.Duration
+	}{
+		{"without ValidityPeriod", "/e2e/announce/unbounded", time.Time{}, time.Time{}, 200, time.Hour},
+		{"within ValidityPeriod", "/e2e/announce/valid", now.Add(-time.Hour), now.Add(time.Minute), 200, time.Minute},
+		{"expired", "/e2e/announce/expired", now.Add(-2 * time.Hour), now.Add(-time.Hour), 416, 0},
+		{"not yet valid", "/e2e/announce/future", now.Add(time.Hour), now.Add(2 * time.Hour), 416, 0},
+	} {
+		prefix := testName(t, test.prefix)
+		interest, err := operator.sign(announceName.DeepCopy(), prefixAnnouncement(t, prefix, time.Hour, test.notBefore, test.notAfter))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := sendCommand(t, interest, inFace)
+		if response.StatusCode != test.expectedStatus {
+			t.Errorf("%s: rib/announce returned %d %s", test.description, response.StatusCode, response.StatusText)
+			continue
+		}
+		if test.expectedStatus != 200 {
+			if nexthops := forwarder.NextHops(prefix); len(nexthops) != 0 {
+				t.Errorf("%s: rejected announcement added nexthops %v", test.description, nexthops)
+			}
+			continue
+		}
+
+		announced := responseParams(t, response)
+		if announced.Origin == nil || *announced.Origin != table.RouteOriginPrefixAnn {
+			t.Errorf("%s: route has Origin %v", test.description, announced.Origin)
+		}
+		// The ExpirationPeriod is the more restrictive of the ExpirationPeriod and the ValidityPeriod
+		if expirationPeriod := announced.ExpirationPeriod; expirationPeriod == nil || *expirationPeriod > uint64(test.expectedLifetime.Milliseconds()) || *expirationPeriod < uint64((test.expectedLifetime-time.Minute/2).Milliseconds()) {
+			t.Errorf("%s: route has ExpirationPeriod %v, expected about %s", test.description, expirationPeriod, test.expectedLifetime)
+		}
+		if nexthops := forwarder.NextHops(prefix); !reflect.DeepEqual(nexthops, map[uint64]uint64{inFace: 0}) {
+			t.Errorf("%s: nexthops after rib/announce are %v", test.description, nexthops)
+		}
+	}
+
+	interest, err := operator.sign(announceName.DeepCopy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response := sendCommand(t, interest, inFace); response.StatusCode != 400 {
+		t.Errorf("rib/announce without PrefixAnnouncement returned %d", response.StatusCode)
+	}
+}
+
+// waitForFaceEvent waits for the notification of the event published by management, skipping other notifications.
+func waitForFaceEvent(t *testing.T, faceID uint64, eventType mgmtconn.EventType) *ndn.Data {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		var packet fakeforwarder.Packet
+		select {
+		case packet = <-forwarder.Notifications():
+		case <-timeout:
+			t.Fatalf("no notification of event %d of face %d", eventType, faceID)
+		}
+		if packet.Block.Type() != tlv.Data {
+			continue
+		}
+		data, err := ndn.DecodeData(packet.Block, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		notification, _, err := tlv.DecodeBlock(data.Content())
+		if err != nil || notification.Type() != tlv.FaceEventNotification || notification.Parse() != nil {
+			continue
+		}
+		if nniField(t, notification, tlv.FaceID) == faceID && nniField(t, notification, tlv.FaceEventKind) == uint64(eventType) {
+			return data
+		}
+	}
+}
+
+// eventID returns the ID of a face event from the sequence number at the end of its name.
+func eventID(t *testing.T, data *ndn.Data) uint64 {
+	t.Helper()
+	component, ok := data.Name().At(-1).(*ndn.SequenceNumNameComponent)
+	if !ok {
+		t.Fatalf("face event %s does not end with a sequence number", data.Name())
+	}
+	id, err := tlv.DecodeNNI(component.Value())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestFaceEvents(t *testing.T) {
+	eventsName := testName(t, localPrefix+"/faces/events")
+	faceID := forwarder.AddFace(ndn.MakeUDPFaceURI(4, "192.0.2.13", 6363))
+	created := waitForFaceEvent(t, faceID, mgmtconn.EventFaceCreated)
+	if created.Name().Size() != eventsName.Size()+1 || !eventsName.PrefixOf(created.Name()) {
+		t.Errorf("face event is named %s", created.Name())
+	}
+
+	// Events can be fetched by their ID, and the latest with the prefix
+	if data := expressInterest(t, ndn.NewInterest(created.Name()), 0); !data.Name().Equals(created.Name()) || !bytes.Equal(data.Content(), created.Content()) {
+		t.Errorf("Interest for face event %s answered with %s", created.Name(), data.Name())
+	}
+	latest := ndn.NewInterest(eventsName)
+	latest.SetCanBePrefix(true)
+	if data := expressInterest(t, latest, 0); !data.Name().Equals(created.Name()) {
+		t.Errorf("Interest for the latest face event answered with %s instead of %s", data.Name(), created.Name())
+	}
+
+	forwarder.RemoveFace(faceID)
+	destroyed := waitForFaceEvent(t, faceID, mgmtconn.EventFaceDestroyed)
+	if eventID(t, destroyed) <= eventID(t, created) {
+		t.Errorf("face event %d follows face event %d", eventID(t, destroyed), eventID(t, created))
+	}
+	expectNoAnswer(t, ndn.NewInterest(eventsName.DeepCopy().Append(ndn.NewSequenceNumNameComponent(eventID(t, destroyed)+1000))), 0)
+}
+
+func TestLocalhopCommands(t *testing.T) {
+	inFace := addFace(t, "192.0.2.14")
+	allowed := testName(t, "/e2e/localhop/allowed")
+	params := mgmt.MakeControlParameters()
+	params.Name = allowed
+	interest, err := router.commandUnder(localhopPrefix, "rib", "register", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Localhop commands are dropped unless localhop management is enabled
+	expectNoAnswer(t, interest, inFace)
+
+	schemaFile := filepath.Join(t.TempDir(), "localhop-schema.toml")
+	if err := os.WriteFile(schemaFile, []byte("[[rule]]\nkey = \"/test/router/KEY/<>\"\nprefix = \"/e2e/localhop/<>*\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	enableLocalhopManagement, localhopTrustSchemaFile = true, schemaFile
+	t.Cleanup(func() {
+		enableLocalhopManagement, localhopTrustSchemaFile = false, ""
+		if err := thread.Reload(); err != nil {
+			t.Error(err)
+		}
+	})
+	if err := thread.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	interest, err = router.commandUnder(localhopPrefix, "rib", "register", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response := sendCommand(t, interest, inFace); response.StatusCode != 200 {
+		t.Errorf("localhop command signed within the trust schema returned %d %s", response.StatusCode, response.StatusText)
+	}
+	if nexthops := forwarder.NextHops(allowed); !reflect.DeepEqual(nexthops, map[uint64]uint64{inFace: 0}) {
+		t.Errorf("nexthops after localhop rib/register are %v", nexthops)
+	}
+
+	// Commands signed by a key, or for a prefix, outside the trust schema are rejected, even when trusted as local commands
+	denied := testName(t, "/e2e/localhop-denied")
+	params = mgmt.MakeControlParameters()
+	params.Name = denied
+	interest, err = router.commandUnder(localhopPrefix, "rib", "register", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response := sendCommand(t, interest, inFace); response.StatusCode != 403 {
+		t.Errorf("localhop command for a prefix outside the trust schema returned %d", response.StatusCode)
+	}
+	params = mgmt.MakeControlParameters()
+	params.Name = testName(t, "/e2e/localhop/operator")
+	interest, err = operator.commandUnder(localhopPrefix, "rib", "register", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response := sendCommand(t, interest, inFace); response.StatusCode != 403 {
+		t.Errorf("localhop command signed outside the trust schema returned %d", response.StatusCode)
+	}
+	if len(forwarder.NextHops(denied)) != 0 || len(forwarder.NextHops(params.Name)) != 0 {
+		t.Error("rejected localhop commands changed the FIB")
+	}
+
+	// Only the localhop verbs are accepted under the localhop prefix
+	params = mgmt.MakeControlParameters()
+	params.URI = ndn.MakeUDPFaceURI(4, "192.0.2.15", 6363)
+	interest, err = router.commandUnder(localhopPrefix, "faces", "create", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectNoAnswer(t, interest, inFace)
+}
@@ -0,0 +1,123 @@
+package modules
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/named-data/YaNFD/core"
+	"github.com/named-data/YaNFD/ndn"
+	"github.com/pelletier/go-toml"
+)
+
+// localhopVerbs lists the verbs of each module that may be issued under the localhop prefix.
+var localhopVerbs = map[string]map[string]bool{
+	"rib": {"register": true, "unregister": true},
+}
+
+// namePattern matches names component by component. "<>" matches any single component and a trailing "<>*" matches any number of remaining components.
+type namePattern struct {
+	components []string
+	anySuffix  bool
+}
+
+func makeNamePattern(pattern string) (*namePattern, error) {
+	p := new(namePattern)
+	if strings.Trim(pattern, "/") == "" {
+		return p, nil
+	}
+	rawComponents := strings.Split(strings.Trim(pattern, "/"), "/")
+	for i, rawComponent := range rawComponents {
+		switch rawComponent {
+		case "<>*":
+			if i != len(rawComponents)-1 {
+				return nil, errors.New("<>* must be the last component of pattern " + pattern)
+			}
+			p.anySuffix = true
+		case "<>":
+			p.components = append(p.components, rawComponent)
+		default:
+			// Canonicalize the component so that it compares equal to the components of decoded names
+			name, err := ndn.NameFromString("/" + rawComponent)
+			if err != nil || name.Size() != 1 {
+				return nil, errors.New("invalid component '" + rawComponent + "' in pattern " + pattern)
+			}
+			p.components = append(p.components, name.At(0).String())
+		}
+	}
+	return p, nil
+}
+
+func (p *namePattern) matches(name *ndn.Name) bool {
+	if name.Size() < len(p.components) || (!p.anySuffix && name.Size() != len(p.components)) {
+		return false
+	}
+	for i, component := range p.components {
+		if component != "<>" && component != name.At(i).String() {
+			return false
+		}
+	}
+	return true
+}
+
+// trustSchemaRule allows keys matching a pattern to manage prefixes matching a pattern.
+type trustSchemaRule struct {
+	key    *namePattern
+	prefix *namePattern
+}
+
+// trustSchema determines which keys may issue localhop commands, and for which prefixes.
+type trustSchema struct {
+	rules []*trustSchemaRule
+}
+
+func (t *trustSchema) String() string {
+	return "LocalhopTrustSchema"
+}
+
+// loadTrustSchema loads a trust schema file in the following format:
+//
+//	[[rule]]
+//	key = "/ndn/<>/%C1.Router/<>/KEY/<>"
+//	prefix = "/ndn/<>*"
+func loadTrustSchema(file string) (*trustSchema, error) {
+	tree, err := toml.LoadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		Rules []struct {
+			Key    string `toml:"key"`
+			Prefix string `toml:"prefix"`
+		} `toml:"rule"`
+	}
+	if err := tree.Unmarshal(&config); err != nil {
+		return nil, err
+	}
+
+	t := new(trustSchema)
+	for _, rawRule := range config.Rules {
+		rule := new(trustSchemaRule)
+		if rule.key, err = makeNamePattern(rawRule.Key); err != nil {
+			return nil, err
+		}
+		if rule.prefix, err = makeNamePattern(rawRule.Prefix); err != nil {
+			return nil, err
+		}
+		t.rules = append(t.rules, rule)
+	}
+	core.LogInfo(t, "Loaded ", len(t.rules), " rules from ", file)
+	return t, nil
+}
+
+// authorize returns whether the key may issue a localhop command for the target prefix.
+func (t *trustSchema) authorize(keyName *ndn.Name, target *ndn.Name) bool {
+	if target == nil {
+		return false
+	}
+	for _, rule := range t.rules {
+		if rule.key.matches(keyName) && rule.prefix.matches(target) {
+			return true
+		}
+	}
+	return false
+}
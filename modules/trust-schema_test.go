@@ -0,0 +1,111 @@
+package modules
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/named-data/YaNFD/ndn/mgmt"
+)
+
+// loadTestTrustSchema writes the trust schema to a file and loads it.
+func loadTestTrustSchema(t *testing.T, schema string) *trustSchema {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "schema.toml")
+	if err := os.WriteFile(file, []byte(schema), 0600); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadTrustSchema(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loaded
+}
+
+func TestNamePattern(t *testing.T) {
+	for pattern, names := range map[string]map[string]bool{
+		"/ndn/<>/%C1.Router/<>/KEY/<>": {
+			"/ndn/edu/%C1.Router/r1/KEY/k1":    true,
+			"/ndn/edu/%C1.Router/r1/KEY":       false,
+			"/ndn/edu/%C1.Router/r1/KEY/k1/v1": false,
+			"/ndn/edu/Router/r1/KEY/k1":        false,
+		},
+		"/ndn/<>*": {
+			"/ndn":       true,
+			"/ndn/a/b/c": true,
+			"/other/a":   false,
+		},
+		"/": {
+			"/":  true,
+			"/a": false,
+		},
+	} {
+		p, err := makeNamePattern(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, expected := range names {
+			if p.matches(testName(t, name)) != expected {
+				t.Errorf("pattern %s matching %s is not %t", pattern, name, expected)
+			}
+		}
+	}
+
+	for _, pattern := range []string{"/ndn/<>*/a", "/ndn/a=b=c"} {
+		if _, err := makeNamePattern(pattern); err == nil {
+			t.Errorf("invalid pattern %s accepted", pattern)
+		}
+	}
+}
+
+func TestTrustSchemaAuthorize(t *testing.T) {
+	schema := loadTestTrustSchema(t, `
+[[rule]]
+key = "/ndn/<>/%C1.Router/<>/KEY/<>"
+prefix = "/ndn/<>*"
+
+[[rule]]
+key = "/ops/KEY/<>"
+prefix = "/<>*"
+`)
+	routerKey := testName(t, "/ndn/edu/%C1.Router/r1/KEY/k1")
+	for _, test := range []struct {
+		key      string
+		target   string
+		expected bool
+	}{
+		{"/ndn/edu/%C1.Router/r1/KEY/k1", "/ndn/edu/site", true},
+		{"/ndn/edu/%C1.Router/r1/KEY/k1", "/other", false},
+		{"/ops/KEY/k2", "/other", true},
+		{"/app/KEY/k3", "/ndn/edu/site", false},
+	} {
+		if schema.authorize(testName(t, test.key), testName(t, test.target)) != test.expected {
+			t.Errorf("authorization of %s for %s is not %t", test.key, test.target, test.expected)
+		}
+	}
+	if schema.authorize(routerKey, nil) {
+		t.Error("command without a target prefix authorized")
+	}
+}
+
+func TestTrustSchemaAppliesToSigner(t *testing.T) {
+	signers := makeTestSigners(t, "/test/operator", "/test/router")
+	operator, router := signers[0], signers[1]
+	validator := makeTestValidator(t, operator, issueTestCertificate(t, operator, router))
+	schema := loadTestTrustSchema(t, "[[rule]]\nkey = \"/test/router/KEY/<>\"\nprefix = \"/<>*\"\n")
+	target := testName(t, "/example")
+
+	for signer, expected := range map[*testSigner]bool{router: true, operator: false} {
+		interest, err := signer.command("rib", "register", mgmt.MakeControlParameters())
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature, err := validator.validate(interest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if schema.authorize(signature.keyName, target) != expected {
+			t.Errorf("trust schema authorization of command signed by %s is not %t", signer.keyName, expected)
+		}
+	}
+}
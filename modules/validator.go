@@ -0,0 +1,333 @@
+package modules
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/named-data/YaNFD/core"
+	"github.com/named-data/YaNFD/ndn"
+	"github.com/named-data/YaNFD/ndn/security"
+	"github.com/named-data/YaNFD/ndn/tlv"
+)
+
+// maxCertificateChainLength is the maximum number of certificates between the key signing a command and a trust anchor.
+const maxCertificateChainLength = 8
+
+// certificateTimeLayout is the format of the NotBefore and NotAfter times of a certificate ValidityPeriod.
+const certificateTimeLayout = "20060102T150405"
+
+// certificate is the public key of an NDN certificate, along with the signature of the certificate by its issuer.
+type certificate struct {
+	name    *ndn.Name
+	keyName *ndn.Name
+	key     crypto.PublicKey
+	// issuer is the KeyLocator name of the signature, or nil if the certificate is not signed
+	issuer         *ndn.Name
+	signatureType  security.SignatureType
+	signedPortion  []byte
+	signatureValue []byte
+	notBefore      time.Time
+	notAfter       time.Time
+}
+
+// commandSignature contains the signature fields of a validated command Interest.
+type commandSignature struct {
+	keyName *ndn.Name
+	time    time.Time
+	nonce   []byte
+	seqNum  *uint64
+}
+
+// commandValidator validates signed command Interests against a set of trust anchors. Commands may be signed by the key of a trust anchor, or by a key whose certificate chain leads to a trust anchor.
+type commandValidator struct {
+	anchors      []*certificate
+	certificates []*certificate
+}
+
+func makeCommandValidator() *commandValidator {
+	return new(commandValidator)
+}
+
+func (v *commandValidator) String() string {
+	return "CommandValidator"
+}
+
+// readCertificate reads an NDN certificate, either raw or base64-encoded, from the specified file.
+func readCertificate(file string) (*certificate, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(raw)), "")); err == nil {
+		raw = decoded
+	}
+
+	block, _, err := tlv.DecodeBlock(raw)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type() != tlv.Data {
+		return nil, errors.New("certificate is not a Data packet")
+	}
+	data, err := ndn.DecodeData(block, false)
+	if err != nil {
+		return nil, err
+	}
+	// Certificate names are /<identity>/KEY/<key-id>/<issuer-id>/<version>
+	if data.Name().Size() < 4 || data.Name().At(data.Name().Size()-4).String() != "KEY" {
+		return nil, errors.New("certificate name " + data.Name().String() + " is not a certificate name")
+	}
+	key, err := x509.ParsePKIXPublicKey(data.Content())
+	if err != nil {
+		return nil, err
+	}
+	c := &certificate{
+		name:    data.Name(),
+		keyName: data.Name().Prefix(data.Name().Size() - 2),
+		key:     key,
+	}
+
+	// The signed portion of a Data packet is everything from the Name to the SignatureInfo
+	var sigInfoBlock *tlv.Block
+	for _, elem := range block.Subelements() {
+		if elem.Type() == tlv.SignatureValue {
+			c.signatureValue = elem.Value()
+			break
+		}
+		wire, err := elem.Wire()
+		if err != nil {
+			return nil, err
+		}
+		c.signedPortion = append(c.signedPortion, wire...)
+		if elem.Type() == tlv.SignatureInfo {
+			sigInfoBlock = elem
+		}
+	}
+	if sigInfoBlock == nil || c.signatureValue == nil {
+		return c, nil
+	}
+	sigInfo, err := ndn.DecodeSignatureInfo(sigInfoBlock)
+	if err != nil {
+		return nil, err
+	}
+	c.signatureType = sigInfo.Type()
+	if sigInfo.KeyLocator() != nil {
+		if c.issuer, err = decodeKeyLocatorName(sigInfo.KeyLocator()); err != nil {
+			return nil, err
+		}
+	}
+	if validityPeriod := sigInfoBlock.Find(tlv.ValidityPeriod); validityPeriod != nil {
+		if c.notBefore, c.notAfter, err = decodeValidityPeriod(validityPeriod); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// decodeValidityPeriod returns the NotBefore and NotAfter times of a ValidityPeriod block.
+func decodeValidityPeriod(validityPeriod *tlv.Block) (time.Time, time.Time, error) {
+	if err := validityPeriod.Parse(); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	notBeforeBlock := validityPeriod.Find(tlv.NotBefore)
+	notAfterBlock := validityPeriod.Find(tlv.NotAfter)
+	if notBeforeBlock == nil || notAfterBlock == nil {
+		return time.Time{}, time.Time{}, errors.New("incomplete ValidityPeriod")
+	}
+	notBefore, err := time.Parse(certificateTimeLayout, string(notBeforeBlock.Value()))
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	notAfter, err := time.Parse(certificateTimeLayout, string(notAfterBlock.Value()))
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return notBefore, notAfter, nil
+}
+
+// loadTrustAnchor loads an NDN certificate, either raw or base64-encoded, from the specified file and trusts its key.
+func (v *commandValidator) loadTrustAnchor(file string) error {
+	anchor, err := readCertificate(file)
+	if err != nil {
+		return err
+	}
+	v.anchors = append(v.anchors, anchor)
+	core.LogInfo(v, "Loaded trust anchor for Key=", anchor.keyName)
+	return nil
+}
+
+// loadCertificate loads an NDN certificate, either raw or base64-encoded, from the specified file. Its key is only trusted once the certificate chain leads to a trust anchor, which is checked whenever a command is validated.
+func (v *commandValidator) loadCertificate(file string) error {
+	c, err := readCertificate(file)
+	if err != nil {
+		return err
+	}
+	if c.issuer == nil {
+		return errors.New("certificate " + c.name.String() + " has no KeyLocator name")
+	}
+	if c.notBefore.IsZero() {
+		return errors.New("certificate " + c.name.String() + " has no ValidityPeriod")
+	}
+	v.certificates = append(v.certificates, c)
+	core.LogInfo(v, "Loaded certificate for Key=", c.keyName, " issued by ", c.issuer)
+	return nil
+}
+
+// findCertificate returns the certificate matching the specified KeyLocator name, which may be a key or certificate name.
+func findCertificate(certificates []*certificate, keyLocatorName *ndn.Name) *certificate {
+	for _, c := range certificates {
+		if c.keyName.PrefixOf(keyLocatorName) {
+			return c
+		}
+	}
+	return nil
+}
+
+// findSigner returns the certificate of the key matching the specified KeyLocator name, after checking that its certificate chain leads to a trust anchor. Each certificate in the chain must be valid at the specified time and signed by the key of the next one.
+func (v *commandValidator) findSigner(keyLocatorName *ndn.Name, now time.Time) (*certificate, error) {
+	if anchor := findCertificate(v.anchors, keyLocatorName); anchor != nil {
+		return anchor, nil
+	}
+	signer := findCertificate(v.certificates, keyLocatorName)
+	if signer == nil {
+		return nil, errors.New("no certificate for KeyLocator " + keyLocatorName.String())
+	}
+
+	current := signer
+	for i := 0; i < maxCertificateChainLength; i++ {
+		if now.Before(current.notBefore) || now.After(current.notAfter) {
+			return nil, errors.New("certificate " + current.name.String() + " is not valid at this time")
+		}
+		issuer := findCertificate(v.anchors, current.issuer)
+		isAnchor := issuer != nil
+		if !isAnchor {
+			issuer = findCertificate(v.certificates, current.issuer)
+		}
+		if issuer == nil {
+			return nil, errors.New("no certificate for issuer " + current.issuer.String() + " of certificate " + current.name.String())
+		}
+		if err := verifySignature(issuer.key, current.signatureType, current.signedPortion, current.signatureValue); err != nil {
+			return nil, errors.New("certificate " + current.name.String() + ": " + err.Error())
+		}
+		if isAnchor {
+			return signer, nil
+		}
+		current = issuer
+	}
+	return nil, errors.New("certificate chain of " + signer.name.String() + " does not reach a trust anchor")
+}
+
+// decodeKeyLocatorName returns the name in a KeyLocator.
+func decodeKeyLocatorName(keyLocator *tlv.Block) (*ndn.Name, error) {
+	if len(keyLocator.Subelements()) == 0 {
+		keyLocator.Parse()
+	}
+	if keyLocator.Find(tlv.Name) == nil {
+		return nil, errors.New("KeyLocator does not contain a Name")
+	}
+	return ndn.DecodeName(keyLocator.Find(tlv.Name))
+}
+
+// verifySignature checks a signature of the specified type over the signed portion with the key.
+func verifySignature(key crypto.PublicKey, signatureType security.SignatureType, signedPortion []byte, signatureValue []byte) error {
+	digest := sha256.Sum256(signedPortion)
+	switch signatureType {
+	case security.SignatureSha256WithEcdsaType:
+		key, ok := key.(*ecdsa.PublicKey)
+		if !ok || !ecdsa.VerifyASN1(key, digest[:], signatureValue) {
+			return errors.New("invalid signature")
+		}
+	case security.SignatureSha256WithRsaType:
+		key, ok := key.(*rsa.PublicKey)
+		if !ok || rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signatureValue) != nil {
+			return errors.New("invalid signature")
+		}
+	default:
+		return errors.New("unsupported SignatureType")
+	}
+	return nil
+}
+
+// validate checks the InterestSignatureInfo and InterestSignatureValue of a command Interest against the trust anchors. The returned signature has the name of the key that signed the command, which is not necessarily the key of a trust anchor.
+func (v *commandValidator) validate(interest *ndn.Interest) (*commandSignature, error) {
+	var sigInfoBlock *tlv.Block
+	var sigValue []byte
+	signedPortion := make([]byte, 0)
+
+	// Signed portion is all name components except ParametersSha256DigestComponent, followed by ApplicationParameters to InterestSignatureInfo
+	for i := 0; i < interest.Name().Size(); i++ {
+		component := interest.Name().At(i)
+		if component.Type() == tlv.ParametersSha256DigestComponent {
+			continue
+		}
+		wire, err := component.Encode().Wire()
+		if err != nil {
+			return nil, err
+		}
+		signedPortion = append(signedPortion, wire...)
+	}
+	for _, param := range interest.ApplicationParameters() {
+		param := param
+		if param.Type() == tlv.InterestSignatureValue {
+			sigValue = param.Value()
+			break
+		}
+		wire, err := param.Wire()
+		if err != nil {
+			return nil, err
+		}
+		signedPortion = append(signedPortion, wire...)
+		if param.Type() == tlv.InterestSignatureInfo {
+			sigInfoBlock = &param
+		}
+	}
+	if sigInfoBlock == nil || sigValue == nil {
+		return nil, errors.New("command is not signed")
+	}
+
+	sigInfo, err := ndn.DecodeSignatureInfo(sigInfoBlock)
+	if err != nil {
+		return nil, err
+	}
+	if sigInfo.KeyLocator() == nil {
+		return nil, errors.New("missing KeyLocator")
+	}
+	keyLocatorName, err := decodeKeyLocatorName(sigInfo.KeyLocator())
+	if err != nil {
+		return nil, err
+	}
+
+	signature := new(commandSignature)
+	signature.nonce = sigInfo.Nonce()
+	signature.seqNum = sigInfo.SeqNum()
+	if len(signature.nonce) == 0 {
+		return nil, errors.New("missing SignatureNonce")
+	}
+	// SignatureTime is decoded here since the decoder in YaNFD mishandles the millisecond remainder
+	if sigInfoBlock.Find(tlv.SignatureTime) == nil {
+		return nil, errors.New("missing SignatureTime")
+	}
+	timeMS, err := tlv.DecodeNNIBlock(sigInfoBlock.Find(tlv.SignatureTime))
+	if err != nil {
+		return nil, err
+	}
+	signature.time = time.UnixMilli(int64(timeMS))
+
+	signer, err := v.findSigner(keyLocatorName, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	signature.keyName = signer.keyName
+	if err := verifySignature(signer.key, sigInfo.Type(), signedPortion, sigValue); err != nil {
+		return nil, err
+	}
+	return signature, nil
+}
@@ -0,0 +1,97 @@
+package modules
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/named-data/YaNFD/ndn/mgmt"
+)
+
+// makeTestValidator returns a validator trusting the key of the anchor, with the certificates in the files.
+func makeTestValidator(t *testing.T, anchor *testSigner, certificateFiles ...string) *commandValidator {
+	t.Helper()
+	anchorFile := filepath.Join(t.TempDir(), "anchor.ndncert")
+	if err := anchor.writeCertificate(anchorFile); err != nil {
+		t.Fatal(err)
+	}
+	validator := makeCommandValidator()
+	if err := validator.loadTrustAnchor(anchorFile); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range certificateFiles {
+		if err := validator.loadCertificate(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return validator
+}
+
+// issueTestCertificate writes a certificate for the subject signed by the issuer, valid for an hour around now, and returns its file.
+func issueTestCertificate(t *testing.T, issuer *testSigner, subject *testSigner) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "certificate.ndncert")
+	if err := issuer.issueCertificate(file, subject, time.Now().Add(-time.Hour), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestValidateCertificateChain(t *testing.T) {
+	signers := makeTestSigners(t, "/test/operator", "/test/site", "/test/site/router")
+	operator, site, router := signers[0], signers[1], signers[2]
+	validator := makeTestValidator(t, operator, issueTestCertificate(t, site, router), issueTestCertificate(t, operator, site))
+
+	for _, signer := range []*testSigner{operator, site, router} {
+		interest, err := signer.command("rib", "register", mgmt.MakeControlParameters())
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature, err := validator.validate(interest)
+		if err != nil {
+			t.Errorf("command signed by %s rejected: %v", signer.keyName, err)
+			continue
+		}
+		if !signature.keyName.Equals(signer.keyName) {
+			t.Errorf("command signed by %s validated as signed by %s", signer.keyName, signature.keyName)
+		}
+	}
+}
+
+func TestValidateBrokenCertificateChain(t *testing.T) {
+	signers := makeTestSigners(t, "/test/operator", "/test/site", "/test/site/router", "/test/stranger")
+	operator, site, router, stranger := signers[0], signers[1], signers[2], signers[3]
+
+	tampered := issueTestCertificate(t, operator, router)
+	wire, err := os.ReadFile(tampered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wire[len(wire)-1] ^= 0xff
+	if err := os.WriteFile(tampered, wire, 0600); err != nil {
+		t.Fatal(err)
+	}
+	expired := filepath.Join(t.TempDir(), "expired.ndncert")
+	if err := operator.issueCertificate(expired, router, time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	for description, certificateFiles := range map[string][]string{
+		"no certificate":             {},
+		"no issuer certificate":      {issueTestCertificate(t, site, router)},
+		"untrusted issuer":           {issueTestCertificate(t, stranger, router), issueTestCertificate(t, stranger, stranger)},
+		"invalid signature":          {tampered},
+		"expired certificate":        {expired},
+		"certificate of another key": {issueTestCertificate(t, operator, site)},
+	} {
+		validator := makeTestValidator(t, operator, certificateFiles...)
+		interest, err := router.command("rib", "register", mgmt.MakeControlParameters())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if signature, err := validator.validate(interest); err == nil {
+			t.Errorf("%s: command validated as signed by %s", description, signature.keyName)
+		}
+	}
+}
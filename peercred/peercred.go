@@ -0,0 +1,98 @@
+// Package peercred checks the credentials of the process on the other end of a unix socket against an allowlist.
+package peercred
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Credentials identify the process on the other end of a unix socket, as of when the socket was connected.
+type Credentials struct {
+	PID int32
+	UID uint32
+	GID uint32
+}
+
+func (c Credentials) String() string {
+	return fmt.Sprintf("pid=%d uid=%d gid=%d", c.PID, c.UID, c.GID)
+}
+
+// Allowlist contains the UIDs, GIDs, and PIDs allowed on the other end of a socket. A peer is allowed if any of its credentials is listed. An empty or nil Allowlist allows every peer without checking.
+type Allowlist struct {
+	uids map[uint32]bool
+	gids map[uint32]bool
+	pids map[int32]bool
+}
+
+// DeniedError is returned when the peer of a socket is not in the allowlist.
+type DeniedError struct {
+	Credentials Credentials
+}
+
+func (e *DeniedError) Error() string {
+	return "peer " + e.Credentials.String() + " is not in the allowlist"
+}
+
+// ParseAllowlist parses allowlist entries of the form "uid=N", "gid=N", or "pid=N".
+func ParseAllowlist(entries []string) (*Allowlist, error) {
+	a := &Allowlist{
+		uids: make(map[uint32]bool),
+		gids: make(map[uint32]bool),
+		pids: make(map[int32]bool),
+	}
+	for _, entry := range entries {
+		kind, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, errors.New("allowlist entry '" + entry + "' is not of the form uid=N, gid=N, or pid=N")
+		}
+		kind = strings.TrimSpace(kind)
+		// UIDs and GIDs are unsigned 32-bit integers, while PIDs are positive signed ones
+		bitSize := 32
+		if kind == "pid" {
+			bitSize = 31
+		}
+		id, err := strconv.ParseUint(strings.TrimSpace(value), 10, bitSize)
+		if err != nil {
+			return nil, errors.New("allowlist entry '" + entry + "' does not contain a valid ID")
+		}
+		switch kind {
+		case "uid":
+			a.uids[uint32(id)] = true
+		case "gid":
+			a.gids[uint32(id)] = true
+		case "pid":
+			a.pids[int32(id)] = true
+		default:
+			return nil, errors.New("allowlist entry '" + entry + "' is not of the form uid=N, gid=N, or pid=N")
+		}
+	}
+	return a, nil
+}
+
+// Empty returns whether the allowlist has no entries, in which case peers are not checked.
+func (a *Allowlist) Empty() bool {
+	return a == nil || len(a.uids)+len(a.gids)+len(a.pids) == 0
+}
+
+// Allows returns whether a peer with the credentials is allowed.
+func (a *Allowlist) Allows(c Credentials) bool {
+	return a.Empty() || a.uids[c.UID] || a.gids[c.GID] || a.pids[c.PID]
+}
+
+// Check returns an error if the peer of a unix socket is not allowed, or its credentials cannot be obtained. Peers are not checked if the allowlist is empty.
+func (a *Allowlist) Check(conn net.Conn) error {
+	if a.Empty() {
+		return nil
+	}
+	credentials, err := Get(conn)
+	if err != nil {
+		return err
+	}
+	if !a.Allows(credentials) {
+		return &DeniedError{Credentials: credentials}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+//go:build linux
+
+package peercred
+
+import (
+	"errors"
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Get returns the credentials of the peer of a unix socket, as reported by SO_PEERCRED.
+func Get(conn net.Conn) (Credentials, error) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return Credentials{}, errors.New("connection is not a socket")
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return Credentials{}, err
+	}
+	var ucred *unix.Ucred
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		ucred, sockErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if err != nil {
+		return Credentials{}, err
+	}
+	if sockErr != nil {
+		return Credentials{}, sockErr
+	}
+	return Credentials{PID: ucred.Pid, UID: ucred.Uid, GID: ucred.Gid}, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package peercred
+
+import (
+	"errors"
+	"net"
+)
+
+// Get returns an error, since SO_PEERCRED is only available on Linux.
+func Get(conn net.Conn) (Credentials, error) {
+	return Credentials{}, errors.New("peer credentials are not supported on this platform")
+}
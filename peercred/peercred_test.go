@@ -0,0 +1,115 @@
+package peercred
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestParseAllowlist(t *testing.T) {
+	allowlist, err := ParseAllowlist([]string{"uid=1000", " gid = 4294967295 ", "pid=2147483647"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		credentials Credentials
+		expected    bool
+	}{
+		{Credentials{PID: 1, UID: 1000, GID: 1}, true},
+		{Credentials{PID: 1, UID: 1, GID: 4294967295}, true},
+		{Credentials{PID: 2147483647, UID: 1, GID: 1}, true},
+		{Credentials{PID: 1, UID: 1001, GID: 1000}, false},
+	} {
+		if allowlist.Allows(test.credentials) != test.expected {
+			t.Errorf("allowing %s is not %t", test.credentials, test.expected)
+		}
+	}
+
+	for _, entries := range [][]string{
+		{"uid"},
+		{"uid=-1"},
+		{"uid=4294967296"},
+		{"pid=2147483648"},
+		{"gid=staff"},
+		{"user=1000"},
+	} {
+		if _, err := ParseAllowlist(entries); err == nil {
+			t.Errorf("invalid allowlist %v accepted", entries)
+		}
+	}
+}
+
+func TestEmptyAllowlist(t *testing.T) {
+	for _, allowlist := range []*Allowlist{nil, {}} {
+		if !allowlist.Empty() || !allowlist.Allows(Credentials{PID: 1, UID: 1, GID: 1}) {
+			t.Error("empty allowlist does not allow every peer")
+		}
+		// Peers are not checked, so a connection that is not a socket is allowed
+		if err := allowlist.Check(nil); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// connectedPair returns both ends of a connected unix socket.
+func connectedPair(t *testing.T) (net.Conn, net.Conn) {
+	t.Helper()
+	listener, err := net.Listen("unix", filepath.Join(t.TempDir(), "peercred.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	client, err := net.Dial("unix", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	server, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return client, server
+}
+
+func TestCheck(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("peer credentials are only available on Linux")
+	}
+	_, server := connectedPair(t)
+	credentials, err := Get(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credentials.PID != int32(os.Getpid()) || credentials.UID != uint32(os.Getuid()) || credentials.GID != uint32(os.Getgid()) {
+		t.Errorf("credentials of this process are %s", credentials)
+	}
+
+	allowed, err := ParseAllowlist([]string{"uid=" + strconv.Itoa(os.Getuid())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := allowed.Check(server); err != nil {
+		t.Errorf("peer with allowed UID rejected: %v", err)
+	}
+
+	denied, err := ParseAllowlist([]string{"uid=" + strconv.Itoa(os.Getuid()+1), "pid=" + strconv.Itoa(os.Getpid()+1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var deniedError *DeniedError
+	if err := denied.Check(server); !errors.As(err, &deniedError) || deniedError.Credentials != credentials {
+		t.Errorf("peer not in the allowlist was checked with %v", err)
+	}
+
+	// Credentials cannot be obtained from a connection that is not a socket
+	pipe, _ := net.Pipe()
+	defer pipe.Close()
+	if err := allowed.Check(pipe); err == nil || errors.As(err, &deniedError) {
+		t.Errorf("connection without credentials was checked with %v", err)
+	}
+}
@@ -1,5 +1,8 @@
 package ribinterface
 
+import "context"
+
 type RibInt interface {
-	CleanUpFace(faceId uint64)
+	// Resync pushes the nexthops of every RIB entry to the forwarder again.
+	Resync(ctx context.Context) error
 }
@@ -0,0 +1,269 @@
+package shm
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// ErrMessageTooLarge is returned when writing a message that does not fit in the ring.
+var ErrMessageTooLarge = errors.New("message is larger than the shared memory ring")
+
+// Conn is a net.Conn over a shared memory segment. Each Write is delivered as one message, and each Read returns the next message, or what remains of it if the buffer was too small for the whole message. Reads and writes wait on the rings, and the socket is only used to wake up the peer and to learn that it went away.
+type Conn struct {
+	socket  net.Conn
+	segment *Segment
+	tx      *ring
+	rx      *ring
+	// mutex is held for reading while accessing the segment, and for writing to unmap it
+	mutex   sync.RWMutex
+	readMu  sync.Mutex
+	writeMu sync.Mutex
+	// leftover is the rest of a message that did not fit in the buffer of the last Read
+	leftover []byte
+
+	closeOnce sync.Once
+	done      chan struct{}
+	hungUp    int32
+
+	// wake is closed and replaced when the peer rings the doorbell, the peer goes away, or a deadline changes
+	wakeMu sync.Mutex
+	wake   chan struct{}
+
+	readDeadline  int64
+	writeDeadline int64
+}
+
+// Conn returns a connection over the segment. The socket must be connected to the peer that maps the same segment, and is closed along with the connection.
+func (s *Segment) Conn(socket net.Conn) *Conn {
+	c := &Conn{
+		socket:  socket,
+		segment: s,
+		done:    make(chan struct{}),
+		wake:    make(chan struct{}),
+	}
+	c.tx, c.rx = s.rings()
+	go c.monitor()
+	return c
+}
+
+// monitor reads doorbells from the socket until the peer closes it.
+func (c *Conn) monitor() {
+	buf := make([]byte, 64)
+	for {
+		if _, err := c.socket.Read(buf); err != nil {
+			atomic.StoreInt32(&c.hungUp, 1)
+			c.broadcast()
+			return
+		}
+		c.broadcast()
+	}
+}
+
+func (c *Conn) wakeChannel() <-chan struct{} {
+	c.wakeMu.Lock()
+	defer c.wakeMu.Unlock()
+	return c.wake
+}
+
+func (c *Conn) broadcast() {
+	c.wakeMu.Lock()
+	defer c.wakeMu.Unlock()
+	close(c.wake)
+	c.wake = make(chan struct{})
+}
+
+// ringDoorbell wakes up the peer, which has announced that it is waiting on a ring.
+func (c *Conn) ringDoorbell() {
+	c.socket.Write([]byte{0})
+}
+
+func (c *Conn) isClosed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// wait waits until woken up, the deadline passes, or the connection is closed.
+func (c *Conn) wait(wake <-chan struct{}, deadline *int64) error {
+	var timeout <-chan time.Time
+	if d := atomic.LoadInt64(deadline); d != 0 {
+		remaining := time.Until(time.Unix(0, d))
+		if remaining <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(remaining)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-wake:
+		return nil
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	case <-c.done:
+		return net.ErrClosed
+	}
+}
+
+// Read reads the next message, waiting until one is available.
+func (c *Conn) Read(b []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	if len(c.leftover) == 0 {
+		message, err := c.readMessage()
+		if err != nil {
+			return 0, err
+		}
+		c.leftover = message
+	}
+	n := copy(b, c.leftover)
+	c.leftover = c.leftover[n:]
+	return n, nil
+}
+
+// ReadMessage reads the next message whole, however large it is, waiting until one is available.
+func (c *Conn) ReadMessage() ([]byte, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	if len(c.leftover) > 0 {
+		message := c.leftover
+		c.leftover = nil
+		return message, nil
+	}
+	return c.readMessage()
+}
+
+func (c *Conn) readMessage() ([]byte, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	waiting := false
+	for {
+		// The wake channel is taken before checking the ring, so that a doorbell rung after the check is not missed
+		wake := c.wakeChannel()
+		if c.isClosed() {
+			return nil, net.ErrClosed
+		}
+		message, ok, err := c.rx.tryRead()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			if atomic.SwapUint64(c.rx.writerWaiting(), 0) != 0 {
+				c.ringDoorbell()
+			}
+			return message, nil
+		}
+		if atomic.LoadInt32(&c.hungUp) != 0 {
+			return nil, io.EOF
+		}
+		if !waiting {
+			// Check the ring once more after asking for a doorbell, since the peer may have written before seeing the request
+			atomic.StoreUint64(c.rx.readerWaiting(), 1)
+			waiting = true
+			continue
+		}
+		if err := c.wait(wake, &c.readDeadline); err != nil {
+			return nil, err
+		}
+		waiting = false
+	}
+}
+
+// Write writes a message, waiting until there is space for it in the ring.
+func (c *Conn) Write(b []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if len(b) > c.tx.maxMessageSize() {
+		return 0, ErrMessageTooLarge
+	}
+
+	waiting := false
+	for {
+		wake := c.wakeChannel()
+		if c.isClosed() {
+			return 0, net.ErrClosed
+		}
+		if atomic.LoadInt32(&c.hungUp) != 0 {
+			return 0, io.ErrClosedPipe
+		}
+		if c.tx.tryWrite(b) {
+			if atomic.SwapUint64(c.tx.readerWaiting(), 0) != 0 {
+				c.ringDoorbell()
+			}
+			return len(b), nil
+		}
+		if !waiting {
+			atomic.StoreUint64(c.tx.writerWaiting(), 1)
+			waiting = true
+			continue
+		}
+		if err := c.wait(wake, &c.writeDeadline); err != nil {
+			return 0, err
+		}
+		waiting = false
+	}
+}
+
+// Close closes the socket, which tells the peer that the connection is gone, and unmaps the segment once pending reads and writes have returned.
+func (c *Conn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		err = c.socket.Close()
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		if unmapErr := unix.Munmap(c.segment.mem); err == nil {
+			err = unmapErr
+		}
+	})
+	return err
+}
+
+// LocalAddr returns the local address of the socket.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.socket.LocalAddr()
+}
+
+// RemoteAddr returns the remote address of the socket.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.socket.RemoteAddr()
+}
+
+// SetDeadline sets the read and write deadlines.
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the deadline for Read, waking up a Read that is waiting.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	atomic.StoreInt64(&c.readDeadline, deadlineNanos(t))
+	c.broadcast()
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for Write, waking up a Write that is waiting.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	atomic.StoreInt64(&c.writeDeadline, deadlineNanos(t))
+	c.broadcast()
+	return nil
+}
+
+func deadlineNanos(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
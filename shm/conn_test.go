@@ -0,0 +1,215 @@
+package shm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// socketPair returns the two ends of a connected unix socket as files, which are not inherited by child processes unless passed explicitly.
+func socketPair(t *testing.T) (*os.File, *os.File) {
+	t.Helper()
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return os.NewFile(uintptr(fds[0]), "socket"), os.NewFile(uintptr(fds[1]), "socket")
+}
+
+// fileConn returns a connection over the socket file, which it takes over.
+func fileConn(file *os.File) (net.Conn, error) {
+	defer file.Close()
+	return net.FileConn(file)
+}
+
+// connPair returns connections over both mappings of a segment with the smallest rings.
+func connPair(t *testing.T) (*Conn, *Conn) {
+	t.Helper()
+	creator, peer := mapTestSegment(t)
+	first, second := socketPair(t)
+	firstSocket, err := fileConn(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondSocket, err := fileConn(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The connections unmap the segment when they are closed
+	return creator.Conn(firstSocket), peer.Conn(secondSocket)
+}
+
+func TestConnMessages(t *testing.T) {
+	creator, peer := connPair(t)
+	defer peer.Close()
+
+	// Writers wait for the reader to free space, so many more messages than fit in the ring go through
+	go func() {
+		for i := 0; i < 1000; i++ {
+			if _, err := creator.Write([]byte(fmt.Sprintf("message %d", i))); err != nil {
+				t.Errorf("writing message %d: %v", i, err)
+				return
+			}
+		}
+		creator.Close()
+	}()
+	for i := 0; i < 1000; i++ {
+		message, err := peer.ReadMessage()
+		if err != nil {
+			t.Fatalf("reading message %d: %v", i, err)
+		}
+		if expected := fmt.Sprintf("message %d", i); string(message) != expected {
+			t.Fatalf("read %q instead of %q", message, expected)
+		}
+	}
+	if _, err := peer.ReadMessage(); err != io.EOF {
+		t.Errorf("reading after the peer closed returned %v", err)
+	}
+	if _, err := peer.Write([]byte{1}); err == nil {
+		t.Error("writing after the peer closed succeeded")
+	}
+}
+
+func TestConnPartialRead(t *testing.T) {
+	creator, peer := connPair(t)
+	defer creator.Close()
+	defer peer.Close()
+
+	if _, err := creator.Write(make([]byte, creator.tx.maxMessageSize()+1)); !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("writing a message larger than the ring returned %v", err)
+	}
+
+	message := bytes.Repeat([]byte("0123456789"), 100)
+	if _, err := creator.Write(message); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := creator.Write([]byte("next")); err != nil {
+		t.Fatal(err)
+	}
+	// Each Read returns what remains of the message before the next one
+	var received []byte
+	buf := make([]byte, 300)
+	for len(received) < len(message) {
+		n, err := peer.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		received = append(received, buf[:n]...)
+	}
+	if !bytes.Equal(received, message) {
+		t.Error("message split across reads was corrupted")
+	}
+	if n, err := peer.Read(buf); err != nil || string(buf[:n]) != "next" {
+		t.Errorf("next read returned %q, %v", buf[:n], err)
+	}
+}
+
+func TestConnDeadline(t *testing.T) {
+	creator, peer := connPair(t)
+	defer creator.Close()
+	defer peer.Close()
+
+	peer.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, err := peer.ReadMessage(); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("reading from an empty ring returned %v", err)
+	}
+	for creator.tx.tryWrite(make([]byte, 100)) {
+	}
+	creator.SetWriteDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, err := creator.Write(make([]byte, 100)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("writing to a full ring returned %v", err)
+	}
+}
+
+// TestConnHelperProcess is not a test, but the peer process of TestConnAcrossProcesses, which echoes every message it reads back over the segment in its environment and the socket it inherits.
+func TestConnHelperProcess(t *testing.T) {
+	path := os.Getenv("SHM_TEST_SEGMENT")
+	if path == "" {
+		return
+	}
+	segment, err := Open(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	socket, err := fileConn(os.NewFile(3, "socket"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	conn := segment.Conn(socket)
+	for {
+		message, err := conn.ReadMessage()
+		if err == io.EOF {
+			os.Exit(0)
+		} else if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if _, err := conn.Write(message); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+}
+
+func TestConnAcrossProcesses(t *testing.T) {
+	segment, err := CreateTemp("shm-test-", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer segment.Unlink()
+	local, remote := socketPair(t)
+	child := exec.Command(os.Args[0], "-test.run=^TestConnHelperProcess$")
+	child.Env = append(os.Environ(), "SHM_TEST_SEGMENT="+segment.Path())
+	child.ExtraFiles = []*os.File{remote}
+	child.Stderr = os.Stderr
+	if err := child.Start(); err != nil {
+		segment.Close()
+		t.Fatal(err)
+	}
+	remote.Close()
+	socket, err := fileConn(local)
+	if err != nil {
+		segment.Close()
+		t.Fatal(err)
+	}
+	conn := segment.Conn(socket)
+
+	// The echoed messages fill the rings many times over
+	sizes := []int{1, 100, conn.tx.maxMessageSize(), 1000, 0, 3000}
+	go func() {
+		for i := 0; i < 200; i++ {
+			message := bytes.Repeat([]byte{byte(i)}, sizes[i%len(sizes)])
+			if _, err := conn.Write(message); err != nil {
+				t.Errorf("writing message %d: %v", i, err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		message, err := conn.ReadMessage()
+		if err != nil {
+			conn.Close()
+			t.Fatalf("reading message %d: %v", i, err)
+		}
+		if !bytes.Equal(message, bytes.Repeat([]byte{byte(i)}, sizes[i%len(sizes)])) {
+			t.Errorf("message %d was corrupted", i)
+		}
+	}
+
+	// The peer process sees the connection close and exits
+	conn.Close()
+	if err := child.Wait(); err != nil {
+		t.Errorf("peer process failed: %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package shm
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync/atomic"
+)
+
+// ErrCorruptRing is returned when reading from a ring whose positions or message length, which are written by the peer, are not valid.
+var ErrCorruptRing = errors.New("shared memory ring is corrupt")
+
+// lengthSize is the size of the length prefixed to each message in a ring.
+const lengthSize = 4
+
+// ring is a single-producer single-consumer queue of messages. The write and read positions only increase, and are reduced modulo the ring size when accessing the data.
+type ring struct {
+	segment *Segment
+	header  int
+	data    []byte
+}
+
+func (r *ring) writePos() *uint64 {
+	return r.segment.word(r.header + offsetWritePos)
+}
+
+func (r *ring) readPos() *uint64 {
+	return r.segment.word(r.header + offsetReadPos)
+}
+
+// readerWaiting is set by a reader about to wait for a message, and asks the writer to ring the doorbell.
+func (r *ring) readerWaiting() *uint64 {
+	return r.segment.word(r.header + offsetReaderWaiting)
+}
+
+// writerWaiting is set by a writer about to wait for space, and asks the reader to ring the doorbell.
+func (r *ring) writerWaiting() *uint64 {
+	return r.segment.word(r.header + offsetWriterWaiting)
+}
+
+// maxMessageSize returns the size of the largest message that fits in the ring.
+func (r *ring) maxMessageSize() int {
+	return len(r.data) - lengthSize
+}
+
+// tryWrite appends a message if there is space for it.
+func (r *ring) tryWrite(message []byte) bool {
+	write := atomic.LoadUint64(r.writePos())
+	read := atomic.LoadUint64(r.readPos())
+	size := uint64(lengthSize + len(message))
+	if uint64(len(r.data))-(write-read) < size {
+		return false
+	}
+	var length [lengthSize]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(message)))
+	r.copyIn(write, length[:])
+	r.copyIn(write+lengthSize, message)
+	atomic.StoreUint64(r.writePos(), write+size)
+	return true
+}
+
+// tryRead removes the next message, if there is one, and returns a copy of it. The positions and length written by the peer are checked before anything is allocated, and ErrCorruptRing is returned if they do not describe a message that fits in the ring.
+func (r *ring) tryRead() ([]byte, bool, error) {
+	write := atomic.LoadUint64(r.writePos())
+	read := atomic.LoadUint64(r.readPos())
+	if write == read {
+		return nil, false, nil
+	}
+	available := write - read
+	if available < lengthSize || available > uint64(len(r.data)) {
+		return nil, false, ErrCorruptRing
+	}
+	var length [lengthSize]byte
+	r.copyOut(read, length[:])
+	size := uint64(binary.LittleEndian.Uint32(length[:]))
+	if size > uint64(r.maxMessageSize()) || lengthSize+size > available {
+		return nil, false, ErrCorruptRing
+	}
+	message := make([]byte, size)
+	r.copyOut(read+lengthSize, message)
+	atomic.StoreUint64(r.readPos(), read+lengthSize+size)
+	return message, true, nil
+}
+
+// copyIn copies into the ring starting at a position, wrapping around the end of the data.
+func (r *ring) copyIn(pos uint64, b []byte) {
+	offset := int(pos % uint64(len(r.data)))
+	n := copy(r.data[offset:], b)
+	copy(r.data, b[n:])
+}
+
+// copyOut copies out of the ring starting at a position, wrapping around the end of the data.
+func (r *ring) copyOut(pos uint64, b []byte) {
+	offset := int(pos % uint64(len(r.data)))
+	n := copy(b, r.data[offset:])
+	copy(b[n:], r.data)
+}
@@ -0,0 +1,164 @@
+package shm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+)
+
+// mapTestSegment creates a segment with the smallest rings, and maps it a second time as the peer does.
+func mapTestSegment(t *testing.T) (*Segment, *Segment) {
+	t.Helper()
+	creator, err := CreateTemp("shm-test-", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer, err := Open(creator.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := creator.Unlink(); err != nil {
+		t.Fatal(err)
+	}
+	return creator, peer
+}
+
+// openTestSegment maps a segment on both sides until the end of the test.
+func openTestSegment(t *testing.T) (*Segment, *Segment) {
+	t.Helper()
+	creator, peer := mapTestSegment(t)
+	t.Cleanup(func() {
+		creator.Close()
+		peer.Close()
+	})
+	return creator, peer
+}
+
+func TestOpenSegment(t *testing.T) {
+	creator, peer := openTestSegment(t)
+	if creator.ringSize != uint64(os.Getpagesize()) || peer.ringSize != creator.ringSize {
+		t.Errorf("rings are %d bytes in the creator and %d bytes in the peer", creator.ringSize, peer.ringSize)
+	}
+	// Each side writes to the ring the other reads from
+	creatorTx, creatorRx := creator.rings()
+	peerTx, peerRx := peer.rings()
+	if creatorTx.header != peerRx.header || creatorRx.header != peerTx.header || creatorTx.header == creatorRx.header {
+		t.Error("rings are not crossed between the creator and the peer")
+	}
+
+	file, err := os.CreateTemp(t.TempDir(), "not-a-segment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write(make([]byte, headerSize+2*os.Getpagesize()))
+	file.Close()
+	if _, err := Open(file.Name()); err != ErrInvalidSegment {
+		t.Errorf("opening a file that is not a segment returned %v", err)
+	}
+}
+
+func TestRingWraparound(t *testing.T) {
+	creator, peer := openTestSegment(t)
+	tx, _ := creator.rings()
+	_, rx := peer.rings()
+
+	// Messages of a size that does not divide the ring size are split across its end as the positions wrap around several times
+	for i := 0; i < 100; i++ {
+		message := bytes.Repeat([]byte{byte(i)}, 1000+i)
+		if !tx.tryWrite(message) {
+			t.Fatalf("message %d does not fit in an empty ring", i)
+		}
+		received, ok, err := rx.tryRead()
+		if err != nil || !ok {
+			t.Fatalf("message %d was not read: %v", i, err)
+		}
+		if !bytes.Equal(received, message) {
+			t.Fatalf("message %d was corrupted", i)
+		}
+	}
+	if write := atomic.LoadUint64(tx.writePos()); write < 10*creator.ringSize {
+		t.Errorf("positions only reached %d", write)
+	}
+}
+
+func TestRingFullAndEmpty(t *testing.T) {
+	creator, peer := openTestSegment(t)
+	tx, _ := creator.rings()
+	_, rx := peer.rings()
+
+	if _, ok, err := rx.tryRead(); ok || err != nil {
+		t.Errorf("reading from an empty ring returned %t, %v", ok, err)
+	}
+
+	// The largest message fills the ring exactly
+	largest := bytes.Repeat([]byte{1}, tx.maxMessageSize())
+	if !tx.tryWrite(largest) {
+		t.Fatal("largest message does not fit in an empty ring")
+	}
+	if tx.tryWrite(nil) {
+		t.Error("message written to a full ring")
+	}
+	if received, ok, err := rx.tryRead(); !ok || err != nil || !bytes.Equal(received, largest) {
+		t.Fatalf("reading from a full ring returned %t, %v", ok, err)
+	}
+	if _, ok, err := rx.tryRead(); ok || err != nil {
+		t.Errorf("reading from an emptied ring returned %t, %v", ok, err)
+	}
+
+	// Space is freed as messages are read
+	message := make([]byte, tx.maxMessageSize()/2-lengthSize)
+	for i := 0; i < 2; i++ {
+		if !tx.tryWrite(message) {
+			t.Fatalf("message %d does not fit", i)
+		}
+	}
+	if tx.tryWrite([]byte{1}) {
+		t.Error("message written to a full ring")
+	}
+	if _, ok, err := rx.tryRead(); !ok || err != nil {
+		t.Fatalf("reading from a full ring returned %t, %v", ok, err)
+	}
+	if !tx.tryWrite([]byte{1}) {
+		t.Error("message does not fit after a message was read")
+	}
+}
+
+func TestRingRejectsInvalidLength(t *testing.T) {
+	for description, corrupt := range map[string]func(tx *ring){
+		"length larger than the ring": func(tx *ring) {
+			writeLength(tx, uint32(len(tx.data)))
+			atomic.StoreUint64(tx.writePos(), lengthSize)
+		},
+		"length past the write position": func(tx *ring) {
+			writeLength(tx, 100)
+			atomic.StoreUint64(tx.writePos(), lengthSize+10)
+		},
+		"write position too far ahead": func(tx *ring) {
+			atomic.StoreUint64(tx.writePos(), uint64(len(tx.data))+1)
+		},
+		"write position within a length": func(tx *ring) {
+			atomic.StoreUint64(tx.writePos(), lengthSize-1)
+		},
+		"write position behind the read position": func(tx *ring) {
+			atomic.StoreUint64(tx.readPos(), 10)
+		},
+	} {
+		creator, peer := openTestSegment(t)
+		tx, _ := creator.rings()
+		_, rx := peer.rings()
+		corrupt(tx)
+		if _, _, err := rx.tryRead(); !errors.Is(err, ErrCorruptRing) {
+			t.Errorf("%s: reading returned %v", description, err)
+		}
+	}
+}
+
+// writeLength writes a message length at the start of the ring, as a peer would.
+func writeLength(r *ring, length uint32) {
+	var encoded [lengthSize]byte
+	binary.LittleEndian.PutUint32(encoded[:], length)
+	r.copyIn(0, encoded[:])
+}
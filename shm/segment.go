@@ -0,0 +1,140 @@
+// Package shm implements connections over a pair of ring buffers in a shared memory segment, which carry messages between management and the forwarder without copying them through the kernel. The unix socket the segment was negotiated on is kept open to wake up a peer waiting on a ring, and to detect when the peer goes away.
+package shm
+
+import (
+	"errors"
+	"os"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// segmentMagic identifies a shared memory segment and its layout version.
+const segmentMagic = 0x4e444e53484d3031 // "NDNSHM01"
+
+// headerSize is the size of the segment header, which contains the segment magic and ring size followed by the headers of both rings. It keeps the rings page aligned.
+const headerSize = 4096
+
+// Offsets in the segment header.
+const (
+	offsetMagic    = 0
+	offsetRingSize = 8
+	// offsetRings is the offset of the header of the ring written by the creator of the segment, which is followed by the header of the ring written by the other side
+	offsetRings    = 64
+	ringHeaderSize = 64
+)
+
+// Offsets in a ring header.
+const (
+	offsetWritePos      = 0
+	offsetReadPos       = 8
+	offsetReaderWaiting = 16
+	offsetWriterWaiting = 24
+)
+
+// ErrInvalidSegment is returned when opening a file that is not a shared memory segment.
+var ErrInvalidSegment = errors.New("not a shared memory segment")
+
+// Segment is a mapped shared memory segment containing a ring in each direction.
+type Segment struct {
+	path     string
+	mem      []byte
+	ringSize uint64
+	creator  bool
+}
+
+// CreateTemp creates a segment file with a name generated from pattern, as by os.CreateTemp, in /dev/shm if it exists and in the temporary directory otherwise, and maps it with rings of at least ringSize bytes. The file should be removed with Unlink once the peer has mapped it.
+func CreateTemp(pattern string, ringSize int) (*Segment, error) {
+	dir := os.TempDir()
+	if info, err := os.Stat("/dev/shm"); err == nil && info.IsDir() {
+		dir = "/dev/shm"
+	}
+	file, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	return create(file, ringSize)
+}
+
+func create(file *os.File, ringSize int) (*Segment, error) {
+	defer file.Close()
+	pageSize := os.Getpagesize()
+	if ringSize < pageSize {
+		ringSize = pageSize
+	}
+	ringSize = (ringSize + pageSize - 1) / pageSize * pageSize
+
+	if err := file.Truncate(int64(headerSize + 2*ringSize)); err != nil {
+		os.Remove(file.Name())
+		return nil, err
+	}
+	mem, err := unix.Mmap(int(file.Fd()), 0, headerSize+2*ringSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		os.Remove(file.Name())
+		return nil, err
+	}
+
+	s := &Segment{path: file.Name(), mem: mem, ringSize: uint64(ringSize), creator: true}
+	atomic.StoreUint64(s.word(offsetRingSize), uint64(ringSize))
+	atomic.StoreUint64(s.word(offsetMagic), segmentMagic)
+	return s, nil
+}
+
+// Open maps a segment created by the peer.
+func Open(path string) (*Segment, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < headerSize {
+		return nil, ErrInvalidSegment
+	}
+	mem, err := unix.Mmap(int(file.Fd()), 0, int(info.Size()), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Segment{path: path, mem: mem}
+	s.ringSize = atomic.LoadUint64(s.word(offsetRingSize))
+	if atomic.LoadUint64(s.word(offsetMagic)) != segmentMagic || s.ringSize == 0 || uint64(len(mem)) != headerSize+2*s.ringSize {
+		unix.Munmap(mem)
+		return nil, ErrInvalidSegment
+	}
+	return s, nil
+}
+
+// Path returns the path of the segment file.
+func (s *Segment) Path() string {
+	return s.path
+}
+
+// Unlink removes the segment file. The mapping remains valid on both sides.
+func (s *Segment) Unlink() error {
+	return os.Remove(s.path)
+}
+
+// Close unmaps a segment that is not used by a Conn.
+func (s *Segment) Close() error {
+	return unix.Munmap(s.mem)
+}
+
+// word returns the 64-bit word at an offset in the segment header, which is only accessed atomically.
+func (s *Segment) word(offset int) *uint64 {
+	return (*uint64)(unsafe.Pointer(&s.mem[offset]))
+}
+
+// rings returns the ring this side writes to and the ring it reads from.
+func (s *Segment) rings() (tx *ring, rx *ring) {
+	first := &ring{segment: s, header: offsetRings, data: s.mem[headerSize : headerSize+s.ringSize]}
+	second := &ring{segment: s, header: offsetRings + ringHeaderSize, data: s.mem[headerSize+s.ringSize:]}
+	if s.creator {
+		return first, second
+	}
+	return second, first
+}
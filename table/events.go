@@ -0,0 +1,51 @@
+package table
+
+import (
+	"context"
+	"time"
+
+	"github.com/amazingtapioca17/mgmt/mgmtconn"
+	"github.com/named-data/YaNFD/core"
+)
+
+// HandleEvents updates the RIB in response to forwarder events until the channel is closed. Routes via destroyed faces are removed. When a face comes back up, the nexthops via it are pushed again, since the forwarder may have dropped them while the face was down.
+func (r *RibTable) HandleEvents(events <-chan mgmtconn.Event, timeout time.Duration) {
+	for event := range events {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		var err error
+		switch event.Type {
+		case mgmtconn.EventFaceDestroyed:
+			err = r.CleanUpFace(ctx, event.Face.FaceID)
+		case mgmtconn.EventFaceUp:
+			err = r.replaceNexthopsViaFace(ctx, event.Face.FaceID)
+		}
+		cancel()
+		if err != nil {
+			core.LogWarn(r, "Unable to update FIB after ", event.Type, " of face ", event.Face.FaceID, ": ", err)
+		}
+	}
+}
+
+// replaceNexthopsViaFace replaces the nexthops in the FIB of the entries that have a nexthop via the specified face.
+func (r *RibTable) replaceNexthopsViaFace(ctx context.Context, faceID uint64) error {
+	r.pushMutex.Lock()
+	defer r.pushMutex.Unlock()
+	r.mutex.Lock()
+	push := prepareReplaceNexthops(r.entriesViaFace(faceID))
+	r.mutex.Unlock()
+	return r.push(ctx, push)
+}
+
+// entriesViaFace returns the entries that have a nexthop via the specified face, including nexthops inherited from ancestors. The mutex must be held.
+func (r *RibTable) entriesViaFace(faceID uint64) []*RibEntry {
+	entries := make([]*RibEntry, 0)
+	for _, entry := range r.entries() {
+		for _, nexthop := range entry.nexthops() {
+			if nexthop.FaceID == faceID {
+				entries = append(entries, entry)
+				break
+			}
+		}
+	}
+	return entries
+}
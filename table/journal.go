@@ -0,0 +1,348 @@
+package table
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/amazingtapioca17/mgmt/mgmtconn"
+	"github.com/named-data/YaNFD/core"
+	"github.com/named-data/YaNFD/ndn"
+)
+
+// Bounds of the delay between attempts to look up the faces of restored routes while the forwarder cannot be reached.
+const (
+	minLookupRetryDelay = 100 * time.Millisecond
+	maxLookupRetryDelay = 10 * time.Second
+)
+
+// Journal record operations.
+const (
+	journalAdd        = "add"
+	journalRemove     = "remove"
+	journalRemoveFace = "removeface"
+)
+
+// Journal is an append-only file recording the changes to the RIB, from which the routes are restored when management restarts. Each line of the file is a journalRecord in JSON. Compaction rewrites the file with a record for each current route.
+type Journal struct {
+	path               string
+	file               *os.File
+	compactionInterval time.Duration
+	stop               chan struct{}
+	done               chan struct{}
+}
+
+// journalRecord is a change to the RIB. Routes are identified by Name, FaceID, and Origin, except for removeface records, which remove all routes via FaceID.
+type journalRecord struct {
+	Op     string `json:"op"`
+	Name   string `json:"name,omitempty"`
+	FaceID uint64 `json:"faceid"`
+	Origin uint64 `json:"origin,omitempty"`
+	Cost   uint64 `json:"cost,omitempty"`
+	Flags  uint64 `json:"flags,omitempty"`
+	// Expires is when the route expires in milliseconds since the Unix epoch, or 0 if it does not expire
+	Expires int64 `json:"expires,omitempty"`
+}
+
+// OpenJournal opens the journal at the path, creating it if it does not exist. The journal is compacted every compactionInterval once it is used by a RIB.
+func OpenJournal(path string, compactionInterval time.Duration) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{
+		path:               path,
+		file:               file,
+		compactionInterval: compactionInterval,
+		stop:               make(chan struct{}),
+		done:               make(chan struct{}),
+	}, nil
+}
+
+func (j *Journal) String() string {
+	return "RIBJournal"
+}
+
+// routeKey identifies a route in the journal.
+type routeKey struct {
+	name   string
+	faceID uint64
+	origin uint64
+}
+
+// read replays the records in the journal, returning the routes they leave. Lines that cannot be decoded, e.g., a record cut short by a crash, are skipped.
+func (j *Journal) read() ([]journalRecord, error) {
+	if _, err := j.file.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	routes := make(map[routeKey]journalRecord)
+	scanner := bufio.NewScanner(j.file)
+	scanner.Buffer(make([]byte, 0, 4096), 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var record journalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			core.LogWarn(j, "Skipping invalid record on line ", line, " of ", j.path, ": ", err)
+			continue
+		}
+		key := routeKey{name: record.Name, faceID: record.FaceID, origin: record.Origin}
+		switch record.Op {
+		case journalAdd:
+			routes[key] = record
+		case journalRemove:
+			delete(routes, key)
+		case journalRemoveFace:
+			for key := range routes {
+				if key.faceID == record.FaceID {
+					delete(routes, key)
+				}
+			}
+		default:
+			core.LogWarn(j, "Skipping record with unknown operation ", record.Op, " on line ", line, " of ", j.path)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	records := make([]journalRecord, 0, len(routes))
+	for _, record := range routes {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Name != records[j].Name {
+			return records[i].Name < records[j].Name
+		}
+		if records[i].FaceID != records[j].FaceID {
+			return records[i].FaceID < records[j].FaceID
+		}
+		return records[i].Origin < records[j].Origin
+	})
+	return records, nil
+}
+
+// append writes a record at the end of the journal. Errors are logged, since the change has already been made to the RIB.
+func (j *Journal) append(record journalRecord) {
+	if j == nil {
+		return
+	}
+	wire, err := json.Marshal(record)
+	if err != nil {
+		core.LogError(j, "Unable to encode record: ", err)
+		return
+	}
+	if _, err := j.file.Write(append(wire, '\n')); err != nil {
+		core.LogError(j, "Unable to write to ", j.path, ": ", err)
+	}
+}
+
+// rewrite replaces the journal with the records, writing them to a temporary file that is renamed over the journal once it has been synced.
+func (j *Journal) rewrite(records []journalRecord) error {
+	file, err := os.CreateTemp(filepath.Dir(j.path), filepath.Base(j.path)+".*")
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, record := range records {
+		if err = encoder.Encode(record); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), j.path)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	j.file.Close()
+	j.file = file
+	return nil
+}
+
+// close syncs and closes the journal file.
+func (j *Journal) close() error {
+	if err := j.file.Sync(); err != nil {
+		j.file.Close()
+		return err
+	}
+	return j.file.Close()
+}
+
+// addRecord returns the journal record that adds the route to the entry.
+func addRecord(entry *RibEntry, route *Route) journalRecord {
+	record := journalRecord{
+		Op:     journalAdd,
+		Name:   entry.Name.String(),
+		FaceID: route.FaceID,
+		Origin: route.Origin,
+		Cost:   route.Cost,
+		Flags:  route.Flags,
+	}
+	if route.ExpirationPeriod != nil {
+		record.Expires = route.expiresAt.UnixMilli()
+	}
+	return record
+}
+
+// Restore replays the journal into the RIB, skipping expired routes, after which changes to the RIB are recorded in the journal. The journal is compacted right away and then periodically until CloseJournal is called. Only an error reading the journal is returned, in which case it is closed without changing the RIB or the file. Since the forwarder may not be reachable yet, the faces of the restored routes are then checked in the background, waiting for the forwarder if needed. Routes via faces that no longer exist are removed, and the remaining routes are pushed to the FIB.
+func (r *RibTable) Restore(journal *Journal) error {
+	records, err := journal.read()
+	if err != nil {
+		journal.file.Close()
+		return err
+	}
+
+	r.pushMutex.Lock()
+	defer r.pushMutex.Unlock()
+	r.mutex.Lock()
+	now := time.Now().UnixMilli()
+	restored := 0
+	faceIDs := make([]uint64, 0)
+	seenFaces := make(map[uint64]bool)
+	for _, record := range records {
+		if record.Expires != 0 && record.Expires <= now {
+			continue
+		}
+		name, err := ndn.NameFromString(record.Name)
+		if err != nil {
+			core.LogWarn(r, "Skipping route with invalid name ", record.Name, " in journal: ", err)
+			continue
+		}
+		var expirationPeriod *time.Duration
+		if record.Expires != 0 {
+			remaining := time.Until(time.UnixMilli(record.Expires))
+			expirationPeriod = &remaining
+		}
+		r.addRoute(name, record.FaceID, record.Origin, record.Cost, record.Flags, expirationPeriod)
+		restored++
+		if !seenFaces[record.FaceID] {
+			seenFaces[record.FaceID] = true
+			faceIDs = append(faceIDs, record.FaceID)
+		}
+	}
+	r.journal = journal
+	if err := r.compactJournal(journal); err != nil {
+		core.LogError(r, "Unable to compact journal ", journal.path, ": ", err)
+	}
+	r.mutex.Unlock()
+	core.LogInfo(r, "Restored ", restored, " routes from journal ", journal.path)
+
+	go r.compactPeriodically(journal)
+	go r.verifyRestoredFaces(faceIDs)
+	return nil
+}
+
+// verifyRestoredFaces removes the routes via the faces that no longer exist in the forwarder, and then pushes the nexthops of the RIB to the FIB. Each lookup has its own timeout, and lookups are retried with backoff while the forwarder cannot be reached. Faces are assumed to exist if the forwarder does not support looking them up or rejects the lookup.
+func (r *RibTable) verifyRestoredFaces(faceIDs []uint64) {
+	for _, faceID := range faceIDs {
+		missing, ok := r.faceMissing(faceID)
+		if !ok {
+			return
+		}
+		if !missing {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), mgmtconn.AcksConn.Timeout)
+		err := r.CleanUpFace(ctx, faceID)
+		cancel()
+		core.LogInfo(r, "Removed restored routes via face ", faceID, ", which no longer exists")
+		if err != nil {
+			core.LogWarn(r, "Unable to update FIB after removing restored routes via face ", faceID, ": ", err)
+		}
+	}
+	if err := r.Resync(context.Background()); err != nil {
+		core.LogWarn(r, "Unable to push restored routes to the FIB: ", err)
+	}
+}
+
+// faceMissing asks the forwarder whether a face no longer exists, retrying with backoff until the forwarder can be reached. It returns false if the connection to the forwarder is closed in the meantime.
+func (r *RibTable) faceMissing(faceID uint64) (missing bool, ok bool) {
+	delay := minLookupRetryDelay
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), mgmtconn.AcksConn.Timeout)
+		// The forwarder reports Valid if the face does not exist
+		missing, err := mgmtconn.AcksConn.GetFaceId(ctx, faceID)
+		cancel()
+		var unsupported *mgmtconn.UnsupportedError
+		switch {
+		case err == nil:
+			return missing, true
+		case errors.Is(err, mgmtconn.ErrClosed):
+			return false, false
+		case errors.As(err, &unsupported):
+			return false, true
+		case !mgmtconn.IsUnavailable(err):
+			core.LogWarn(r, "Forwarder rejected lookup of face ", faceID, ", keeping its restored routes: ", err)
+			return false, true
+		}
+		time.Sleep(delay)
+		delay *= 2
+		if delay > maxLookupRetryDelay {
+			delay = maxLookupRetryDelay
+		}
+	}
+}
+
+// compactJournal rewrites the journal with the current routes. The push mutex and the mutex must be held, the latter at least for reading.
+func (r *RibTable) compactJournal(journal *Journal) error {
+	records := make([]journalRecord, 0)
+	for _, entry := range r.entries() {
+		for _, route := range entry.routes {
+			records = append(records, addRecord(entry, route))
+		}
+	}
+	return journal.rewrite(records)
+}
+
+// compactPeriodically compacts the journal every compaction interval until it is closed.
+func (r *RibTable) compactPeriodically(journal *Journal) {
+	defer close(journal.done)
+	ticker := time.NewTicker(journal.compactionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			var err error
+			r.pushMutex.Lock()
+			// The journal may have been closed since the ticker fired
+			if r.journal == journal {
+				r.mutex.RLock()
+				err = r.compactJournal(journal)
+				r.mutex.RUnlock()
+			}
+			r.pushMutex.Unlock()
+			if err != nil {
+				core.LogError(r, "Unable to compact journal ", journal.path, ": ", err)
+			}
+		case <-journal.stop:
+			return
+		}
+	}
+}
+
+// CloseJournal stops recording changes to the RIB in the journal, and flushes and closes it.
+func (r *RibTable) CloseJournal() error {
+	r.pushMutex.Lock()
+	journal := r.journal
+	r.journal = nil
+	r.pushMutex.Unlock()
+	if journal == nil {
+		return nil
+	}
+	close(journal.stop)
+	<-journal.done
+	return journal.close()
+}
@@ -0,0 +1,269 @@
+package table
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/named-data/YaNFD/ndn"
+)
+
+// openTestJournal opens a journal in a temporary directory, after writing the lines to it if there are any.
+func openTestJournal(t *testing.T, compactionInterval time.Duration, lines ...string) *Journal {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rib.journal")
+	if len(lines) > 0 {
+		if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	journal, err := OpenJournal(path, compactionInterval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return journal
+}
+
+// restoreTestRib restores a new RIB from the journal, which is closed at the end of the test.
+func restoreTestRib(t *testing.T, journal *Journal) *RibTable {
+	t.Helper()
+	rib := makeRibTable()
+	if err := rib.Restore(journal); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := rib.CloseJournal(); err != nil {
+			t.Error(err)
+		}
+	})
+	return rib
+}
+
+// readJournalFile returns the records in the journal file, in order.
+func readJournalFile(t *testing.T, path string) []journalRecord {
+	t.Helper()
+	wire, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := make([]journalRecord, 0)
+	for _, line := range strings.Split(strings.TrimSuffix(string(wire), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		var record journalRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid record %q in journal: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// ribRoutes returns the name, face, and cost of every route in the RIB, sorted.
+func ribRoutes(rib *RibTable) []string {
+	routes := make([]string, 0)
+	for _, entry := range rib.GetAllEntries() {
+		for _, route := range entry.GetRoutes() {
+			routes = append(routes, fmt.Sprint(entry.Name, " ", route.FaceID, " ", route.Cost))
+		}
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+func waitFor(condition func() bool) bool {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+func TestJournalWrites(t *testing.T) {
+	journal := openTestJournal(t, time.Hour)
+	rib := restoreTestRib(t, journal)
+	ctx := context.Background()
+	name := makeName(t, "/journal/writes")
+	expirationPeriod := time.Hour
+
+	if err := rib.AddRoute(ctx, name, 340, RouteOriginApp, 10, RouteFlagChildInherit, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := rib.AddRoute(ctx, name, 341, RouteOriginStatic, 20, 0, &expirationPeriod); err != nil {
+		t.Fatal(err)
+	}
+	if err := rib.AddRoute(ctx, name, 340, RouteOriginApp, 5, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := rib.RemoveRoute(ctx, name, 340, RouteOriginApp); err != nil {
+		t.Fatal(err)
+	}
+	if err := rib.CleanUpFace(ctx, 341); err != nil {
+		t.Fatal(err)
+	}
+
+	records := readJournalFile(t, journal.path)
+	if len(records) != 5 {
+		t.Fatalf("journal has %d records: %+v", len(records), records)
+	}
+	expires := records[1].Expires
+	if remaining := time.Until(time.UnixMilli(expires)); remaining <= 0 || remaining > expirationPeriod {
+		t.Errorf("route expires %v from now", remaining)
+	}
+	expected := []journalRecord{
+		{Op: journalAdd, Name: "/journal/writes", FaceID: 340, Origin: RouteOriginApp, Cost: 10, Flags: RouteFlagChildInherit},
+		{Op: journalAdd, Name: "/journal/writes", FaceID: 341, Origin: RouteOriginStatic, Cost: 20, Expires: expires},
+		// Updating a route records it again
+		{Op: journalAdd, Name: "/journal/writes", FaceID: 340, Origin: RouteOriginApp, Cost: 5},
+		{Op: journalRemove, Name: "/journal/writes", FaceID: 340, Origin: RouteOriginApp},
+		{Op: journalRemoveFace, FaceID: 341},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("journal records are %+v", records)
+	}
+
+	// Changes are no longer recorded once the journal is closed
+	if err := rib.CloseJournal(); err != nil {
+		t.Fatal(err)
+	}
+	if err := rib.AddRoute(ctx, name, 342, RouteOriginApp, 10, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if records := readJournalFile(t, journal.path); len(records) != 5 {
+		t.Errorf("journal has %d records after it was closed", len(records))
+	}
+}
+
+func TestJournalReplay(t *testing.T) {
+	expired := time.Now().Add(-time.Minute).UnixMilli()
+	journal := openTestJournal(t, time.Hour,
+		`{"op":"add","name":"/journal/replay/a","faceid":350,"cost":10}`,
+		`{"op":"add","name":"/journal/replay/a","faceid":351,"cost":20}`,
+		`{"op":"add","name":"/journal/replay/b","faceid":350,"cost":30}`,
+		`{"op":"add","name":"/journal/replay/c","faceid":352,"cost":40}`,
+		`{"op":"add","name":"/journal/replay/expired","faceid":352,"cost":10,"expires":`+fmt.Sprint(expired)+`}`,
+		`not a record`,
+		`{"op":"unknown","name":"/journal/replay/c","faceid":352}`,
+		`{"op":"remove","name":"/journal/replay/a","faceid":351}`,
+		`{"op":"removeface","faceid":350}`,
+		`{"op":"add","name":"/journal/replay/b","faceid":353,"cost":50}`,
+		// A record cut short by a crash
+		`{"op":"add","name":"/journal/replay/d","fa`,
+	)
+	rib := restoreTestRib(t, journal)
+
+	expected := []string{"/journal/replay/b 353 50", "/journal/replay/c 352 40"}
+	if routes := ribRoutes(rib); !reflect.DeepEqual(routes, expected) {
+		t.Errorf("restored routes are %v", routes)
+	}
+}
+
+func TestJournalReplayError(t *testing.T) {
+	// A line too long to be read makes the journal unreadable, rather than being skipped
+	journal := openTestJournal(t, time.Hour,
+		`{"op":"add","name":"/journal/error","faceid":360,"cost":10}`,
+		`{"op":"add","name":"/`+strings.Repeat("a", 2<<20)+`","faceid":360}`,
+	)
+	before, err := os.ReadFile(journal.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rib := makeRibTable()
+	if err := rib.Restore(journal); err == nil {
+		t.Fatal("unreadable journal was restored")
+	}
+	if entries := rib.GetAllEntries(); len(entries) != 0 {
+		t.Errorf("RIB has %d entries after failing to restore", len(entries))
+	}
+	if after, err := os.ReadFile(journal.path); err != nil || string(after) != string(before) {
+		t.Errorf("journal changed after failing to restore: %v", err)
+	}
+}
+
+func TestJournalCompaction(t *testing.T) {
+	journal := openTestJournal(t, 50*time.Millisecond,
+		`{"op":"add","name":"/journal/compaction","faceid":370,"cost":10}`,
+		`{"op":"add","name":"/journal/compaction","faceid":371,"cost":10}`,
+		`{"op":"removeface","faceid":371}`,
+		`invalid`,
+	)
+	rib := restoreTestRib(t, journal)
+	ctx := context.Background()
+	name := makeName(t, "/journal/compaction")
+
+	// The journal is compacted when restored
+	expected := []journalRecord{{Op: journalAdd, Name: "/journal/compaction", FaceID: 370, Cost: 10}}
+	if records := readJournalFile(t, journal.path); !reflect.DeepEqual(records, expected) {
+		t.Errorf("journal records after restoring are %+v", records)
+	}
+
+	// And then periodically, after which changes are still recorded
+	if err := rib.AddRoute(ctx, name, 372, RouteOriginApp, 10, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := rib.RemoveRoute(ctx, name, 370, RouteOriginApp); err != nil {
+		t.Fatal(err)
+	}
+	expected = []journalRecord{{Op: journalAdd, Name: "/journal/compaction", FaceID: 372, Cost: 10}}
+	if !waitFor(func() bool { return reflect.DeepEqual(readJournalFile(t, journal.path), expected) }) {
+		t.Errorf("journal records are %+v after the compaction interval", readJournalFile(t, journal.path))
+	}
+	if err := rib.AddRoute(ctx, name, 373, RouteOriginApp, 20, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if records := readJournalFile(t, journal.path); len(records) < 2 || records[len(records)-1].FaceID != 373 {
+		t.Errorf("journal records after compaction are %+v", records)
+	}
+
+	// No temporary files are left behind
+	files, err := os.ReadDir(filepath.Dir(journal.path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("journal directory has %d files", len(files))
+	}
+}
+
+func TestRestoreVerifiesFaces(t *testing.T) {
+	existing := forwarder.AddFace(ndn.MakeUDPFaceURI(4, "192.0.2.80", 6363))
+	defer forwarder.RemoveFace(existing)
+	missing := forwarder.AddFace(ndn.MakeUDPFaceURI(4, "192.0.2.81", 6363))
+	forwarder.RemoveFace(missing)
+	a := makeName(t, "/journal/verify/a")
+	b := makeName(t, "/journal/verify/b")
+
+	journal := openTestJournal(t, time.Hour,
+		`{"op":"add","name":"/journal/verify/a","faceid":`+fmt.Sprint(existing)+`,"cost":10}`,
+		`{"op":"add","name":"/journal/verify/a","faceid":`+fmt.Sprint(missing)+`,"cost":20}`,
+		`{"op":"add","name":"/journal/verify/b","faceid":`+fmt.Sprint(missing)+`,"cost":30}`,
+	)
+	rib := restoreTestRib(t, journal)
+
+	// Routes via the face that no longer exists are removed, and the others are pushed to the FIB
+	expected := map[uint64]uint64{existing: 10}
+	if !waitFor(func() bool { return reflect.DeepEqual(forwarder.NextHops(a), expected) }) {
+		t.Errorf("nexthops of %s after restoring are %v", a, forwarder.NextHops(a))
+	}
+	if !waitFor(func() bool { return len(rib.GetAllEntries()) == 1 }) {
+		t.Errorf("restored routes are %v", ribRoutes(rib))
+	}
+	if nexthops := forwarder.NextHops(b); len(nexthops) != 0 {
+		t.Errorf("nexthops of %s after restoring are %v", b, nexthops)
+	}
+	checkFib(t, rib, []*ndn.Name{a, b})
+	if records := readJournalFile(t, journal.path); records[len(records)-1].Op != journalRemoveFace || records[len(records)-1].FaceID != missing {
+		t.Errorf("removal of the missing face is not recorded: %+v", records)
+	}
+}
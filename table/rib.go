@@ -9,15 +9,26 @@ package table
 
 import (
 	"container/list"
+	"context"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/amazingtapioca17/mgmt/mgmtconn"
+	"github.com/named-data/YaNFD/core"
 	"github.com/named-data/YaNFD/ndn"
 )
 
-// RibTable represents the Routing Information Base (RIB).
+// RibTable represents the Routing Information Base (RIB). It is safe for concurrent use. Changes are made one at a time and pushed to the forwarder in order, while datasets are generated from a copy of the entries, which only locks the RIB while it is made.
 type RibTable struct {
 	RibEntry
+
+	// mutex protects the tree, the routes, and the nexthops last pushed to the FIB
+	mutex sync.RWMutex
+	// pushMutex is held while changing the RIB and pushing the change to the forwarder, so that changes reach the FIB in the order they were made
+	pushMutex sync.Mutex
+	// journal records the changes to the RIB, if any. It is protected by pushMutex.
+	journal *Journal
 }
 
 // RibEntry represents an entry in the RIB table.
@@ -30,6 +41,9 @@ type RibEntry struct {
 	children map[*RibEntry]bool
 
 	routes []*Route
+
+	// fib is the set of nexthops last pushed to the FIB for the entry, FaceID -> Cost, or nil if it is unknown
+	fib map[uint64]uint64
 }
 
 // Route represents a route in a RIB entry.
@@ -39,6 +53,11 @@ type Route struct {
 	Cost             uint64
 	Flags            uint64
 	ExpirationPeriod *time.Duration
+
+	// expiresAt is when the route expires, if it has an ExpirationPeriod
+	expiresAt time.Time
+	// expiry removes the route once it expires
+	expiry *time.Timer
 }
 
 // Route flags.
@@ -65,6 +84,10 @@ var Rib = RibTable{
 	},
 }
 
+func (r *RibTable) String() string {
+	return "RIB"
+}
+
 func (r *RibEntry) findExactMatchEntry(name *ndn.Name) *RibEntry {
 	if name.Size() > r.depth {
 		for child := range r.children {
@@ -111,54 +134,294 @@ func (r *RibEntry) pruneIfEmpty() {
 	}
 }
 
-func (r *RibEntry) updateNexthops() {
-	//FibStrategyTable.ClearNextHops(r.Name)
-	mgmtconn.AcksConn.ClearNextHops(r.Name)
-	// Find minimum cost route per nexthop
+// nexthops returns the "flattened" set of nexthops, i.e., the minimum cost route per face, ordered by FaceID. As in NFD, the routes of the entry are followed by the child-inherit routes of its ancestors, up to and including the nearest ancestor with a capture route, unless the entry has a capture route itself. A route on a closer entry takes precedence over inherited routes via the same face. An entry without routes of its own has no nexthops, so that names are only in the FIB while they have routes.
+func (r *RibEntry) nexthops() []mgmtconn.NextHop {
+	minCostRoutes := r.minCostRoutes(0)
+	if len(r.routes) > 0 && !r.captures() {
+		for ancestor := r.parent; ancestor != nil; ancestor = ancestor.parent {
+			for faceID, cost := range ancestor.minCostRoutes(RouteFlagChildInherit) {
+				if _, ok := minCostRoutes[faceID]; !ok {
+					minCostRoutes[faceID] = cost
+				}
+			}
+			if ancestor.captures() {
+				break
+			}
+		}
+	}
+
+	nexthops := make([]mgmtconn.NextHop, 0, len(minCostRoutes))
+	for faceID, cost := range minCostRoutes {
+		nexthops = append(nexthops, mgmtconn.NextHop{FaceID: faceID, Cost: cost})
+	}
+	sort.Slice(nexthops, func(i, j int) bool {
+		return nexthops[i].FaceID < nexthops[j].FaceID
+	})
+	return nexthops
+}
+
+// minCostRoutes returns the minimum cost per face of the routes of the entry that have all of the specified flags.
+func (r *RibEntry) minCostRoutes(flags uint64) map[uint64]uint64 {
 	minCostRoutes := make(map[uint64]uint64) // FaceID -> Cost
 	for _, route := range r.routes {
+		if route.Flags&flags != flags {
+			continue
+		}
 		cost, ok := minCostRoutes[route.FaceID]
 		if !ok || route.Cost < cost {
 			minCostRoutes[route.FaceID] = route.Cost
 		}
 	}
+	return minCostRoutes
+}
+
+// captures returns whether the entry has a capture route, which stops its descendants from inheriting the routes of its ancestors.
+func (r *RibEntry) captures() bool {
+	for _, route := range r.routes {
+		if route.Flags&RouteFlagCapture != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// affectedEntries appends the entry and the descendants whose nexthops depend on its routes, i.e., the descendants with routes that are not below a capture route.
+func (r *RibEntry) affectedEntries(entries []*RibEntry) []*RibEntry {
+	entries = append(entries, r)
+	return r.appendInheritingDescendants(entries)
+}
+
+func (r *RibEntry) appendInheritingDescendants(entries []*RibEntry) []*RibEntry {
+	for child := range r.children {
+		if child.captures() {
+			continue
+		}
+		if len(child.routes) > 0 {
+			entries = append(entries, child)
+		}
+		entries = child.appendInheritingDescendants(entries)
+	}
+	return entries
+}
+
+// withInheritingDescendants returns the entries along with the descendants whose nexthops depend on their routes, without duplicates.
+func withInheritingDescendants(entries []*RibEntry) []*RibEntry {
+	seen := make(map[*RibEntry]bool)
+	affected := make([]*RibEntry, 0, len(entries))
+	for _, entry := range entries {
+		for _, affectedEntry := range entry.affectedEntries(nil) {
+			if !seen[affectedEntry] {
+				seen[affectedEntry] = true
+				affected = append(affected, affectedEntry)
+			}
+		}
+	}
+	return affected
+}
+
+// nexthopPush is a set of updates to the nexthops in the FIB, which is prepared while the RIB is locked and pushed to the forwarder once it is unlocked.
+type nexthopPush struct {
+	entries []*RibEntry
+	updates []mgmtconn.NextHopUpdate
+}
+
+// prepareNexthops prepares the updates that bring the nexthops of several entries in the FIB up to date, and records them as pushed. Only the nexthops that were added, removed, or changed cost since the last push of an entry are sent, unless the nexthops of the entry in the FIB are unknown, in which case they are replaced as a whole. The mutex must be held.
+func prepareNexthops(entries []*RibEntry) nexthopPush {
+	push := nexthopPush{entries: entries, updates: make([]mgmtconn.NextHopUpdate, 0, len(entries))}
+	for _, entry := range entries {
+		if update, ok := entry.nexthopUpdate(); ok {
+			push.updates = append(push.updates, update)
+		}
+	}
+	return push
+}
+
+// prepareReplaceNexthops prepares the updates that replace the nexthops of several entries in the FIB as a whole, e.g., when the forwarder may have lost them. The mutex must be held.
+func prepareReplaceNexthops(entries []*RibEntry) nexthopPush {
+	for _, entry := range entries {
+		entry.fib = nil
+	}
+	return prepareNexthops(entries)
+}
+
+// push sends the updates to the forwarder, pipelining the commands. If any update fails, the nexthops in the FIB of all the entries become unknown. The push mutex must be held, but not the mutex.
+func (r *RibTable) push(ctx context.Context, push nexthopPush) error {
+	if len(push.updates) == 0 {
+		return nil
+	}
+	err := mgmtconn.AcksConn.UpdateNextHopsPipelined(ctx, push.updates)
+	if err != nil {
+		r.mutex.Lock()
+		for _, entry := range push.entries {
+			entry.fib = nil
+		}
+		r.mutex.Unlock()
+	}
+	return err
+}
+
+// nexthopUpdate returns the update that brings the nexthops of the entry in the FIB up to date and records them as pushed, or false if they already are up to date. Entries that have never had routes, e.g., those only in the tree as ancestors of other entries, have no name and are never in the FIB.
+func (r *RibEntry) nexthopUpdate() (mgmtconn.NextHopUpdate, bool) {
+	if r.Name == nil && len(r.routes) == 0 && r.fib == nil {
+		return mgmtconn.NextHopUpdate{}, false
+	}
+	nexthops := r.nexthops()
+	pushed := r.fib
+	r.fib = make(map[uint64]uint64, len(nexthops))
+	for _, nexthop := range nexthops {
+		r.fib[nexthop.FaceID] = nexthop.Cost
+	}
+	if pushed == nil {
+		return mgmtconn.NextHopUpdate{Name: r.Name, NextHops: nexthops}, true
+	}
 
-	//Add "flattened" set of nexthops
-	for nexthop, cost := range minCostRoutes {
-		//fmt.Println(r.Name, nexthop, cost)
-		mgmtconn.AcksConn.InsertNextHop(r.Name, nexthop, cost)
+	update := mgmtconn.NextHopUpdate{Name: r.Name, Incremental: true}
+	for _, nexthop := range nexthops {
+		if cost, ok := pushed[nexthop.FaceID]; !ok || cost != nexthop.Cost {
+			update.NextHops = append(update.NextHops, nexthop)
+		}
+	}
+	for faceID := range pushed {
+		if _, ok := r.fib[faceID]; !ok {
+			update.Removed = append(update.Removed, faceID)
+		}
 	}
+	sort.Slice(update.Removed, func(i, j int) bool {
+		return update.Removed[i] < update.Removed[j]
+	})
+	return update, len(update.NextHops) > 0 || len(update.Removed) > 0
 }
 
-// AddRoute adds or updates a RIB entry for the specified prefix.
-func (r *RibTable) AddRoute(name *ndn.Name, faceID uint64, origin uint64, cost uint64, flags uint64, expirationPeriod *time.Duration) {
+// AddRoute adds or updates a RIB entry for the specified prefix. The route is kept even if the updated nexthops cannot be pushed to the forwarder, in which case the error is returned.
+func (r *RibTable) AddRoute(ctx context.Context, name *ndn.Name, faceID uint64, origin uint64, cost uint64, flags uint64, expirationPeriod *time.Duration) error {
+	r.pushMutex.Lock()
+	defer r.pushMutex.Unlock()
+	r.mutex.Lock()
+	node := r.addRoute(name, faceID, origin, cost, flags, expirationPeriod)
+	push := prepareNexthops(node.affectedEntries(nil))
+	r.mutex.Unlock()
+	return r.push(ctx, push)
+}
+
+// addRoute adds or updates a route, returning the entry of the prefix. The mutex must be held.
+func (r *RibTable) addRoute(name *ndn.Name, faceID uint64, origin uint64, cost uint64, flags uint64, expirationPeriod *time.Duration) *RibEntry {
 	node := r.fillTreeToPrefix(name)
 	if node.Name == nil {
 		node.Name = name
 	}
 
-	defer node.updateNexthops()
-
 	for _, existingRoute := range node.routes {
 		if existingRoute.FaceID == faceID && existingRoute.Origin == origin {
 			existingRoute.Cost = cost
 			existingRoute.Flags = flags
 			existingRoute.ExpirationPeriod = expirationPeriod
-			return
+			r.scheduleExpiry(node, existingRoute)
+			r.journal.append(addRecord(node, existingRoute))
+			return node
 		}
 	}
 
-	node.routes = append(node.routes, &Route{
+	route := &Route{
 		FaceID:           faceID,
 		Origin:           origin,
 		Cost:             cost,
 		Flags:            flags,
 		ExpirationPeriod: expirationPeriod,
+	}
+	node.routes = append(node.routes, route)
+	r.scheduleExpiry(node, route)
+	r.journal.append(addRecord(node, route))
+	return node
+}
+
+// scheduleExpiry (re)starts the timer that removes the route once its ExpirationPeriod has passed, or stops it if the route no longer expires. The mutex must be held.
+func (r *RibTable) scheduleExpiry(entry *RibEntry, route *Route) {
+	route.stopExpiry()
+	if route.ExpirationPeriod == nil {
+		return
+	}
+	route.expiresAt = time.Now().Add(*route.ExpirationPeriod)
+	route.expiry = time.AfterFunc(*route.ExpirationPeriod, func() {
+		r.expireRoute(entry.Name, route)
 	})
 }
 
-// GetAllEntries returns all routes in the RIB.
+// expireRoute removes an expired route in the same way as RemoveRoute. Nothing is done if the route has been removed or refreshed since its timer fired.
+func (r *RibTable) expireRoute(name *ndn.Name, route *Route) {
+	r.pushMutex.Lock()
+	defer r.pushMutex.Unlock()
+	r.mutex.Lock()
+	entry := r.findExactMatchEntry(name)
+	if entry == nil || !entry.hasRoute(route) || time.Now().Before(route.expiresAt) {
+		r.mutex.Unlock()
+		return
+	}
+	push := prepareNexthops(r.removeRoute(entry, route.FaceID, route.Origin))
+	r.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), mgmtconn.AcksConn.Timeout)
+	defer cancel()
+	if err := r.push(ctx, push); err != nil {
+		core.LogWarn(r, "Unable to update FIB after route to ", name, " via face ", route.FaceID, " expired: ", err)
+		return
+	}
+	core.LogInfo(r, "Route to ", name, " via face ", route.FaceID, " with origin ", route.Origin, " expired")
+}
+
+// hasRoute returns whether the route is one of the routes of the entry.
+func (r *RibEntry) hasRoute(route *Route) bool {
+	for _, existingRoute := range r.routes {
+		if existingRoute == route {
+			return true
+		}
+	}
+	return false
+}
+
+// stopExpiry stops the expiry timer of the route, if any.
+func (r *Route) stopExpiry() {
+	if r.expiry != nil {
+		r.expiry.Stop()
+		r.expiry = nil
+	}
+}
+
+// RemainingLifetime returns how long is left until the route expires, or nil if it does not expire.
+func (r *Route) RemainingLifetime() *time.Duration {
+	if r.ExpirationPeriod == nil {
+		return nil
+	}
+	remaining := time.Until(r.expiresAt)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &remaining
+}
+
+// GetAllEntries returns a copy of the entries in the RIB that have routes, which stays the same while the RIB changes. The RIB is only locked for reading while the entries are copied.
 func (r *RibTable) GetAllEntries() []*RibEntry {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	entries := r.entries()
+	copies := make([]*RibEntry, 0, len(entries))
+	for _, entry := range entries {
+		routes := make([]*Route, 0, len(entry.routes))
+		for _, route := range entry.routes {
+			routeCopy := *route
+			routes = append(routes, &routeCopy)
+		}
+		copies = append(copies, &RibEntry{
+			component: entry.component,
+			Name:      entry.Name,
+			depth:     entry.depth,
+			routes:    routes,
+		})
+	}
+	return copies
+}
+
+// entries returns all entries in the RIB that have routes. The mutex must be held.
+func (r *RibTable) entries() []*RibEntry {
 	entries := make([]*RibEntry, 0)
 	// Walk tree in-order
 	queue := list.New()
@@ -179,49 +442,93 @@ func (r *RibTable) GetAllEntries() []*RibEntry {
 	return entries
 }
 
+// Resync replaces the nexthops of every entry in the forwarder, e.g., after the forwarder has restarted.
+func (r *RibTable) Resync(ctx context.Context) error {
+	r.pushMutex.Lock()
+	defer r.pushMutex.Unlock()
+	r.mutex.Lock()
+	push := prepareReplaceNexthops(r.entries())
+	r.mutex.Unlock()
+	return r.push(ctx, push)
+}
+
 // GetRoutes returns all routes in the RIB entry.
 func (r *RibEntry) GetRoutes() []*Route {
 	return r.routes
 }
 
 // RemoveRoute removes the specified route from the specified prefix.
-func (r *RibTable) RemoveRoute(name *ndn.Name, faceID uint64, origin uint64) {
+func (r *RibTable) RemoveRoute(ctx context.Context, name *ndn.Name, faceID uint64, origin uint64) error {
+	r.pushMutex.Lock()
+	defer r.pushMutex.Unlock()
+	r.mutex.Lock()
 	entry := r.findExactMatchEntry(name)
-	if entry != nil {
-		for i, existingRoute := range entry.routes {
-			if existingRoute.FaceID == faceID && existingRoute.Origin == origin {
-				if i < len(entry.routes)-1 {
-					copy(entry.routes[i:], entry.routes[i+1:])
-				}
-				entry.routes = entry.routes[:len(entry.routes)-1]
-				break
+	if entry == nil {
+		r.mutex.Unlock()
+		return nil
+	}
+	push := prepareNexthops(r.removeRoute(entry, faceID, origin))
+	r.mutex.Unlock()
+	return r.push(ctx, push)
+}
+
+// removeRoute removes the specified route from the entry, pruning the entry if it has no routes left, and returns the entries whose nexthops are affected, which are none if the entry has no such route. The mutex must be held.
+func (r *RibTable) removeRoute(entry *RibEntry, faceID uint64, origin uint64) []*RibEntry {
+	removed := false
+	for i, existingRoute := range entry.routes {
+		if existingRoute.FaceID == faceID && existingRoute.Origin == origin {
+			existingRoute.stopExpiry()
+			if i < len(entry.routes)-1 {
+				copy(entry.routes[i:], entry.routes[i+1:])
 			}
+			entry.routes = entry.routes[:len(entry.routes)-1]
+			r.journal.append(journalRecord{Op: journalRemove, Name: entry.Name.String(), FaceID: faceID, Origin: origin})
+			removed = true
+			break
 		}
-		entry.updateNexthops()
+	}
+	if !removed {
+		return nil
+	}
+	affected := entry.affectedEntries(nil)
+	entry.pruneIfEmpty()
+	return affected
+}
+
+// CleanUpFace removes the specified face from all entries. Used for clean-up after a face is destroyed. The routes are removed even if the updated nexthops cannot be pushed to the forwarder, in which case the first error is returned.
+func (r *RibTable) CleanUpFace(ctx context.Context, faceId uint64) error {
+	r.pushMutex.Lock()
+	defer r.pushMutex.Unlock()
+	r.mutex.Lock()
+	changed := r.removeFace(faceId, nil)
+	if len(changed) > 0 {
+		r.journal.append(journalRecord{Op: journalRemoveFace, FaceID: faceId})
+	}
+	push := prepareNexthops(withInheritingDescendants(changed))
+	for _, entry := range changed {
 		entry.pruneIfEmpty()
 	}
+	r.mutex.Unlock()
+	return r.push(ctx, push)
 }
 
-// CleanUpFace removes the specified face from all entries. Used for clean-up after a face is destroyed.
-func (r *RibEntry) CleanUpFace(faceId uint64) {
+// removeFace removes the routes via the specified face from the entry and its descendants, appending the entries that changed.
+func (r *RibEntry) removeFace(faceID uint64, changed []*RibEntry) []*RibEntry {
 	// Recursively clean children
 	for child := range r.children {
-		child.CleanUpFace(faceId)
+		changed = child.removeFace(faceID, changed)
 	}
-	// Remove next hop
-	if r.Name == nil {
-		return
-	}
-	for i, existingNexthop := range r.routes {
-		//fmt.Println(existingNexthop.FaceID, faceId)
-		if existingNexthop.FaceID == faceId {
-			if i < len(r.routes)-1 {
-				copy(r.routes[i:], r.routes[i+1:])
-			}
-			r.routes = r.routes[:len(r.routes)-1]
-			break
+	remaining := r.routes[:0]
+	for _, route := range r.routes {
+		if route.FaceID != faceID {
+			remaining = append(remaining, route)
+		} else {
+			route.stopExpiry()
 		}
 	}
-	r.updateNexthops()
-	r.pruneIfEmpty()
+	if len(remaining) != len(r.routes) {
+		r.routes = remaining
+		changed = append(changed, r)
+	}
+	return changed
 }
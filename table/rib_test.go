@@ -0,0 +1,309 @@
+package table
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/amazingtapioca17/mgmt/fakeforwarder"
+	"github.com/amazingtapioca17/mgmt/mgmtconn"
+	"github.com/named-data/YaNFD/ndn"
+)
+
+// forwarder is the fake forwarder that the RIBs under test push their nexthops to. Each test uses its own prefix, since the FIB is shared.
+var forwarder *fakeforwarder.Forwarder
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "rib")
+	if err != nil {
+		fmt.Println("Unable to create socket directory:", err)
+		os.Exit(1)
+	}
+	ackSocket := filepath.Join(dir, "ack.sock")
+	forwarder, err = fakeforwarder.Start(ackSocket, filepath.Join(dir, "packet.sock"))
+	if err != nil {
+		fmt.Println("Unable to start fake forwarder:", err)
+		os.Exit(1)
+	}
+	if err := mgmtconn.AcksConn.MakeMgmtConn(ackSocket, "json"); err != nil {
+		fmt.Println("Unable to connect to fake forwarder:", err)
+		os.Exit(1)
+	}
+	go mgmtconn.AcksConn.RunReceive()
+
+	code := m.Run()
+	mgmtconn.AcksConn.Close()
+	forwarder.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func makeRibTable() *RibTable {
+	return &RibTable{
+		RibEntry: RibEntry{
+			children: map[*RibEntry]bool{},
+		},
+	}
+}
+
+func makeName(t *testing.T, name string) *ndn.Name {
+	t.Helper()
+	parsed, err := ndn.NameFromString(name)
+	if err != nil {
+		t.Fatalf("invalid name %s: %v", name, err)
+	}
+	return parsed
+}
+
+// checkFib fails the test if the nexthops in the fake forwarder differ from the nexthops of the RIB for any of the names.
+func checkFib(t *testing.T, rib *RibTable, names []*ndn.Name) {
+	t.Helper()
+	for _, name := range names {
+		expected := make(map[uint64]uint64)
+		rib.mutex.RLock()
+		if entry := rib.findExactMatchEntry(name); entry != nil {
+			for _, nexthop := range entry.nexthops() {
+				expected[nexthop.FaceID] = nexthop.Cost
+			}
+		}
+		rib.mutex.RUnlock()
+		if actual := forwarder.NextHops(name); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("FIB nexthops of %s are %v, RIB has %v", name, actual, expected)
+		}
+	}
+}
+
+// hasExpiringRoutes returns whether the RIB has any routes with an expiration period.
+func hasExpiringRoutes(rib *RibTable) bool {
+	for _, entry := range rib.GetAllEntries() {
+		for _, route := range entry.GetRoutes() {
+			if route.ExpirationPeriod != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestAddRemoveRoute(t *testing.T) {
+	rib := makeRibTable()
+	ctx := context.Background()
+	name := makeName(t, "/add-remove/a")
+
+	if err := rib.AddRoute(ctx, name, 300, RouteOriginApp, 10, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := rib.AddRoute(ctx, name, 301, RouteOriginStatic, 20, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := rib.AddRoute(ctx, name, 300, RouteOriginStatic, 5, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if nexthops := forwarder.NextHops(name); !reflect.DeepEqual(nexthops, map[uint64]uint64{300: 5, 301: 20}) {
+		t.Errorf("nexthops after adding routes are %v", nexthops)
+	}
+
+	if err := rib.RemoveRoute(ctx, name, 300, RouteOriginStatic); err != nil {
+		t.Fatal(err)
+	}
+	if nexthops := forwarder.NextHops(name); !reflect.DeepEqual(nexthops, map[uint64]uint64{300: 10, 301: 20}) {
+		t.Errorf("nexthops after removing route are %v", nexthops)
+	}
+
+	if err := rib.RemoveRoute(ctx, name, 300, RouteOriginApp); err != nil {
+		t.Fatal(err)
+	}
+	if err := rib.RemoveRoute(ctx, name, 301, RouteOriginStatic); err != nil {
+		t.Fatal(err)
+	}
+	if nexthops := forwarder.NextHops(name); len(nexthops) != 0 {
+		t.Errorf("nexthops after removing all routes are %v", nexthops)
+	}
+	if entries := rib.GetAllEntries(); len(entries) != 0 {
+		t.Errorf("RIB has %d entries after removing all routes", len(entries))
+	}
+}
+
+func TestRemoveRouteOfIntermediatePrefix(t *testing.T) {
+	rib := makeRibTable()
+	ctx := context.Background()
+	name := makeName(t, "/intermediate/a/b")
+
+	if err := rib.AddRoute(ctx, name, 340, RouteOriginApp, 10, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	// /intermediate/a is only in the tree as the parent of /intermediate/a/b, and has no routes to remove
+	if err := rib.RemoveRoute(ctx, makeName(t, "/intermediate/a"), 340, RouteOriginApp); err != nil {
+		t.Fatal(err)
+	}
+	if err := rib.RemoveRoute(ctx, makeName(t, "/intermediate"), 340, RouteOriginApp); err != nil {
+		t.Fatal(err)
+	}
+	if nexthops := forwarder.NextHops(name); !reflect.DeepEqual(nexthops, map[uint64]uint64{340: 10}) {
+		t.Errorf("nexthops after removing routes of intermediate prefixes are %v", nexthops)
+	}
+	if entries := rib.GetAllEntries(); len(entries) != 1 {
+		t.Errorf("RIB has %d entries after removing routes of intermediate prefixes", len(entries))
+	}
+}
+
+func TestChildInherit(t *testing.T) {
+	rib := makeRibTable()
+	ctx := context.Background()
+	parent := makeName(t, "/inherit")
+	child := makeName(t, "/inherit/child")
+
+	if err := rib.AddRoute(ctx, child, 310, RouteOriginApp, 10, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := rib.AddRoute(ctx, parent, 311, RouteOriginApp, 20, RouteFlagChildInherit, nil); err != nil {
+		t.Fatal(err)
+	}
+	if nexthops := forwarder.NextHops(child); !reflect.DeepEqual(nexthops, map[uint64]uint64{310: 10, 311: 20}) {
+		t.Errorf("nexthops of child are %v", nexthops)
+	}
+
+	if err := rib.RemoveRoute(ctx, parent, 311, RouteOriginApp); err != nil {
+		t.Fatal(err)
+	}
+	if nexthops := forwarder.NextHops(child); !reflect.DeepEqual(nexthops, map[uint64]uint64{310: 10}) {
+		t.Errorf("nexthops of child after removing inherited route are %v", nexthops)
+	}
+}
+
+func TestRouteExpiry(t *testing.T) {
+	rib := makeRibTable()
+	ctx := context.Background()
+	name := makeName(t, "/expiry")
+	expirationPeriod := 50 * time.Millisecond
+
+	if err := rib.AddRoute(ctx, name, 320, RouteOriginApp, 10, 0, &expirationPeriod); err != nil {
+		t.Fatal(err)
+	}
+	if err := rib.AddRoute(ctx, name, 321, RouteOriginApp, 10, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if nexthops := forwarder.NextHops(name); len(nexthops) != 2 {
+		t.Errorf("nexthops before expiry are %v", nexthops)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(forwarder.NextHops(name)) != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if nexthops := forwarder.NextHops(name); !reflect.DeepEqual(nexthops, map[uint64]uint64{321: 10}) {
+		t.Errorf("nexthops after expiry are %v", nexthops)
+	}
+	entries := rib.GetAllEntries()
+	if len(entries) != 1 || len(entries[0].GetRoutes()) != 1 {
+		t.Errorf("RIB still has the expired route")
+	}
+}
+
+func TestCleanUpFace(t *testing.T) {
+	rib := makeRibTable()
+	ctx := context.Background()
+	a := makeName(t, "/cleanup/a")
+	b := makeName(t, "/cleanup/b")
+
+	for _, name := range []*ndn.Name{a, b} {
+		if err := rib.AddRoute(ctx, name, 330, RouteOriginApp, 10, 0, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rib.AddRoute(ctx, b, 331, RouteOriginApp, 10, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rib.CleanUpFace(ctx, 330); err != nil {
+		t.Fatal(err)
+	}
+	if nexthops := forwarder.NextHops(a); len(nexthops) != 0 {
+		t.Errorf("nexthops of %s after cleaning up face are %v", a, nexthops)
+	}
+	if nexthops := forwarder.NextHops(b); !reflect.DeepEqual(nexthops, map[uint64]uint64{331: 10}) {
+		t.Errorf("nexthops of %s after cleaning up face are %v", b, nexthops)
+	}
+	if entries := rib.GetAllEntries(); len(entries) != 1 {
+		t.Errorf("RIB has %d entries after cleaning up face", len(entries))
+	}
+}
+
+// TestConcurrentChanges changes the RIB from many goroutines at once, while routes expire and the RIB is read and resynchronized, and checks that the FIB ends up matching the RIB. Run it with -race.
+func TestConcurrentChanges(t *testing.T) {
+	rib := makeRibTable()
+	ctx := context.Background()
+	const workers = 8
+	const iterations = 50
+	expirationPeriod := 20 * time.Millisecond
+
+	names := make([]*ndn.Name, 0)
+	for i := 0; i < 4; i++ {
+		parent := makeName(t, fmt.Sprintf("/concurrent/%d", i))
+		names = append(names, parent, makeName(t, fmt.Sprintf("/concurrent/%d/child", i)))
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*iterations*4)
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			faceID := uint64(400 + worker)
+			for i := 0; i < iterations; i++ {
+				name := names[(worker+i)%len(names)]
+				flags := uint64(0)
+				if i%3 == 0 {
+					flags = RouteFlagChildInherit
+				}
+				var expiry *time.Duration
+				if i%5 == 0 {
+					expiry = &expirationPeriod
+				}
+				errs <- rib.AddRoute(ctx, name, faceID, uint64(i%2), uint64(i), flags, expiry)
+				switch i % 4 {
+				case 1:
+					errs <- rib.RemoveRoute(ctx, names[(worker+i+1)%len(names)], faceID, uint64(i%2))
+				case 2:
+					rib.GetAllEntries()
+				case 3:
+					errs <- rib.CleanUpFace(ctx, uint64(400+(worker+1)%workers))
+				}
+				if i%10 == 0 {
+					errs <- rib.Resync(ctx)
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Wait for the remaining routes with an expiration period to expire, and for the last expiry to be pushed
+	deadline := time.Now().Add(5 * time.Second)
+	for hasExpiringRoutes(rib) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	rib.pushMutex.Lock()
+	checkFib(t, rib, names)
+	rib.pushMutex.Unlock()
+
+	for worker := 0; worker < workers; worker++ {
+		if err := rib.CleanUpFace(ctx, uint64(400+worker)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if entries := rib.GetAllEntries(); len(entries) != 0 {
+		t.Errorf("RIB has %d entries after cleaning up all faces", len(entries))
+	}
+	checkFib(t, rib, names)
+}
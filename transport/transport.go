@@ -1,9 +1,13 @@
 package transport
 
 import (
+	"errors"
 	"fmt"
 	"net"
+	"time"
 
+	"github.com/amazingtapioca17/mgmt/peercred"
+	"github.com/amazingtapioca17/mgmt/shm"
 	"github.com/named-data/YaNFD/core"
 	"github.com/named-data/YaNFD/ndn/lpv2"
 	"github.com/named-data/YaNFD/ndn/tlv"
@@ -15,18 +19,53 @@ type FakeTransport struct {
 	Conn      net.Conn
 }
 
-func MakeFakeTransport() *FakeTransport {
+func MakeFakeTransport(socket string) *FakeTransport {
 	t := new(FakeTransport)
 	t.RecvQueue = make(chan []byte, 1024)
 	t.SendQueue = make(chan []byte, 1024)
-	t.Conn, _ = net.Dial("unix", "/run/nfd.sock")
+	t.Conn, _ = net.Dial("unix", socket)
 	return t
 }
+
+// CheckPeer returns an error if the process on the other end of the forwarder socket is not allowed by peers.
+func (t *FakeTransport) CheckPeer(peers *peercred.Allowlist) error {
+	if peers.Empty() {
+		return nil
+	}
+	if t.Conn == nil {
+		return errors.New("not connected to the forwarder")
+	}
+	return peers.Check(t.Conn)
+}
+
+// UseSharedMemory creates a shared memory segment with rings of ringSize bytes and asks the forwarder to attach it with attach, after which frames are exchanged over the segment instead of the socket. It must be called before RunReceive. If it fails, the socket keeps being used.
+func (t *FakeTransport) UseSharedMemory(ringSize int, attach func(segment string) error) error {
+	if t.Conn == nil {
+		return errors.New("not connected to the forwarder")
+	}
+	segment, err := shm.CreateTemp("ndn-mgmt-packets-*", ringSize)
+	if err != nil {
+		return err
+	}
+	defer segment.Unlink()
+	if err := attach(segment.Path()); err != nil {
+		segment.Close()
+		return err
+	}
+	t.Conn = segment.Conn(t.Conn)
+	return nil
+}
+
+// sendFrame queues a copy of the frame, since the frame is in the receive buffer, which is overwritten by the next read.
 func (t *FakeTransport) sendFrame(block []byte) {
-	t.RecvQueue <- block
+	frame := make([]byte, len(block))
+	copy(frame, block)
+	t.RecvQueue <- frame
 }
 
+// RunReceive reads frames from the forwarder socket until it is closed or StopReceive is called.
 func (t *FakeTransport) RunReceive() {
+	defer close(t.RecvQueue)
 	recvBuf := make([]byte, 8800)
 	startPos := 0
 	for {
@@ -74,7 +113,11 @@ func (t *FakeTransport) Receive() (*tlv.Block, []byte, uint64) {
 	// We need to use a for loop to silently ignore invalid packets
 	for shouldContinue {
 		select {
-		case frame := <-t.RecvQueue:
+		case frame, ok := <-t.RecvQueue:
+			if !ok {
+				shouldContinue = false
+				continue
+			}
 			lpBlock, _, err := tlv.DecodeBlock(frame)
 			if err != nil {
 				core.LogWarn(t, "Unable to decode received block - DROP")
@@ -130,6 +173,16 @@ func (t *FakeTransport) Send(block *tlv.Block, pitToken []byte, nextHopFaceID *u
 
 }
 
+// StopReceive stops reading from the forwarder socket, after which Receive returns nil. Frames can still be sent until Close is called.
+func (t *FakeTransport) StopReceive() {
+	t.Conn.SetReadDeadline(time.Now())
+}
+
+// Close closes the forwarder socket.
+func (t *FakeTransport) Close() error {
+	return t.Conn.Close()
+}
+
 func check(faceID uint64) string {
 	udpServer, err := net.ResolveUDPAddr("udp", ":1080")
 